@@ -0,0 +1,142 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AsyaBiryukova/go_final_project/internal/db"
+	nd "github.com/AsyaBiryukova/go_final_project/internal/nextdate"
+	"github.com/AsyaBiryukova/go_final_project/internal/ratelimit"
+)
+
+// audit.go содержит запись запросов в журнал аудита и просмотр журнала api/audit
+
+const (
+	// auditDefaultLimit количество записей в ответе api/audit, если не указан параметр limit
+	auditDefaultLimit = 50
+	// auditMaxLimit наибольшее значение параметра limit
+	auditMaxLimit = 500
+)
+
+var (
+	errAuditID     = errors.New("некорректный формат id")
+	errAuditAction = errors.New("неизвестное действие журнала аудита")
+	errAuditTime   = errors.New("некорректное время, ожидается формат RFC3339")
+	errAuditLimit  = errors.New("некорректное количество записей")
+)
+
+// statusRecorder запоминает статус ответа обработчика
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (rec *statusRecorder) WriteHeader(status int) {
+	rec.status = status
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+// Unwrap возвращает исходный ResponseWriter для http.ResponseController
+func (rec *statusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// AuditRequests записывает в журнал аудита изменяющие запросы к api: адрес клиента, метод, путь, пользователя
+// и статус ответа. Изменения задач во время запроса Storage записывает в журнал с тем же адресом и путём.
+// Подключается после ограничения частоты и ValidateRequest: запросы, отклонённые ими, не записываются,
+// чтобы поток запросов не заполнил журнал.
+func AuditRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !strings.HasPrefix(r.URL.Path, "/api/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		source := &db.AuditSource{IP: ratelimit.ClientIP(r), Method: r.Method, Route: r.URL.Path}
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r.WithContext(db.WithAuditSource(r.Context(), source)))
+
+		entry := db.AuditEntry{
+			UserID: source.UserID,
+			IP:     source.IP,
+			Method: source.Method,
+			Route:  source.Route,
+			Action: db.AuditRequest,
+			Status: rec.status,
+		}
+		// Ответ уже отправлен, поэтому запись не должна прерываться, если клиент закрыл соединение
+		err := dbs.AddAuditEntry(context.WithoutCancel(r.Context()), entry, source.OwnerID, time.Now())
+		if err != nil {
+			log.Println(err)
+		}
+	})
+}
+
+// GetAuditHandler обрабатывает GET запросы к /api/audit.
+// Возвращает JSON {"entries": []AuditEntry} с записями журнала аудита, начиная с новых: действия пользователя,
+// попытки входа в его учётную запись, изменения его задач и задач его списков. Параметры task_id, action и user_id отбирают записи задачи, действия
+// и пользователя, from и to ограничивают время записей в формате RFC3339, limit — количество записей.
+// Журнал доступен только после входа по паролю, но не с помощью API токена.
+func GetAuditHandler(w http.ResponseWriter, r *http.Request) {
+	err := requireSession(r)
+	if err != nil {
+		writeErr(err, w)
+		return
+	}
+	filter, err := parseAuditFilter(r)
+	if err != nil {
+		writeErr(err, w)
+		return
+	}
+	entries, err := userStorage(r.Context()).GetAuditLog(r.Context(), filter)
+	if err != nil {
+		writeErr(err, w)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string][]db.AuditEntry{"entries": entries})
+}
+
+// parseAuditFilter возвращает условия выборки журнала аудита из параметров запроса r
+func parseAuditFilter(r *http.Request) (db.AuditFilter, error) {
+	q := r.URL.Query()
+	filter := db.AuditFilter{TaskID: q.Get("task_id"), Action: q.Get("action"), UserID: q.Get("user_id"), Limit: auditDefaultLimit}
+	for field, id := range map[string]string{"task_id": filter.TaskID, "user_id": filter.UserID} {
+		if len(id) > 0 && !isID(id) {
+			return db.AuditFilter{}, nd.NewValidationError(field, errAuditID)
+		}
+	}
+	if len(filter.Action) > 0 && !slices.Contains(db.AuditActions, filter.Action) {
+		return db.AuditFilter{}, nd.NewValidationError("action", errAuditAction)
+	}
+	// Время записей хранится в UTC, поэтому границы приводятся к UTC для сравнения строк
+	for field, bound := range map[string]*string{"from": &filter.Since, "to": &filter.Until} {
+		value := q.Get(field)
+		if len(value) == 0 {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return db.AuditFilter{}, nd.NewValidationError(field, errAuditTime)
+		}
+		*bound = t.UTC().Format(time.RFC3339)
+	}
+	if limit := q.Get("limit"); len(limit) > 0 {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 || n > auditMaxLimit {
+			return db.AuditFilter{}, nd.NewValidationError("limit", errAuditLimit)
+		}
+		filter.Limit = n
+	}
+	return filter, nil
+}
@@ -0,0 +1,229 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/AsyaBiryukova/go_final_project/internal/auth"
+	"github.com/AsyaBiryukova/go_final_project/internal/db"
+	nd "github.com/AsyaBiryukova/go_final_project/internal/nextdate"
+	"github.com/AsyaBiryukova/go_final_project/internal/notify"
+)
+
+// batch.go содержит обработчик пакетных операций с задачами api/tasks/batch
+
+// batchLimit ограничивает количество операций в одном запросе
+const batchLimit = 100
+
+// Операции пакетного запроса
+const (
+	batchCreate = "create"
+	batchUpdate = "update"
+	batchDelete = "delete"
+	batchDone   = "done"
+)
+
+var (
+	errBatchEmpty    = errors.New("не указаны операции")
+	errBatchTooLarge = errors.New("слишком много операций в запросе")
+	errBatchOp       = errors.New("неизвестная операция")
+	errBatchTask     = errors.New("не указана задача")
+	errBatchVersion  = errors.New("не указана версия задачи")
+)
+
+// batchRequest описывает тело запроса к api/tasks/batch.
+// Если Atomic равен true, при ошибке любой операции откатываются все операции запроса.
+type batchRequest struct {
+	Atomic     bool             `json:"atomic"`
+	Operations []batchOperation `json:"operations"`
+}
+
+// batchOperation описывает одну операцию пакетного запроса. Version — версия задачи из ETag, обязательная
+// для update, delete и done, как заголовок If-Match в остальном api: операция выполняется только если задача
+// не изменилась.
+type batchOperation struct {
+	Op      string   `json:"op"`
+	ID      string   `json:"id"`
+	Version int64    `json:"version"`
+	Task    *db.Task `json:"task"`
+}
+
+// batchResult описывает результат одной операции
+type batchResult struct {
+	Index   int          `json:"index"`
+	Op      string       `json:"op"`
+	Status  int          `json:"status"`
+	ID      string       `json:"id,omitempty"`
+	Version int64        `json:"version,omitempty"`
+	Error   *errResponse `json:"error,omitempty"`
+
+	// event и task описывают событие, которое отправляется подписчикам после фиксации транзакции
+	event string
+	task  db.Task
+}
+
+// batchResponse описывает ответ на пакетный запрос. Committed равен false, если изменения были откачены.
+type batchResponse struct {
+	Committed bool          `json:"committed"`
+	Results   []batchResult `json:"results"`
+}
+
+// errAtomicBatch возвращается из транзакции, чтобы откатить изменения атомарного пакета
+var errAtomicBatch = errors.New("пакет операций отменён")
+
+// PostTasksBatchHandler обрабатывает POST запросы к api/tasks/batch.
+// Выполняет операции create, update, delete и done над задачами в одной транзакции.
+// Без atomic каждая операция выполняется независимо, ошибки отдельных операций не отменяют остальные.
+// С atomic при первой ошибке откатываются все операции, статус ответа равен статусу ошибки.
+// Возвращает JSON {"committed": bool, "results": []{"index", "op", "status", "id", "version", "error"}}.
+func PostTasksBatchHandler(w http.ResponseWriter, r *http.Request) {
+	var req batchRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		writeErr(err, w)
+		return
+	}
+	if len(req.Operations) == 0 {
+		writeErr(nd.NewValidationError("operations", errBatchEmpty), w)
+		return
+	}
+	if len(req.Operations) > batchLimit {
+		writeErr(nd.NewValidationError("operations", errBatchTooLarge), w)
+		return
+	}
+
+	var results []batchResult
+	failedStatus := http.StatusOK
+	err = userStorage(r.Context()).WithTx(r.Context(), func(tx *db.Storage) error {
+		results = make([]batchResult, 0, len(req.Operations))
+		for i, op := range req.Operations {
+			var res batchResult
+			err := tx.WithSavepoint(r.Context(), func() error {
+				var err error
+				res, err = runBatchOperation(r.Context(), tx, op)
+				return err
+			})
+			res.Index, res.Op = i, op.Op
+			if err != nil {
+				status, body := errBody(err, w)
+				res.Status, res.Error = status, &body
+			}
+			results = append(results, res)
+
+			if err != nil && req.Atomic {
+				failedStatus = res.Status
+				return errAtomicBatch
+			}
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errAtomicBatch) {
+		writeErr(err, w)
+		return
+	}
+
+	if err == nil {
+		for _, res := range results {
+			if len(res.event) > 0 {
+				publish(r.Context(), res.event, res.task)
+			}
+		}
+	}
+	writeJSON(w, failedStatus, batchResponse{Committed: err == nil, Results: results})
+}
+
+// runBatchOperation выполняет одну операцию пакетного запроса в транзакции tx
+func runBatchOperation(ctx context.Context, tx *db.Storage, op batchOperation) (batchResult, error) {
+	// Изменение существующей задачи, как и запрос с If-Match, требует версию, прочитанную клиентом
+	switch op.Op {
+	case batchUpdate, batchDelete, batchDone:
+		if op.Version <= 0 {
+			return batchResult{}, nd.NewValidationError("version", errBatchVersion)
+		}
+	}
+
+	switch op.Op {
+	case batchCreate:
+		if op.Task == nil {
+			return batchResult{}, nd.NewValidationError("task", errBatchTask)
+		}
+		task := *op.Task
+		// id задачи назначает база данных
+		task.ID = ""
+		task, err := task.FormatTask()
+		if err != nil {
+			return batchResult{}, err
+		}
+		err = authorizeList(ctx, tx, task.ListID, auth.ActionWrite)
+		if err != nil {
+			return batchResult{}, err
+		}
+		id, err := tx.AddTask(ctx, task)
+		if err != nil {
+			return batchResult{}, err
+		}
+		task.ID, task.Version = strconv.FormatInt(id, 10), 1
+		return batchResult{Status: http.StatusCreated, ID: task.ID, Version: 1, event: notify.EventTaskCreated, task: task}, nil
+
+	case batchUpdate:
+		if op.Task == nil {
+			return batchResult{}, nd.NewValidationError("task", errBatchTask)
+		}
+		task := *op.Task
+		if len(op.ID) > 0 {
+			task.ID = op.ID
+		}
+		task, err := task.FormatTask()
+		if err != nil {
+			return batchResult{}, err
+		}
+		// Список задачи не изменяется при обновлении
+		task.ListID, err = authorizeTask(ctx, tx, task.ID, auth.ActionWrite)
+		if err != nil {
+			return batchResult{}, err
+		}
+		task.Version = op.Version
+		version, err := tx.PutTask(ctx, task)
+		if err != nil {
+			return batchResult{}, err
+		}
+		task.Version, task.SnoozedFrom = version, ""
+		return batchResult{Status: http.StatusOK, ID: task.ID, Version: version, event: notify.EventTaskUpdated, task: task}, nil
+
+	case batchDelete:
+		if !isID(op.ID) {
+			return batchResult{}, errInvalidID
+		}
+		listID, err := authorizeTask(ctx, tx, op.ID, auth.ActionWrite)
+		if err != nil {
+			return batchResult{}, err
+		}
+		err = tx.DeleteTask(ctx, op.ID, op.Version)
+		if err != nil {
+			return batchResult{}, err
+		}
+		return batchResult{Status: http.StatusNoContent, ID: op.ID, event: notify.EventTaskDeleted, task: db.Task{ID: op.ID, ListID: listID}}, nil
+
+	case batchDone:
+		if !isID(op.ID) {
+			return batchResult{}, errInvalidID
+		}
+		_, err := authorizeTask(ctx, tx, op.ID, auth.ActionWrite)
+		if err != nil {
+			return batchResult{}, err
+		}
+		task, deleted, err := tx.CompleteTask(ctx, op.ID, op.Version, time.Now())
+		if err != nil {
+			return batchResult{}, err
+		}
+		if deleted {
+			return batchResult{Status: http.StatusNoContent, ID: op.ID, event: notify.EventTaskCompleted, task: task}, nil
+		}
+		return batchResult{Status: http.StatusOK, ID: op.ID, Version: task.Version, event: notify.EventTaskCompleted, task: task}, nil
+	}
+	return batchResult{}, nd.NewValidationError("op", errBatchOp)
+}
@@ -0,0 +1,134 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/AsyaBiryukova/go_final_project/internal/auth"
+	"github.com/AsyaBiryukova/go_final_project/internal/db"
+	"github.com/AsyaBiryukova/go_final_project/internal/i18n"
+	nd "github.com/AsyaBiryukova/go_final_project/internal/nextdate"
+)
+
+// errors.go содержит ошибки пакета api и их преобразование в ответы сервера
+
+// Машиночитаемые коды ошибок в ответах api
+const (
+	codeBadRequest   = "bad_request"
+	codeValidation   = "validation_error"
+	codeNotFound     = "not_found"
+	codeConflict     = "conflict"
+	codeUnauthorized = "unauthorized"
+	codeForbidden    = "forbidden"
+	codeNotAllowed   = "method_not_allowed"
+	codeTooLarge     = "request_entity_too_large"
+	codePrecondition = "precondition_failed"
+	codeRequired     = "precondition_required"
+	codeInternal     = "internal_error"
+	codeUnavailable  = "service_unavailable"
+	codeCanceled     = "client_closed_request"
+)
+
+// statusClientClosedRequest нестандартный статус для запросов, которые клиент отменил до получения ответа
+const statusClientClosedRequest = 499
+
+var (
+	errUnauthorized = errors.New("неправильный пароль")
+	errInvalidID    = nd.NewValidationError("id", errors.New("некорректный формат id"))
+
+	errMethodNotAllowed     = errors.New("метод не поддерживается")
+	errPreconditionRequired = errors.New("не указан заголовок If-Match")
+	// errInternal сообщение для клиента вместо внутренних ошибок, которые записываются только в лог
+	errInternal = errors.New("внутренняя ошибка сервера")
+	errTooLarge = errors.New("слишком большое тело запроса")
+)
+
+// errResponse описывает JSON ответ с ошибкой
+type errResponse struct {
+	Error string `json:"error"`
+	Code  string `json:"code"`
+	Field string `json:"field,omitempty"`
+}
+
+// errStatus возвращает HTTP статус и ответ, соответствующие ошибке err, с сообщением на языке lang
+func errStatus(err error, lang i18n.Lang) (int, errResponse) {
+	resp := errResponse{Error: i18n.Err(lang, err)}
+
+	var valErr *db.ValidationError
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	var maxBytesErr *http.MaxBytesError
+
+	switch {
+	case errors.As(err, &valErr):
+		resp.Code = codeValidation
+		resp.Field = valErr.Field
+		return http.StatusUnprocessableEntity, resp
+	case errors.Is(err, db.ErrNotFound), errors.Is(err, db.ErrWebhookNotFound), errors.Is(err, db.ErrListNotFound),
+		errors.Is(err, db.ErrMemberNotFound), errors.Is(err, db.ErrInviteNotFound), errors.Is(err, db.ErrAPITokenNotFound),
+		errors.Is(err, db.ErrTOTPNotFound):
+		resp.Code = codeNotFound
+		return http.StatusNotFound, resp
+	case errors.Is(err, db.ErrVersionConflict):
+		resp.Code = codePrecondition
+		return http.StatusPreconditionFailed, resp
+	case errors.Is(err, errPreconditionRequired):
+		resp.Code = codeRequired
+		return http.StatusPreconditionRequired, resp
+	case errors.Is(err, db.ErrConflict), errors.Is(err, db.ErrUserExists), errors.Is(err, db.ErrLastOwner),
+		errors.Is(err, db.ErrTOTPEnabled):
+		resp.Code = codeConflict
+		return http.StatusConflict, resp
+	case errors.Is(err, db.ErrTimeout):
+		resp.Code = codeUnavailable
+		return http.StatusServiceUnavailable, resp
+	case errors.Is(err, db.ErrCanceled):
+		resp.Code = codeCanceled
+		return statusClientClosedRequest, resp
+	case errors.Is(err, errUnauthorized), errors.Is(err, errTOTPCode), errors.Is(err, auth.ErrInvalidToken):
+		resp.Code = codeUnauthorized
+		return http.StatusUnauthorized, resp
+	case errors.Is(err, db.ErrForbidden), errors.Is(err, auth.ErrCSRF), errors.Is(err, errRegistrationClosed):
+		resp.Code = codeForbidden
+		return http.StatusForbidden, resp
+	case errors.Is(err, errMethodNotAllowed):
+		resp.Code = codeNotAllowed
+		return http.StatusMethodNotAllowed, resp
+	case errors.As(err, &maxBytesErr):
+		resp.Error = i18n.T(lang, errTooLarge.Error())
+		resp.Code = codeTooLarge
+		return http.StatusRequestEntityTooLarge, resp
+	case errors.As(err, &syntaxErr), errors.As(err, &typeErr):
+		resp.Error = i18n.T(lang, "некорректный формат JSON")
+		resp.Code = codeBadRequest
+		return http.StatusBadRequest, resp
+	default:
+		resp.Error = i18n.Err(lang, errInternal)
+		resp.Code = codeInternal
+		return http.StatusInternalServerError, resp
+	}
+}
+
+// writeErr пишет ошибку в response в формате JSON {"error": string, "code": string, "field": string}
+// со статусом, соответствующим типу ошибки. Сообщение переводится на язык ответа.
+func writeErr(err error, w http.ResponseWriter) {
+	status, errResp := errBody(err, w)
+	resp, err := json.Marshal(errResp)
+	if err != nil {
+		log.Println(err)
+	}
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(status)
+	_, err = w.Write(resp)
+	if err != nil {
+		log.Println(err)
+	}
+}
+
+// errBody записывает ошибку в лог и возвращает HTTP статус и ответ для err с сообщением, переведённым на язык ответа w
+func errBody(err error, w http.ResponseWriter) (int, errResponse) {
+	log.Println(err)
+	return errStatus(err, i18n.FromResponse(w))
+}
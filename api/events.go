@@ -0,0 +1,114 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/AsyaBiryukova/go_final_project/internal/auth"
+	"github.com/AsyaBiryukova/go_final_project/internal/db"
+	"github.com/AsyaBiryukova/go_final_project/internal/notify"
+	"github.com/AsyaBiryukova/go_final_project/internal/sse"
+)
+
+// events.go содержит отправку событий об изменении задач и поток событий api/events
+
+const (
+	// eventsRetry задержка перед переподключением клиента после разрыва потока
+	eventsRetry = time.Second * 3
+	// eventsHeartbeat период отправки комментария в поток без событий
+	eventsHeartbeat = time.Second * 15
+	// eventReset событие, после которого клиенту нужно заново загрузить задачи
+	eventReset = "reset"
+)
+
+// publish передаёт подписчикам событие eventType о задаче task. Событие о личной задаче получает пользователь запроса,
+// её владелец, а о задаче общего списка — все участники списка: notifier рассылает такие события через notify.Members.
+// Ошибка доставки не влияет на ответ клиенту, поэтому только записывается в журнал.
+func publish(ctx context.Context, eventType string, task db.Task) {
+	if notifier == nil {
+		return
+	}
+	// Задача уже изменена, поэтому событие отправляется даже если клиент закрыл соединение
+	ctx = context.WithoutCancel(ctx)
+	task.UserID = auth.UserID(ctx)
+	err := notifier.Notify(ctx, notify.Event{Type: eventType, Task: task, Time: time.Now()})
+	if err != nil {
+		log.Println(err)
+	}
+}
+
+// GetEventsHandler обрабатывает GET запросы к /api/events.
+// Отправляет поток Server-Sent Events с событиями об изменении задач пользователя: имя события равно типу события, данные —
+// JSON {"type", "task", "time"}. После переподключения с заголовком Last-Event-ID или параметром lastEventId
+// сначала отправляются пропущенные события. Если часть из них уже недоступна, отправляется событие reset,
+// после которого клиенту нужно заново загрузить задачи.
+func GetEventsHandler(w http.ResponseWriter, r *http.Request) {
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if len(lastEventID) == 0 {
+		lastEventID = r.URL.Query().Get("lastEventId")
+	}
+	sub, missed, complete := stream.Subscribe(auth.UserID(r.Context()), lastEventID)
+	defer stream.Unsubscribe(sub)
+
+	w.Header().Set("Content-Type", "text/event-stream; charset=UTF-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	// Отключаем буферизацию ответа в nginx
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	rc := http.NewResponseController(w)
+
+	_, err := fmt.Fprintf(w, "retry: %d\n\n", eventsRetry.Milliseconds())
+	if err != nil {
+		return
+	}
+	if !complete {
+		missed = append([]sse.Message{{Event: eventReset, Data: []byte("{}")}}, missed...)
+	}
+	for _, msg := range missed {
+		if writeEvent(w, msg) != nil {
+			return
+		}
+	}
+	if rc.Flush() != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(eventsHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case msg, ok := <-sub.C:
+			if !ok {
+				return
+			}
+			err = writeEvent(w, msg)
+		case <-heartbeat.C:
+			// Комментарий не даёт прокси закрыть неактивное соединение
+			_, err = io.WriteString(w, ": ping\n\n")
+		}
+		if err == nil {
+			err = rc.Flush()
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// writeEvent пишет событие msg в формате Server-Sent Events. Событие без ID пишется без поля id.
+func writeEvent(w io.Writer, msg sse.Message) error {
+	if msg.ID > 0 {
+		_, err := fmt.Fprintf(w, "id: %d\n", msg.ID)
+		if err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", msg.Event, msg.Data)
+	return err
+}
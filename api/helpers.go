@@ -1,13 +1,20 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"regexp"
+	"strconv"
+	"strings"
 
+	"github.com/AsyaBiryukova/go_final_project/internal/auth"
 	"github.com/AsyaBiryukova/go_final_project/internal/db"
+	"github.com/AsyaBiryukova/go_final_project/internal/notify"
+	"github.com/AsyaBiryukova/go_final_project/internal/sse"
 )
 
 // helpers.go содержит вспомогательные функции для работы других хендлеров
@@ -16,47 +23,99 @@ import (
 var (
 	dbs        db.Storage
 	dateFormat string
+	// notifier получает события об изменении задач, может быть nil
+	notifier notify.Notifier
+	// stream рассылает события об изменении задач в поток api/events
+	stream *sse.Hub
 )
 
 // ApiInit инициплизирует переменные используемые в пакете api, зависящие от переменных среды и других пакетов
-func ApiInit(storage db.Storage) {
+func ApiInit(storage db.Storage, events notify.Notifier, hub *sse.Hub) {
 	dbs = storage
+	notifier = events
+	stream = hub
 	dateFormat = os.Getenv("TODO_DATEFORMAT")
 }
 
+// userStorage возвращает Storage, запросы которого обращаются только к задачам пользователя из контекста запроса
+func userStorage(ctx context.Context) *db.Storage {
+	return dbs.ForUser(auth.UserID(ctx))
+}
+
 // isID возвращает true если переданная строка содержит только символы, которые могут находится в строке ID в базе данных.
 func isID(id string) bool {
-	isID, _ := regexp.Match("[0-9]+", []byte(id))
+	isID, _ := regexp.Match("^[0-9]+$", []byte(id))
 	return isID
 }
 
-// writeErr пишет ошибку в response в формате JSON и статус запроса BadRequest
-func writeErr(err error, w http.ResponseWriter) {
-	log.Println(err)
-	errResp := map[string]string{
-		"error": err.Error(),
-	}
-	resp, err := json.Marshal(errResp)
+// writeEmptyJson пишет в response пустой JSON {} и статус запроса OK
+func writeEmptyJson(w http.ResponseWriter) {
+	okResp := map[string]string{}
+	resp, err := json.Marshal(okResp)
 	if err != nil {
 		log.Println(err)
 	}
-	w.WriteHeader(http.StatusBadRequest)
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
 	_, err = w.Write(resp)
 	if err != nil {
 		log.Println(err)
 	}
 }
 
-// writeEmptyJson пишет в response пустой JSON {} и статус запроса OK
-func writeEmptyJson(w http.ResponseWriter) {
-	okResp := map[string]string{}
-	resp, err := json.Marshal(okResp)
+// writeJSON пишет в response значение v в формате JSON и указанный статус запроса
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	resp, err := json.Marshal(v)
 	if err != nil {
-		log.Println(err)
+		writeErr(err, w)
+		return
 	}
-	w.WriteHeader(http.StatusOK)
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(status)
 	_, err = w.Write(resp)
 	if err != nil {
 		log.Println(err)
 	}
-}
\ No newline at end of file
+}
+
+// writeMethodNotAllowed пишет ошибку 405 и заголовок Allow со списком поддерживаемых методов
+func writeMethodNotAllowed(w http.ResponseWriter, allowed ...string) {
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	writeErr(errMethodNotAllowed, w)
+}
+
+// etag возвращает значение заголовка ETag для версии задачи
+func etag(version int64) string {
+	return fmt.Sprintf(`"%d"`, version)
+}
+
+// ifMatchVersion возвращает версию задачи из заголовка If-Match и true, если заголовок указан.
+// Значение "*" соответствует любой версии и возвращается как 0.
+// Если значение не является ETag задачи, возвращает ошибку db.ErrVersionConflict.
+func ifMatchVersion(r *http.Request) (int64, bool, error) {
+	ifMatch := strings.TrimSpace(r.Header.Get("If-Match"))
+	if len(ifMatch) == 0 {
+		return 0, false, nil
+	}
+	if ifMatch == "*" {
+		return 0, true, nil
+	}
+	ifMatch = strings.TrimPrefix(ifMatch, "W/")
+	version, err := strconv.ParseInt(strings.Trim(ifMatch, `"`), 10, 64)
+	if err != nil || version < 1 {
+		return 0, true, db.ErrVersionConflict
+	}
+	return version, true, nil
+}
+
+// requireIfMatch работает как ifMatchVersion, но возвращает ошибку, если заголовок If-Match не указан
+func requireIfMatch(r *http.Request) (int64, error) {
+	version, ok, err := ifMatchVersion(r)
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		return 0, errPreconditionRequired
+	}
+	return version, nil
+}
@@ -0,0 +1,313 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/AsyaBiryukova/go_final_project/internal/auth"
+	"github.com/AsyaBiryukova/go_final_project/internal/db"
+	nd "github.com/AsyaBiryukova/go_final_project/internal/nextdate"
+)
+
+// lists.go содержит обработчики запросов к общим спискам задач api/lists
+
+// inviteTTL срок действия приглашения в список задач
+const inviteTTL = time.Hour * 24 * 7
+
+var (
+	errListName   = errors.New("не указано название списка")
+	errRole       = errors.New("неизвестная роль")
+	errUserID     = errors.New("некорректный формат user_id")
+	errInviteCode = errors.New("не указан token приглашения")
+)
+
+// invite описывает приглашение в список задач. Token передаётся приглашённому пользователю
+// и возвращается только при создании приглашения.
+type invite struct {
+	Token     string `json:"token"`
+	ListID    string `json:"list_id"`
+	Role      string `json:"role"`
+	ExpiresAt string `json:"expires_at"`
+}
+
+// authorizeTask возвращает db.ErrForbidden, если роль пользователя storage в задаче id не позволяет
+// выполнить действие action. Возвращает ID списка задачи или пустую строку для личной задачи.
+func authorizeTask(ctx context.Context, storage *db.Storage, id string, action auth.Action) (string, error) {
+	listID, role, err := storage.TaskRole(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	return listID, auth.Authorize(role, action)
+}
+
+// authorizeList возвращает db.ErrForbidden, если роль пользователя storage в списке listID не позволяет
+// выполнить действие action. Личные задачи без списка доступны всегда.
+func authorizeList(ctx context.Context, storage *db.Storage, listID string, action auth.Action) error {
+	if len(listID) == 0 {
+		return nil
+	}
+	role, err := storage.ListRole(ctx, listID)
+	if err != nil {
+		return err
+	}
+	return auth.Authorize(role, action)
+}
+
+// ListsHandler обрабатывает запросы к /api/lists.
+// GET возвращает JSON {"lists": []List} со списками, в которых состоит пользователь, и его ролью в них.
+// POST с JSON {"name"} создаёт список, пользователь становится его владельцем. DELETE с параметром id удаляет
+// список вместе с задачами, удалить список может только владелец.
+// Управлять списками можно только после входа по паролю, но не с помощью API токена.
+func ListsHandler(w http.ResponseWriter, r *http.Request) {
+	err := requireSession(r)
+	if err != nil {
+		writeErr(err, w)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		getLists(w, r)
+	case http.MethodPost:
+		postList(w, r)
+	case http.MethodDelete:
+		deleteList(w, r)
+	default:
+		writeMethodNotAllowed(w, http.MethodGet, http.MethodPost, http.MethodDelete)
+	}
+}
+
+func getLists(w http.ResponseWriter, r *http.Request) {
+	lists, err := userStorage(r.Context()).GetLists(r.Context())
+	if err != nil {
+		writeErr(err, w)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string][]db.List{"lists": lists})
+}
+
+// postList возвращает JSON созданного списка со статусом 201
+func postList(w http.ResponseWriter, r *http.Request) {
+	var list db.List
+	err := json.NewDecoder(r.Body).Decode(&list)
+	if err != nil {
+		writeErr(err, w)
+		return
+	}
+	if len(list.Name) == 0 {
+		writeErr(nd.NewValidationError("name", errListName), w)
+		return
+	}
+
+	now := time.Now()
+	list.ID, err = userStorage(r.Context()).AddList(r.Context(), list.Name, now)
+	if err != nil {
+		writeErr(err, w)
+		return
+	}
+	list.Role = db.RoleOwner
+	list.CreatedAt = now.UTC().Format(time.RFC3339)
+	writeJSON(w, http.StatusCreated, list)
+}
+
+func deleteList(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("id")
+	if !isID(id) {
+		writeErr(errInvalidID, w)
+		return
+	}
+	storage := userStorage(r.Context())
+	err := authorizeList(r.Context(), storage, id, auth.ActionManage)
+	if err == nil {
+		err = storage.DeleteList(r.Context(), id)
+	}
+	if err != nil {
+		writeErr(err, w)
+		return
+	}
+	writeEmptyJson(w)
+}
+
+// MembersHandler обрабатывает запросы к /api/lists/members с параметром id списка.
+// GET возвращает JSON {"members": []Member}. PUT с параметром user_id и JSON {"role"} изменяет роль участника,
+// DELETE с параметром user_id удаляет участника. Изменять роли и удалять других участников может только владелец,
+// выйти из списка может любой участник. В списке всегда остаётся хотя бы один владелец.
+func MembersHandler(w http.ResponseWriter, r *http.Request) {
+	err := requireSession(r)
+	if err != nil {
+		writeErr(err, w)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		getMembers(w, r)
+	case http.MethodPut:
+		putMember(w, r)
+	case http.MethodDelete:
+		deleteMember(w, r)
+	default:
+		writeMethodNotAllowed(w, http.MethodGet, http.MethodPut, http.MethodDelete)
+	}
+}
+
+func getMembers(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("id")
+	if !isID(id) {
+		writeErr(errInvalidID, w)
+		return
+	}
+	members, err := userStorage(r.Context()).GetMembers(r.Context(), id)
+	if err != nil {
+		writeErr(err, w)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string][]db.Member{"members": members})
+}
+
+func putMember(w http.ResponseWriter, r *http.Request) {
+	id, userID, err := memberParams(r)
+	if err != nil {
+		writeErr(err, w)
+		return
+	}
+	var member db.Member
+	err = json.NewDecoder(r.Body).Decode(&member)
+	if err != nil {
+		writeErr(err, w)
+		return
+	}
+	if !slices.Contains(db.Roles, member.Role) {
+		writeErr(nd.NewValidationError("role", errRole), w)
+		return
+	}
+
+	storage := userStorage(r.Context())
+	err = authorizeList(r.Context(), storage, id, auth.ActionManage)
+	if err == nil {
+		err = storage.SetMemberRole(r.Context(), id, userID, member.Role)
+	}
+	if err != nil {
+		writeErr(err, w)
+		return
+	}
+	writeEmptyJson(w)
+}
+
+func deleteMember(w http.ResponseWriter, r *http.Request) {
+	id, userID, err := memberParams(r)
+	if err != nil {
+		writeErr(err, w)
+		return
+	}
+
+	storage := userStorage(r.Context())
+	action := auth.ActionManage
+	// Выйти из списка может любой участник
+	if userID == storage.UserID() {
+		action = auth.ActionRead
+	}
+	err = authorizeList(r.Context(), storage, id, action)
+	if err == nil {
+		err = storage.DeleteMember(r.Context(), id, userID)
+	}
+	if err != nil {
+		writeErr(err, w)
+		return
+	}
+	writeEmptyJson(w)
+}
+
+// memberParams возвращает ID списка и ID участника из параметров id и user_id
+func memberParams(r *http.Request) (string, int64, error) {
+	q := r.URL.Query()
+	id := q.Get("id")
+	if !isID(id) {
+		return "", 0, errInvalidID
+	}
+	userID, err := strconv.ParseInt(q.Get("user_id"), 10, 64)
+	if err != nil {
+		return "", 0, nd.NewValidationError("user_id", errUserID)
+	}
+	return id, userID, nil
+}
+
+// PostInviteHandler обрабатывает POST запросы к /api/lists/invites с параметром id списка.
+// Принимает JSON {"role"} и возвращает со статусом 201 JSON {"token", "list_id", "role", "expires_at"}.
+// Приглашение действует неделю и используется один раз через api/lists/join. Приглашать может только владелец.
+func PostInviteHandler(w http.ResponseWriter, r *http.Request) {
+	err := requireSession(r)
+	if err != nil {
+		writeErr(err, w)
+		return
+	}
+	id := r.URL.Query().Get("id")
+	if !isID(id) {
+		writeErr(errInvalidID, w)
+		return
+	}
+	var inv invite
+	err = json.NewDecoder(r.Body).Decode(&inv)
+	if err != nil {
+		writeErr(err, w)
+		return
+	}
+	if !slices.Contains(db.Roles, inv.Role) {
+		writeErr(nd.NewValidationError("role", errRole), w)
+		return
+	}
+
+	storage := userStorage(r.Context())
+	err = authorizeList(r.Context(), storage, id, auth.ActionManage)
+	if err != nil {
+		writeErr(err, w)
+		return
+	}
+	token := make([]byte, 16)
+	_, err = rand.Read(token)
+	if err != nil {
+		writeErr(err, w)
+		return
+	}
+	inv.Token = hex.EncodeToString(token)
+	inv.ListID = id
+	expiresAt := time.Now().Add(inviteTTL)
+	err = storage.AddInvite(r.Context(), id, inv.Role, inv.Token, expiresAt)
+	if err != nil {
+		writeErr(err, w)
+		return
+	}
+	inv.ExpiresAt = expiresAt.UTC().Format(time.RFC3339)
+	writeJSON(w, http.StatusCreated, inv)
+}
+
+// PostJoinHandler обрабатывает POST запросы к /api/lists/join.
+// Принимает JSON {"token"} с приглашением, добавляет пользователя в список и возвращает JSON списка с ролью пользователя.
+func PostJoinHandler(w http.ResponseWriter, r *http.Request) {
+	err := requireSession(r)
+	if err != nil {
+		writeErr(err, w)
+		return
+	}
+	var inv invite
+	err = json.NewDecoder(r.Body).Decode(&inv)
+	if err != nil {
+		writeErr(err, w)
+		return
+	}
+	if len(inv.Token) == 0 {
+		writeErr(nd.NewValidationError("token", errInviteCode), w)
+		return
+	}
+	list, err := userStorage(r.Context()).AcceptInvite(r.Context(), inv.Token, time.Now())
+	if err != nil {
+		writeErr(err, w)
+		return
+	}
+	writeJSON(w, http.StatusOK, list)
+}
@@ -8,30 +8,38 @@ import (
 	nd "github.com/AsyaBiryukova/go_final_project/internal/nextdate"
 )
 
-// GetNextDateHandler обрабатывает GET запросы к api/nextdate
+// GetNextDateHandler обрабатывает GET запросы к api/nextdate.
+// Возвращает следующую дату текстом, или JSON {"error": error} если параметры запроса некорректны.
 func GetNextDateHandler(w http.ResponseWriter, r *http.Request) {
 
 	q := r.URL.Query()
 	now := q.Get("now")
 	date := q.Get("date")
 	repeat := q.Get("repeat")
-	nowDate, err := time.Parse(dateFormat, now)
-	if err != nil {
-		log.Println(err)
-		return
+
+	// Если now не указан, считаем от текущей даты
+	nowDate := time.Now()
+	if len(now) > 0 {
+		var err error
+		nowDate, err = time.Parse(dateFormat, now)
+		if err != nil {
+			log.Println(err)
+			writeErr(nd.NewValidationError("now", nd.ErrInvalidDate), w)
+			return
+		}
 	}
 
 	nextDate, err := nd.NextDate(nowDate, date, repeat)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeErr(err, w)
 		return
 	}
 	resp := []byte(nextDate)
 
-	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Type", "text/plain; charset=UTF-8")
 	w.WriteHeader(http.StatusOK)
 	_, err = w.Write(resp)
 	if err != nil {
 		log.Println(err)
 	}
-}
\ No newline at end of file
+}
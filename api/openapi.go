@@ -0,0 +1,368 @@
+package api
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	nd "github.com/AsyaBiryukova/go_final_project/internal/nextdate"
+)
+
+// openapi.go содержит спецификацию OpenAPI и проверку запросов по ней
+
+//go:embed openapi.json
+var openapiJSON []byte
+
+// maxBodySize наибольший размер тела запроса в байтах
+const maxBodySize = 1 << 20
+
+// apiSpec содержит разобранную спецификацию, по которой проверяются запросы
+var apiSpec = mustParseSpec(openapiJSON)
+
+// openapiSpec описывает часть документа OpenAPI, нужную для проверки запросов
+type openapiSpec struct {
+	Paths      map[string]map[string]operation `json:"paths"`
+	Components struct {
+		Schemas    map[string]schema    `json:"schemas"`
+		Parameters map[string]parameter `json:"parameters"`
+	} `json:"components"`
+	// templates шаблоны путей с параметрами в порядке проверки в findOperation
+	templates []string
+}
+
+type operation struct {
+	Parameters  []parameter  `json:"parameters"`
+	RequestBody *requestBody `json:"requestBody"`
+}
+
+type parameter struct {
+	Ref      string `json:"$ref"`
+	Name     string `json:"name"`
+	In       string `json:"in"`
+	Required bool   `json:"required"`
+	Schema   schema `json:"schema"`
+}
+
+type requestBody struct {
+	Required bool `json:"required"`
+	Content  map[string]struct {
+		Schema schema `json:"schema"`
+	} `json:"content"`
+}
+
+type schema struct {
+	Ref        string            `json:"$ref"`
+	Type       string            `json:"type"`
+	Required   []string          `json:"required"`
+	Properties map[string]schema `json:"properties"`
+	Items      *schema           `json:"items"`
+	Pattern    *pattern          `json:"pattern"`
+	MinLength  *int              `json:"minLength"`
+	MaxLength  *int              `json:"maxLength"`
+	Enum       []string          `json:"enum"`
+	Nullable   bool              `json:"nullable"`
+}
+
+// pattern регулярное выражение из свойства pattern схемы. Компилируется при разборе openapi.json,
+// поэтому некорректное выражение останавливает запуск сервера, а не ломает проверку запросов.
+type pattern struct {
+	*regexp.Regexp
+}
+
+// UnmarshalJSON компилирует регулярное выражение из строки JSON
+func (p *pattern) UnmarshalJSON(data []byte) error {
+	var expr string
+	err := json.Unmarshal(data, &expr)
+	if err != nil {
+		return err
+	}
+	p.Regexp, err = regexp.Compile(expr)
+	if err != nil {
+		return fmt.Errorf("некорректный pattern %q: %w", expr, err)
+	}
+	return nil
+}
+
+// Ошибки проверки запроса
+var (
+	errRequired  = errors.New("обязательное поле не указано")
+	errType      = errors.New("некорректный тип значения")
+	errPattern   = errors.New("значение не соответствует формату")
+	errMinLength = errors.New("слишком короткое значение")
+	errMaxLength = errors.New("слишком длинное значение")
+	errEnum      = errors.New("недопустимое значение")
+)
+
+// mustParseSpec разбирает встроенный документ OpenAPI. Паникует, если документ некорректен.
+func mustParseSpec(raw []byte) *openapiSpec {
+	var spec openapiSpec
+	if err := json.Unmarshal(raw, &spec); err != nil {
+		panic("некорректный openapi.json: " + err.Error())
+	}
+	for path := range spec.Paths {
+		if strings.Contains(path, "{") {
+			spec.templates = append(spec.templates, path)
+		}
+	}
+	slices.SortFunc(spec.templates, compareTemplates)
+	return &spec
+}
+
+// compareTemplates упорядочивает шаблоны путей так, чтобы постоянный сегмент проверялся раньше параметра
+// на той же позиции: /tasks/batch раньше /tasks/{id}. Остальные шаблоны упорядочены по алфавиту.
+func compareTemplates(a, b string) int {
+	aSegments := strings.Split(strings.Trim(a, "/"), "/")
+	bSegments := strings.Split(strings.Trim(b, "/"), "/")
+	for i := range min(len(aSegments), len(bSegments)) {
+		aParam, bParam := strings.HasPrefix(aSegments[i], "{"), strings.HasPrefix(bSegments[i], "{")
+		switch {
+		case aParam && !bParam:
+			return 1
+		case !aParam && bParam:
+			return -1
+		}
+	}
+	return strings.Compare(a, b)
+}
+
+// GetOpenAPIHandler обрабатывает GET запросы к api/openapi.json и возвращает спецификацию API.
+func GetOpenAPIHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	_, err := w.Write(openapiJSON)
+	if err != nil {
+		log.Println(err)
+	}
+}
+
+// ValidateRequest проверяет параметры запроса и тело JSON по спецификации OpenAPI до передачи запроса обработчику.
+// Запросы к путям и методам, которых нет в спецификации, передаются дальше без проверки.
+// Тело запроса ограничено maxBodySize байтами.
+// При ошибке возвращает JSON {"error": error, "code": "validation_error", "field": string}.
+func ValidateRequest(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, maxBodySize)
+		op, pathParams, ok := apiSpec.findOperation(r.Method, r.URL.Path)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		err := apiSpec.validateParams(op, r, pathParams)
+		if err != nil {
+			writeErr(err, w)
+			return
+		}
+
+		if op.RequestBody != nil {
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				writeErr(err, w)
+				return
+			}
+			// Возвращаем тело запроса, чтобы его мог прочитать обработчик
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			err = apiSpec.validateBody(op.RequestBody, body)
+			if err != nil {
+				writeErr(err, w)
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// findOperation ищет описание операции для метода и пути запроса. Поддерживает шаблоны вида /tasks/{id},
+// значения параметров из пути возвращаются в pathParams.
+func (spec *openapiSpec) findOperation(method, path string) (op operation, pathParams map[string]string, ok bool) {
+	method = strings.ToLower(method)
+	if ops, ok := spec.Paths[path]; ok {
+		op, ok := ops[method]
+		return op, nil, ok
+	}
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	for _, template := range spec.templates {
+		ops := spec.Paths[template]
+		tmplSegments := strings.Split(strings.Trim(template, "/"), "/")
+		if len(tmplSegments) != len(segments) {
+			continue
+		}
+		params := make(map[string]string)
+		match := true
+		for i, seg := range tmplSegments {
+			if name, isParam := strings.CutPrefix(seg, "{"); isParam {
+				params[strings.TrimSuffix(name, "}")] = segments[i]
+				continue
+			}
+			if seg != segments[i] {
+				match = false
+				break
+			}
+		}
+		if match {
+			op, ok := ops[method]
+			return op, params, ok
+		}
+	}
+	return operation{}, nil, false
+}
+
+// validateParams проверяет query параметры и параметры пути запроса
+func (spec *openapiSpec) validateParams(op operation, r *http.Request, pathParams map[string]string) error {
+	q := r.URL.Query()
+	for _, param := range op.Parameters {
+		param = spec.resolveParam(param)
+
+		var value string
+		var has bool
+		switch param.In {
+		case "query":
+			value, has = q.Get(param.Name), q.Has(param.Name)
+		case "path":
+			value, has = pathParams[param.Name]
+		default:
+			continue
+		}
+
+		if !has {
+			if param.Required {
+				return nd.NewValidationError(param.Name, errRequired)
+			}
+			continue
+		}
+		err := spec.validateValue(param.Name, param.Schema, value)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateBody проверяет тело запроса в формате JSON
+func (spec *openapiSpec) validateBody(reqBody *requestBody, body []byte) error {
+	if len(bytes.TrimSpace(body)) == 0 {
+		if reqBody.Required {
+			return nd.NewValidationError("body", errRequired)
+		}
+		return nil
+	}
+	content, ok := reqBody.Content["application/json"]
+	if !ok {
+		content, ok = reqBody.Content["application/merge-patch+json"]
+	}
+	if !ok {
+		return nil
+	}
+	var value any
+	if err := json.Unmarshal(body, &value); err != nil {
+		return err
+	}
+	return spec.validateValue("body", content.Schema, value)
+}
+
+// validateValue проверяет значение поля field по схеме s
+func (spec *openapiSpec) validateValue(field string, s schema, value any) error {
+	s = spec.resolveSchema(s)
+	if value == nil && s.Nullable {
+		return nil
+	}
+
+	switch s.Type {
+	case "object":
+		obj, ok := value.(map[string]any)
+		if !ok {
+			return nd.NewValidationError(field, errType)
+		}
+		for _, name := range s.Required {
+			if _, ok := obj[name]; !ok {
+				return nd.NewValidationError(name, errRequired)
+			}
+		}
+		for name, propSchema := range s.Properties {
+			propValue, ok := obj[name]
+			if !ok {
+				continue
+			}
+			if err := spec.validateValue(name, propSchema, propValue); err != nil {
+				return err
+			}
+		}
+	case "array":
+		list, ok := value.([]any)
+		if !ok {
+			return nd.NewValidationError(field, errType)
+		}
+		if s.Items != nil {
+			for _, item := range list {
+				if err := spec.validateValue(field, *s.Items, item); err != nil {
+					return err
+				}
+			}
+		}
+	case "string":
+		str, ok := value.(string)
+		if !ok {
+			return nd.NewValidationError(field, errType)
+		}
+		return validateString(field, s, str)
+	case "integer", "number":
+		if _, ok := value.(float64); !ok {
+			return nd.NewValidationError(field, errType)
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return nd.NewValidationError(field, errType)
+		}
+	}
+	return nil
+}
+
+// validateString проверяет ограничения строкового значения
+func validateString(field string, s schema, str string) error {
+	length := utf8.RuneCountInString(str)
+	if s.MinLength != nil && length < *s.MinLength {
+		return nd.NewValidationError(field, errMinLength)
+	}
+	if s.MaxLength != nil && length > *s.MaxLength {
+		return nd.NewValidationError(field, errMaxLength)
+	}
+	if s.Pattern != nil && !s.Pattern.MatchString(str) {
+		return nd.NewValidationError(field, errPattern)
+	}
+	if len(s.Enum) > 0 {
+		for _, allowed := range s.Enum {
+			if str == allowed {
+				return nil
+			}
+		}
+		return nd.NewValidationError(field, errEnum)
+	}
+	return nil
+}
+
+// resolveSchema заменяет ссылку $ref на схему из components
+func (spec *openapiSpec) resolveSchema(s schema) schema {
+	if name, ok := strings.CutPrefix(s.Ref, "#/components/schemas/"); ok {
+		return spec.Components.Schemas[name]
+	}
+	return s
+}
+
+// resolveParam заменяет ссылку $ref на параметр из components
+func (spec *openapiSpec) resolveParam(p parameter) parameter {
+	if name, ok := strings.CutPrefix(p.Ref, "#/components/parameters/"); ok {
+		return spec.Components.Parameters[name]
+	}
+	return p
+}
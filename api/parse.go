@@ -0,0 +1,40 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	nd "github.com/AsyaBiryukova/go_final_project/internal/nextdate"
+)
+
+// GetParseHandler обрабатывает GET запросы к api/parse.
+// Разбирает фразу на естественном языке из параметра text и возвращает JSON {"date": string, "repeat": string},
+// который можно передать в api/task. В случае ошибки возвращает JSON {"error": error}.
+func GetParseHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	q := r.URL.Query()
+	text := q.Get("text")
+
+	date, repeat, err := nd.Parse(text, time.Now())
+	if err != nil {
+		writeErr(err, w)
+		return
+	}
+
+	parseResp := map[string]string{
+		"date":   date,
+		"repeat": repeat,
+	}
+	resp, err := json.Marshal(parseResp)
+	if err != nil {
+		log.Println(err)
+	}
+	w.WriteHeader(http.StatusOK)
+	_, err = w.Write(resp)
+	if err != nil {
+		log.Println(err)
+	}
+}
@@ -2,28 +2,142 @@ package api
 
 import (
 	"bytes"
-	"crypto/sha256"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
+	"time"
 
-	"github.com/golang-jwt/jwt/v5"
+	"github.com/AsyaBiryukova/go_final_project/internal/auth"
+	"github.com/AsyaBiryukova/go_final_project/internal/db"
+	nd "github.com/AsyaBiryukova/go_final_project/internal/nextdate"
+	"github.com/AsyaBiryukova/go_final_project/internal/ratelimit"
 )
 
 var (
 	targetPassword = os.Getenv("TODO_PASSWORD")
 )
 
+var (
+	errRefreshToken       = errors.New("не указан refresh_token")
+	errRegistrationClosed = errors.New("регистрация закрыта, добавить пользователя может только вошедший пользователь")
+)
+
+// openRegistration разрешает регистрацию без входа, задаётся переменной TODO_REGISTRATION
+var openRegistration bool
+
+const (
+	// defaultSigninAttempts неудачных попыток входа с одного адреса до блокировки, если не задана TODO_SIGNIN_ATTEMPTS
+	defaultSigninAttempts = 5
+	// defaultSigninGlobalAttempts неудачных попыток входа со всех адресов до блокировки входа,
+	// если не задана TODO_SIGNIN_GLOBAL_ATTEMPTS
+	defaultSigninGlobalAttempts = 100
+	// defaultSigninLockout срок первой блокировки, если не задана TODO_SIGNIN_LOCKOUT
+	defaultSigninLockout = time.Second
+	// signinMaxLockout и signinGlobalMaxLockout максимальные сроки блокировки адреса и всего входа
+	signinMaxLockout       = time.Minute * 15
+	signinGlobalMaxLockout = time.Minute
+)
+
+// signinLockout блокирует вход с адреса ip и вход со всех адресов global после серии неудачных попыток.
+// Каждая следующая неудачная попытка удваивает срок блокировки.
+var signinLockout struct {
+	ip, global *ratelimit.Lockout
+}
+
+// SigninInit настраивает защиту api/signin от перебора паролей. Количество неудачных попыток с одного адреса
+// и со всех адресов до блокировки читается из переменных TODO_SIGNIN_ATTEMPTS и TODO_SIGNIN_GLOBAL_ATTEMPTS,
+// значение 0 отключает блокировку. Срок первой блокировки читается из TODO_SIGNIN_LOCKOUT в формате time.ParseDuration.
+// Значение true переменной TODO_REGISTRATION открывает регистрацию в api/register без входа.
+func SigninInit() error {
+	attempts, err := intFromEnv("TODO_SIGNIN_ATTEMPTS", defaultSigninAttempts)
+	if err != nil {
+		return err
+	}
+	globalAttempts, err := intFromEnv("TODO_SIGNIN_GLOBAL_ATTEMPTS", defaultSigninGlobalAttempts)
+	if err != nil {
+		return err
+	}
+	lockout := defaultSigninLockout
+	if env := os.Getenv("TODO_SIGNIN_LOCKOUT"); len(env) > 0 {
+		lockout, err = time.ParseDuration(env)
+		if err != nil || lockout <= 0 {
+			return fmt.Errorf("некорректное значение TODO_SIGNIN_LOCKOUT: %q", env)
+		}
+	}
+	signinLockout.ip = ratelimit.NewLockout(attempts, lockout, signinMaxLockout)
+	signinLockout.global = ratelimit.NewLockout(globalAttempts, lockout, signinGlobalMaxLockout)
+	if env := os.Getenv("TODO_REGISTRATION"); len(env) > 0 {
+		openRegistration, err = strconv.ParseBool(env)
+		if err != nil {
+			return fmt.Errorf("некорректное значение TODO_REGISTRATION: %q", env)
+		}
+	}
+	return nil
+}
+
+// attemptSignin учитывает попытку входа с адреса ip как неудачную до проверки пароля или кода, чтобы параллельные
+// попытки не обходили блокировку. Возвращает срок блокировки, если адрес или весь вход заблокирован, тогда попытку
+// проверять нельзя. Удачную попытку завершает signinSucceeded, а попытку, не проверенную из-за другой ошибки, — releaseSignin.
+func attemptSignin(ip string, now time.Time) time.Duration {
+	if lock := signinLockout.ip.Attempt(ip, now); lock > 0 {
+		return lock
+	}
+	if lock := signinLockout.global.Attempt("", now); lock > 0 {
+		signinLockout.ip.Release(ip)
+		return lock
+	}
+	return 0
+}
+
+// signinSucceeded сбрасывает неудачные попытки адреса ip и отменяет учёт удачной попытки во всех попытках входа
+func signinSucceeded(ip string) {
+	signinLockout.ip.Reset(ip)
+	signinLockout.global.Release("")
+}
+
+// releaseSignin отменяет учёт попытки входа с адреса ip, которая не была проверена
+func releaseSignin(ip string) {
+	signinLockout.ip.Release(ip)
+	signinLockout.global.Release("")
+}
+
+// intFromEnv возвращает неотрицательное число из переменной name или def, если переменная не задана
+func intFromEnv(name string, def int) (int, error) {
+	env := os.Getenv(name)
+	if len(env) == 0 {
+		return def, nil
+	}
+	n, err := strconv.Atoi(env)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("некорректное значение %s: %q", name, env)
+	}
+	return n, nil
+}
+
 // PostSigninHandler обрабатывает запросы к api/signin.
-// При корректном вводе пароля, возвращает JSON {"token":JWT}. В случае ошибки возвращает JSON {"error":error}
+// Принимает JSON {"login": string, "password": string}. Без login проверяется пароль TODO_PASSWORD,
+// и токены выдаются пользователю по умолчанию, которому принадлежат задачи без учётной записи.
+// После серии неудачных попыток с адреса клиента или со всех адресов вход блокируется, и сервер отвечает
+// статусом Too Many Requests с заголовком Retry-After.
+// При корректном вводе логина и пароля, возвращает JSON {"token": JWT, "refresh_token": JWT, "expires_in": int}.
+// token используется для доступа к api, refresh_token — для получения новой пары токенов через api/signin/refresh.
+// Токен доступа также устанавливается в cookie token вместе с CSRF токеном в cookie XSRF-TOKEN, см. auth.SetSessionCookies.
+// Если пользователь включил TOTP, вместо токенов возвращает JSON {"mfa_token": JWT, "expires_in": int},
+// и токены выдаются после проверки кода в api/signin/totp.
+// В случае ошибки возвращает JSON {"error":error}
 func PostSigninHandler(w http.ResponseWriter, r *http.Request) {
 	var buf bytes.Buffer
 	var err error
 	var body map[string]string
 	var password string
-	var signedToken string
+	var userID int64
+	var tokens auth.TokenPair
+	var challenge auth.MFAChallenge
 
 	write := func() {
 		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
@@ -32,10 +146,11 @@ func PostSigninHandler(w http.ResponseWriter, r *http.Request) {
 			writeErr(err, w)
 			return
 		} else {
-			tokenResp := map[string]string{
-				"token": signedToken,
+			if len(challenge.MFAToken) > 0 {
+				resp, err = json.Marshal(challenge)
+			} else {
+				resp, err = json.Marshal(tokens)
 			}
-			resp, err = json.Marshal(tokenResp)
 			if err != nil {
 				log.Println(err)
 			}
@@ -60,33 +175,219 @@ func PostSigninHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	if len(body["password"]) == 0 {
-		err = fmt.Errorf("пустая строка вместо password")
+		err = nd.NewValidationError("password", fmt.Errorf("пустая строка вместо password"))
 		write()
 		return
 	} else {
 		password = body["password"]
 	}
-	if password != targetPassword {
-		err = fmt.Errorf("неправильный пароль")
-		write()
+
+	// Адрес или весь вход заблокирован после серии неудачных попыток
+	ip := ratelimit.ClientIP(r)
+	now := time.Now()
+	if lock := attemptSignin(ip, now); lock > 0 {
+		ratelimit.WriteTooManyRequests(w, lock)
 		return
 	}
 
-	claims := jwt.MapClaims{
-		"password": sha256.Sum256([]byte(targetPassword)),
-		"Exp":      1550946689,
+	// Попытка входа, в том числе неудачная, записывается в журнал аудита учётной записи, в которую входят
+	if len(body["login"]) > 0 {
+		var user db.User
+		user, err = dbs.GetUserByLogin(r.Context(), body["login"])
+		switch {
+		case errors.Is(err, db.ErrUserNotFound):
+			auth.CheckMissingUser(password)
+			err = errUnauthorized
+		case err == nil:
+			db.AuditSourceFromContext(r.Context()).SetOwner(user.ID)
+			if !auth.CheckPassword(user.PasswordHash, password) {
+				err = errUnauthorized
+			}
+		}
+		userID = user.ID
+	} else {
+		db.AuditSourceFromContext(r.Context()).SetOwner(db.DefaultUserID)
+		if !auth.EqualPasswords(password, targetPassword) {
+			err = errUnauthorized
+		}
 	}
+	if err != nil {
+		// Неверный пароль остаётся учтённой неудачной попыткой
+		if !errors.Is(err, errUnauthorized) {
+			releaseSignin(ip)
+		}
+		write()
+		return
+	}
+	signinSucceeded(ip)
+	db.AuditSourceFromContext(r.Context()).SetUser(userID)
 
-	// создаём jwt и указываем алгоритм хеширования
-	jwtToken := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-
-	// получаем подписанный токен
-	signedToken, err = jwtToken.SignedString([]byte(targetPassword))
+	// Если включён TOTP, токены выдаются только после проверки кода в api/signin/totp
+	mfa, err := totpEnabled(r.Context(), userID)
 	if err != nil {
 		write()
 		return
 	}
+	if mfa {
+		challenge, err = auth.IssueMFAToken(userID, now)
+		write()
+		return
+	}
 
+	tokens, err = auth.IssueTokens(userID, now)
+	if err == nil {
+		err = auth.SetSessionCookies(w, tokens, now)
+	}
 	write()
 
+}
+
+// credentials описывает тело запроса к api/register
+type credentials struct {
+	Login    string `json:"login"`
+	Password string `json:"password"`
+}
+
+// PostRegisterHandler обрабатывает POST запросы к api/register.
+// Принимает JSON {"login": string, "password": string}, создаёт пользователя и возвращает статус Created
+// и пару токенов в том же формате и с теми же cookie, что и api/signin. Если логин занят, возвращает статус Conflict.
+// Пока регистрация не открыта переменной TODO_REGISTRATION, пользователей добавляют только вошедшие пользователи,
+// даже если пароль TODO_PASSWORD не задан. Их сессия при этом не меняется, и cookie нового пользователя не устанавливаются.
+func PostRegisterHandler(w http.ResponseWriter, r *http.Request) {
+	if openRegistration {
+		register(w, r)
+		return
+	}
+	auth.Auth(func(w http.ResponseWriter, r *http.Request) {
+		// Без пароля TODO_PASSWORD Auth пропускает запросы без токена, поэтому вход проверяется здесь.
+		// API токены выдаются для работы с задачами, а не для управления пользователями
+		if claims, ok := auth.ClaimsFromContext(r.Context()); !ok || claims.Type != auth.TokenAccess {
+			writeErr(errRegistrationClosed, w)
+			return
+		}
+		register(w, r)
+	})(w, r)
+}
+
+// register создаёт пользователя по запросу к api/register. Cookie сессии устанавливаются, только если запрос
+// выполнен без входа.
+func register(w http.ResponseWriter, r *http.Request) {
+	var req credentials
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		writeErr(err, w)
+		return
+	}
+	err = auth.ValidateCredentials(req.Login, req.Password)
+	if err != nil {
+		writeErr(err, w)
+		return
+	}
+	hash, err := auth.HashPassword(req.Password)
+	if err != nil {
+		writeErr(err, w)
+		return
+	}
+
+	now := time.Now()
+	userID, err := dbs.AddUser(r.Context(), req.Login, hash, now)
+	if errors.Is(err, db.ErrUserExists) {
+		// Попытка занять логин записывается в журнал аудита его владельца
+		if user, getErr := dbs.GetUserByLogin(r.Context(), req.Login); getErr == nil {
+			db.AuditSourceFromContext(r.Context()).SetOwner(user.ID)
+		}
+	}
+	if err != nil {
+		writeErr(err, w)
+		return
+	}
+	db.AuditSourceFromContext(r.Context()).SetUser(userID)
+	tokens, err := auth.IssueTokens(userID, now)
+	if _, ok := auth.ClaimsFromContext(r.Context()); err == nil && !ok {
+		err = auth.SetSessionCookies(w, tokens, now)
+	}
+	if err != nil {
+		writeErr(err, w)
+		return
+	}
+	writeJSON(w, http.StatusCreated, tokens)
+}
+
+// refreshRequest описывает тело запроса к api/signin/refresh и api/logout
+type refreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// PostRefreshHandler обрабатывает POST запросы к api/signin/refresh.
+// Принимает JSON {"refresh_token": JWT}, отзывает переданный токен обновления и возвращает новую пару токенов
+// в том же формате и с теми же cookie, что и api/signin.
+func PostRefreshHandler(w http.ResponseWriter, r *http.Request) {
+	var req refreshRequest
+	// Веб-клиент передаёт токен обновления в cookie, тогда тело запроса необязательно
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil && !errors.Is(err, io.EOF) {
+		writeErr(err, w)
+		return
+	}
+	if len(req.RefreshToken) == 0 {
+		req.RefreshToken, err = auth.RefreshTokenFromCookie(r)
+		if err != nil {
+			writeErr(err, w)
+			return
+		}
+	}
+	if len(req.RefreshToken) == 0 {
+		writeErr(nd.NewValidationError("refresh_token", errRefreshToken), w)
+		return
+	}
+	now := time.Now()
+	tokens, err := auth.Refresh(r.Context(), req.RefreshToken, now)
+	if err == nil {
+		err = auth.SetSessionCookies(w, tokens, now)
+	}
+	if err != nil {
+		writeErr(err, w)
+		return
+	}
+	writeJSON(w, http.StatusOK, tokens)
+}
+
+// PostLogoutHandler обрабатывает POST запросы к api/logout.
+// Отзывает токен доступа из cookie token или заголовка Authorization и токен обновления из необязательного
+// JSON {"refresh_token": JWT}, удаляет cookie сессии. Недействительные токены пропускаются.
+func PostLogoutHandler(w http.ResponseWriter, r *http.Request) {
+	var req refreshRequest
+	// Тело запроса необязательно
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil && !errors.Is(err, io.EOF) {
+		writeErr(err, w)
+		return
+	}
+	if cookie, err := r.Cookie(auth.RefreshCookie); err == nil && len(req.RefreshToken) == 0 {
+		req.RefreshToken = cookie.Value
+	}
+
+	now := time.Now()
+	for _, token := range []struct{ signed, typ string }{
+		{auth.TokenFromRequest(r), auth.TokenAccess},
+		{req.RefreshToken, auth.TokenRefresh},
+	} {
+		if len(token.signed) == 0 {
+			continue
+		}
+		claims, err := auth.ParseToken(r.Context(), token.signed, token.typ)
+		if errors.Is(err, auth.ErrInvalidToken) {
+			continue
+		}
+		if err == nil {
+			err = auth.Revoke(r.Context(), claims, now)
+		}
+		if err != nil {
+			writeErr(err, w)
+			return
+		}
+	}
+
+	auth.ClearSessionCookies(w)
+	writeEmptyJson(w)
 }
\ No newline at end of file
@@ -0,0 +1,90 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/AsyaBiryukova/go_final_project/internal/auth"
+	"github.com/AsyaBiryukova/go_final_project/internal/notify"
+)
+
+// skip.go содержит обработчики запросов к api/task/skip
+
+// TaskSkipHandler обрабатывает запросы к /api/task/skip.
+// POST пропускает текущее повторение задачи без отметки о выполнении, или с параметром date запоминает будущую дату,
+// на которую задача не будет назначена. GET возвращает JSON {"dates": []string} с пропускаемыми датами задачи.
+// DELETE с параметром date удаляет пропускаемую дату.
+func TaskSkipHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		getTaskSkips(w, r)
+	case http.MethodPost:
+		postTaskSkip(w, r)
+	case http.MethodDelete:
+		deleteTaskSkip(w, r)
+	default:
+		writeMethodNotAllowed(w, http.MethodGet, http.MethodPost, http.MethodDelete)
+	}
+}
+
+func getTaskSkips(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("id")
+	if !isID(id) {
+		writeErr(errInvalidID, w)
+		return
+	}
+	dates, err := userStorage(r.Context()).GetTaskExceptions(r.Context(), id)
+	if err != nil {
+		writeErr(err, w)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string][]string{"dates": dates})
+}
+
+// postTaskSkip возвращает JSON задачи после пропуска повторения
+func postTaskSkip(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	id := q.Get("id")
+	if !isID(id) {
+		writeErr(errInvalidID, w)
+		return
+	}
+	version, err := requireIfMatch(r)
+	if err != nil {
+		writeErr(err, w)
+		return
+	}
+	storage := userStorage(r.Context())
+	_, err = authorizeTask(r.Context(), storage, id, auth.ActionWrite)
+	if err != nil {
+		writeErr(err, w)
+		return
+	}
+	task, err := storage.SkipTask(r.Context(), id, version, q.Get("date"), time.Now())
+	if err != nil {
+		writeErr(err, w)
+		return
+	}
+	publish(r.Context(), notify.EventTaskUpdated, task)
+	w.Header().Set("ETag", etag(task.Version))
+	writeJSON(w, http.StatusOK, task)
+}
+
+func deleteTaskSkip(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	id := q.Get("id")
+	if !isID(id) {
+		writeErr(errInvalidID, w)
+		return
+	}
+	storage := userStorage(r.Context())
+	_, err := authorizeTask(r.Context(), storage, id, auth.ActionWrite)
+	if err == nil {
+		err = storage.DeleteTaskException(r.Context(), id, q.Get("date"))
+	}
+	if err != nil {
+		writeErr(err, w)
+		return
+	}
+	writeEmptyJson(w)
+}
@@ -0,0 +1,53 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/AsyaBiryukova/go_final_project/internal/auth"
+	"github.com/AsyaBiryukova/go_final_project/internal/db"
+	nd "github.com/AsyaBiryukova/go_final_project/internal/nextdate"
+	"github.com/AsyaBiryukova/go_final_project/internal/notify"
+)
+
+// PostTaskSnoozeHandler обрабатывает запросы к /api/task/snooze с методом POST.
+// Откладывает задачу с указанным id на дату until, не изменяя правило repeat. until может быть датой
+// или сокращением вида "1d", "2w", "next-week". Следующая отметка о выполнении вернёт задачу к исходному расписанию.
+// Возвращает JSON отложенной задачи, или JSON {"error": error} при возникновение ошибки.
+func PostTaskSnoozeHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	id := q.Get("id")
+	if !isID(id) {
+		writeErr(errInvalidID, w)
+		return
+	}
+	version, err := requireIfMatch(r)
+	if err != nil {
+		writeErr(err, w)
+		return
+	}
+
+	task, err := snoozeTask(r.Context(), id, version, q.Get("until"))
+	if err != nil {
+		writeErr(err, w)
+		return
+	}
+	publish(r.Context(), notify.EventTaskUpdated, task)
+	w.Header().Set("ETag", etag(task.Version))
+	writeJSON(w, http.StatusOK, task)
+}
+
+// snoozeTask разбирает until и откладывает задачу с указанным id
+func snoozeTask(ctx context.Context, id string, version int64, until string) (db.Task, error) {
+	date, err := nd.SnoozeDate(until, time.Now())
+	if err != nil {
+		return db.Task{}, err
+	}
+	storage := userStorage(ctx)
+	_, err = authorizeTask(ctx, storage, id, auth.ActionWrite)
+	if err != nil {
+		return db.Task{}, err
+	}
+	return storage.SnoozeTask(ctx, id, version, date)
+}
@@ -2,13 +2,16 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
-	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"strconv"
 
+	"github.com/AsyaBiryukova/go_final_project/internal/auth"
 	"github.com/AsyaBiryukova/go_final_project/internal/db"
+	"github.com/AsyaBiryukova/go_final_project/internal/notify"
 )
 
 // task.go содержит обработчики запросов к api/task
@@ -25,8 +28,12 @@ func TaskHandler(w http.ResponseWriter, r *http.Request) {
 		postTask(w, r)
 	case http.MethodPut:
 		putTask(w, r)
+	case http.MethodPatch:
+		patchTask(w, r)
 	case http.MethodDelete:
 		deleteTask(w, r)
+	default:
+		writeMethodNotAllowed(w, http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete)
 	}
 }
 
@@ -76,7 +83,18 @@ func postTask(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	id, err = dbs.AddTask(task)
+	storage := userStorage(r.Context())
+	err = authorizeList(r.Context(), storage, task.ListID, auth.ActionWrite)
+	if err != nil {
+		write()
+		return
+	}
+	id, err = storage.AddTask(r.Context(), task)
+	if err == nil {
+		task.ID = strconv.FormatInt(id, 10)
+		task.Version = 1
+		publish(r.Context(), notify.EventTaskCreated, task)
+	}
 	write()
 }
 
@@ -117,11 +135,95 @@ func putTask(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = dbs.PutTask(updatedTask)
+	// Задача обновится только если её не изменили после чтения, If-Match: * обновляет задачу без проверки версии
+	updatedTask.Version, err = requireIfMatch(r)
+	if err != nil {
+		write()
+		return
+	}
+
+	storage := userStorage(r.Context())
+	// Список задачи не изменяется при обновлении
+	updatedTask.ListID, err = authorizeTask(r.Context(), storage, updatedTask.ID, auth.ActionWrite)
+	if err != nil {
+		write()
+		return
+	}
+	var version int64
+	version, err = storage.PutTask(r.Context(), updatedTask)
+	if err == nil {
+		w.Header().Set("ETag", etag(version))
+		updatedTask.Version = version
+		updatedTask.SnoozedFrom = ""
+		publish(r.Context(), notify.EventTaskUpdated, updatedTask)
+	}
 	write()
 
 }
 
+// patchTask обрабатывает запрос к api/task?id= с методом PATCH.
+// Тело запроса в формате JSON Merge Patch изменяет только переданные поля задачи, null сбрасывает поле.
+// Возвращает пустой JSON {} или JSON {"error": error} в случае ошибки.
+func patchTask(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	id := q.Get("id")
+	if !isID(id) {
+		writeErr(errInvalidID, w)
+		return
+	}
+
+	version, err := requireIfMatch(r)
+	if err != nil {
+		writeErr(err, w)
+		return
+	}
+
+	task, err := applyTaskPatch(r.Context(), id, version, r.Body)
+	if err != nil {
+		writeErr(err, w)
+		return
+	}
+	w.Header().Set("ETag", etag(task.Version))
+	writeEmptyJson(w)
+}
+
+// applyTaskPatch читает из body изменения задачи в формате JSON Merge Patch и сохраняет изменившиеся поля.
+// Если version не равна 0, задача изменяется только если её версия не изменилась. Возвращает задачу после изменения.
+func applyTaskPatch(ctx context.Context, id string, version int64, body io.Reader) (db.Task, error) {
+	var patch db.TaskPatch
+	err := json.NewDecoder(body).Decode(&patch)
+	if err != nil {
+		return db.Task{}, err
+	}
+
+	storage := userStorage(ctx)
+	_, err = authorizeTask(ctx, storage, id, auth.ActionWrite)
+	if err != nil {
+		return db.Task{}, err
+	}
+	task, err := storage.GetTaskByID(ctx, id)
+	if err != nil {
+		return db.Task{}, err
+	}
+	if version != 0 && task.Version != version {
+		return db.Task{}, db.ErrVersionConflict
+	}
+	task, changed, err := task.ApplyPatch(patch)
+	if err != nil {
+		return db.Task{}, err
+	}
+	// Проверяем версию, прочитанную выше, чтобы не перезаписать изменения, сделанные после чтения
+	task.Version, err = storage.PatchTask(ctx, id, task.Version, changed)
+	if err != nil {
+		return db.Task{}, err
+	}
+	if _, ok := changed["date"]; ok {
+		task.SnoozedFrom = ""
+	}
+	publish(ctx, notify.EventTaskUpdated, task)
+	return task, nil
+}
+
 // GetTaskHandler обрабатывает запрос с методом GET.
 // Если пользователь авторизован, возвращает задачу с указанным ID.
 // Возвращает JSON {"task":Task}, или JSON {"error": error} при ошибке.
@@ -152,10 +254,15 @@ func getTask(w http.ResponseWriter, r *http.Request) {
 
 	q := r.URL.Query()
 	id := q.Get("id")
+	if !isID(id) {
+		err = errInvalidID
+		write()
+		return
+	}
 
-	task, err = dbs.GetTaskByID(id)
-	if err != nil {
-		log.Println(err)
+	task, err = userStorage(r.Context()).GetTaskByID(r.Context(), id)
+	if err == nil {
+		w.Header().Set("ETag", etag(task.Version))
 	}
 	write()
 
@@ -165,21 +272,29 @@ func getTask(w http.ResponseWriter, r *http.Request) {
 // Если пользователь авторизован и id существует, удаляет задачу.
 // При успешном выполнение возвращает пустой JSON {}. Иначе возвращает JSON {"error":error}.
 func deleteTask(w http.ResponseWriter, r *http.Request) {
-	var err error
-
 	q := r.URL.Query()
 	id := q.Get("id")
-	isID := isID(id)
-	if !isID {
-		writeErr(fmt.Errorf("некорректный формат id"), w)
+	if !isID(id) {
+		writeErr(errInvalidID, w)
 		return
 	}
 
-	err = dbs.DeleteTask(id)
+	version, err := requireIfMatch(r)
+	if err != nil {
+		writeErr(err, w)
+		return
+	}
+
+	storage := userStorage(r.Context())
+	listID, err := authorizeTask(r.Context(), storage, id, auth.ActionWrite)
+	if err == nil {
+		err = storage.DeleteTask(r.Context(), id, version)
+	}
 	if err != nil {
 		writeErr(err, w)
 		return
 	}
+	publish(r.Context(), notify.EventTaskDeleted, db.Task{ID: id, ListID: listID})
 	writeEmptyJson(w)
 
 }
@@ -1,52 +1,44 @@
 package api
 
 import (
-	"fmt"
 	"net/http"
 	"time"
 
-	nd "github.com/AsyaBiryukova/go_final_project/internal/nextdate"
+	"github.com/AsyaBiryukova/go_final_project/internal/auth"
+	"github.com/AsyaBiryukova/go_final_project/internal/notify"
 )
 
 // PostTaskDoneHandler обрабатывает запросы к /api/task/done с методом POST.
 // Если пользователь авторизован, удаляет задачи не имеющих правил повторения repeat, или обновляет дату выполнения задач, имеющих правило repeat.
 // Возвращает пустой JSON {} в случае успеха, или JSON {"error": error} при возникновение ошибки.
 func PostTaskDoneHandler(w http.ResponseWriter, r *http.Request) {
-	var err error
-
 	q := r.URL.Query()
 	id := q.Get("id")
-	isID := isID(id)
-	if !isID {
-		writeErr(fmt.Errorf("некорректный формат id"), w)
+	if !isID(id) {
+		writeErr(errInvalidID, w)
 		return
 	}
-	task, err := dbs.GetTaskByID(id)
+	version, err := requireIfMatch(r)
 	if err != nil {
 		writeErr(err, w)
 		return
 	}
-	if len(task.Repeat) == 0 {
-		err = dbs.DeleteTask(id)
-		if err != nil {
-			writeErr(err, w)
-			return
-		}
-		writeEmptyJson(w)
+
+	storage := userStorage(r.Context())
+	_, err = authorizeTask(r.Context(), storage, id, auth.ActionWrite)
+	if err != nil {
+		writeErr(err, w)
 		return
-	} else {
-		nextDate, err := nd.NextDate(time.Now(), task.Date, task.Repeat)
-		if err != nil {
-			writeErr(err, w)
-			return
-		}
-		task.Date = nextDate
 	}
-	err = dbs.PutTask(task)
+	task, deleted, err := storage.CompleteTask(r.Context(), id, version, time.Now())
 	if err != nil {
 		writeErr(err, w)
 		return
 	}
+	publish(r.Context(), notify.EventTaskCompleted, task)
+	if !deleted {
+		w.Header().Set("ETag", etag(task.Version))
+	}
 	writeEmptyJson(w)
 
 }
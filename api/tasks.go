@@ -1,6 +1,7 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
@@ -13,11 +14,11 @@ import (
 
 // GetTasksHandler обрабатывает запросы к /api/tasks с методом GET.
 // Если пользователь авторизован, возвращает JSON {"tasks": Task} содержащий последние добавленные задачи, или
-// последние добавленные задачи соответствующие поисковому запросу search. В случае ошибки возвращает JSON {"error": error}.
+// последние добавленные задачи соответствующие поисковому запросу search и сроку status (overdue, today или upcoming).
+// Параметр list ограничивает выборку задачами одного списка. В случае ошибки возвращает JSON {"error": error}.
 func GetTasksHandler(w http.ResponseWriter, r *http.Request) {
 	var tasks []db.Task
 	var err error
-	var date time.Time
 
 	// write отправляет клиенту ответ либо ошибку, в формате json
 	write := func() {
@@ -43,7 +44,7 @@ func GetTasksHandler(w http.ResponseWriter, r *http.Request) {
 			if err != nil {
 				log.Println(err)
 			}
-			w.WriteHeader(http.StatusCreated)
+			w.WriteHeader(http.StatusOK)
 			_, err = w.Write(resp)
 			if err != nil {
 				log.Println(err)
@@ -55,32 +56,38 @@ func GetTasksHandler(w http.ResponseWriter, r *http.Request) {
 	// Проверяем есть ли поисковой зарпос
 	q := r.URL.Query()
 	search := q.Get("search")
+	tasks, err = searchTasks(r.Context(), search, q.Get("status"), q.Get("list"))
+
+	if err != nil {
+		log.Println(err)
+	}
+
+	write()
+
+}
+
+// searchTasks возвращает последние добавленные задачи, или задачи соответствующие поисковому запросу search и сроку status.
+// Если указан listID, выбираются только задачи этого списка.
+// Поисковой запрос в формате 02.01.2006 ищет задачи на указанную дату, иначе ищет по заголовку и комментарию.
+func searchTasks(ctx context.Context, search, status, listID string) ([]db.Task, error) {
+	filter := db.TaskFilter{Status: status, ListID: listID}
+
 	// Проверяем может ли поисковой запрос содержать поиск по дате
 	isDate, _ := regexp.Match("[0-9]{2}.[0-9]{2}.[0-9]{4}", []byte(search))
 
 	switch {
 	case len(search) == 0:
-		tasks, err = dbs.GetTasksList()
 
 	case isDate:
-		date, err = time.Parse("02.01.2006", search)
+		date, err := time.Parse("02.01.2006", search)
 		if err == nil {
-			search = date.Format(dateFormat)
-			tasks, err = dbs.GetTasksList(search)
+			filter.Date = date.Format(dateFormat)
 			break
 		}
 		fallthrough
 
 	default:
-		search = fmt.Sprint("%" + search + "%")
-		tasks, err = dbs.GetTasksList(search)
-
+		filter.Search = fmt.Sprint("%" + search + "%")
 	}
-
-	if err != nil {
-		log.Println(err)
-	}
-
-	write()
-
+	return userStorage(ctx).GetTasksList(ctx, filter)
 }
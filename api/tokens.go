@@ -0,0 +1,119 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/AsyaBiryukova/go_final_project/internal/auth"
+	"github.com/AsyaBiryukova/go_final_project/internal/db"
+	nd "github.com/AsyaBiryukova/go_final_project/internal/nextdate"
+)
+
+// tokens.go содержит обработчики запросов к персональным API токенам api/tokens
+
+var (
+	errTokenName   = errors.New("не указано название токена")
+	errTokenScopes = errors.New("не указаны права токена")
+	errTokenScope  = errors.New("неизвестное право токена")
+)
+
+// TokensHandler обрабатывает запросы к /api/tokens.
+// GET возвращает JSON {"tokens": []APIToken} без самих токенов. POST с JSON {"name", "scopes"} создаёт токен
+// и возвращает его, токен показывается только один раз. DELETE с параметром id отзывает токен.
+// Управлять токенами можно только после входа по паролю, но не с помощью другого API токена.
+func TokensHandler(w http.ResponseWriter, r *http.Request) {
+	err := requireSession(r)
+	if err != nil {
+		writeErr(err, w)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		getTokens(w, r)
+	case http.MethodPost:
+		postToken(w, r)
+	case http.MethodDelete:
+		deleteToken(w, r)
+	default:
+		writeMethodNotAllowed(w, http.MethodGet, http.MethodPost, http.MethodDelete)
+	}
+}
+
+// requireSession возвращает db.ErrForbidden, если запрос r выполнен с API токеном, а не после входа по паролю
+func requireSession(r *http.Request) error {
+	if claims, ok := auth.ClaimsFromContext(r.Context()); ok && claims.Type == auth.TokenAPI {
+		return db.ErrForbidden
+	}
+	return nil
+}
+
+func getTokens(w http.ResponseWriter, r *http.Request) {
+	tokens, err := userStorage(r.Context()).GetAPITokens(r.Context())
+	if err != nil {
+		writeErr(err, w)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string][]db.APIToken{"tokens": tokens})
+}
+
+// postToken возвращает JSON созданного токена со статусом 201
+func postToken(w http.ResponseWriter, r *http.Request) {
+	var token db.APIToken
+	err := json.NewDecoder(r.Body).Decode(&token)
+	if err != nil {
+		writeErr(err, w)
+		return
+	}
+	err = validateToken(token)
+	if err != nil {
+		writeErr(err, w)
+		return
+	}
+	token.Token, err = auth.NewAPIToken()
+	if err != nil {
+		writeErr(err, w)
+		return
+	}
+
+	now := time.Now()
+	token.ID, err = userStorage(r.Context()).AddAPIToken(r.Context(), token, now)
+	if err != nil {
+		writeErr(err, w)
+		return
+	}
+	token.CreatedAt = now.UTC().Format(time.RFC3339)
+	writeJSON(w, http.StatusCreated, token)
+}
+
+func deleteToken(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("id")
+	if !isID(id) {
+		writeErr(errInvalidID, w)
+		return
+	}
+	err := userStorage(r.Context()).DeleteAPIToken(r.Context(), id)
+	if err != nil {
+		writeErr(err, w)
+		return
+	}
+	writeEmptyJson(w)
+}
+
+// validateToken проверяет, что у токена есть название, а права входят в список auth.Scopes.
+func validateToken(token db.APIToken) error {
+	if len(token.Name) == 0 {
+		return nd.NewValidationError("name", errTokenName)
+	}
+	if len(token.Scopes) == 0 {
+		return nd.NewValidationError("scopes", errTokenScopes)
+	}
+	for _, scope := range token.Scopes {
+		if !slices.Contains(auth.Scopes, scope) {
+			return nd.NewValidationError("scopes", errTokenScope)
+		}
+	}
+	return nil
+}
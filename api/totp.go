@@ -0,0 +1,262 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/AsyaBiryukova/go_final_project/internal/auth"
+	"github.com/AsyaBiryukova/go_final_project/internal/db"
+	nd "github.com/AsyaBiryukova/go_final_project/internal/nextdate"
+	"github.com/AsyaBiryukova/go_final_project/internal/ratelimit"
+)
+
+// totp.go содержит обработчики настройки TOTP api/totp и проверки второго фактора при входе api/signin/totp
+
+// totpDefaultAccount имя учётной записи в приложении-аутентификаторе для пользователя по умолчанию,
+// который входит по паролю TODO_PASSWORD без логина
+const totpDefaultAccount = "default"
+
+var (
+	errTOTPCode      = errors.New("неверный код подтверждения")
+	errTOTPCodeEmpty = errors.New("не указан код подтверждения")
+)
+
+// totpCode описывает тело запроса с кодом TOTP или кодом восстановления
+type totpCode struct {
+	Code string `json:"code"`
+}
+
+// totpSignin описывает тело запроса к api/signin/totp
+type totpSignin struct {
+	MFAToken string `json:"mfa_token"`
+	Code     string `json:"code"`
+}
+
+// totpEnrollment описывает ответ на начало настройки TOTP
+type totpEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+// TOTPHandler обрабатывает запросы к /api/totp.
+// POST создаёт новый секрет TOTP и возвращает JSON {"secret", "uri"}, где uri — адрес otpauth:// для
+// приложения-аутентификатора. Вход требует код только после подтверждения секрета в api/totp/confirm.
+// DELETE с JSON {"code"}, содержащим код TOTP или код восстановления, отключает TOTP.
+// Настраивать TOTP с помощью API токена нельзя.
+func TOTPHandler(w http.ResponseWriter, r *http.Request) {
+	err := requireSession(r)
+	if err != nil {
+		writeErr(err, w)
+		return
+	}
+	switch r.Method {
+	case http.MethodPost:
+		postTOTP(w, r)
+	case http.MethodDelete:
+		deleteTOTP(w, r)
+	default:
+		writeMethodNotAllowed(w, http.MethodPost, http.MethodDelete)
+	}
+}
+
+// postTOTP возвращает JSON нового секрета со статусом 201
+func postTOTP(w http.ResponseWriter, r *http.Request) {
+	storage := userStorage(r.Context())
+	account := totpDefaultAccount
+	user, err := storage.GetUser(r.Context())
+	switch {
+	case err == nil:
+		account = user.Login
+	case !errors.Is(err, db.ErrUserNotFound):
+		writeErr(err, w)
+		return
+	}
+
+	secret, err := auth.NewTOTPSecret()
+	if err != nil {
+		writeErr(err, w)
+		return
+	}
+	err = storage.SetTOTPSecret(r.Context(), secret, time.Now())
+	if err != nil {
+		writeErr(err, w)
+		return
+	}
+	writeJSON(w, http.StatusCreated, totpEnrollment{Secret: secret, URI: auth.TOTPURI(secret, account)})
+}
+
+func deleteTOTP(w http.ResponseWriter, r *http.Request) {
+	code, err := decodeTOTPCode(r)
+	if err != nil {
+		writeErr(err, w)
+		return
+	}
+	storage := userStorage(r.Context())
+	ok, err := checkSecondFactor(r.Context(), storage, code, time.Now())
+	if err != nil {
+		writeErr(err, w)
+		return
+	}
+	if !ok {
+		writeErr(nd.NewValidationError("code", errTOTPCode), w)
+		return
+	}
+	err = storage.DeleteTOTP(r.Context())
+	if err != nil {
+		writeErr(err, w)
+		return
+	}
+	writeEmptyJson(w)
+}
+
+// PostTOTPConfirmHandler обрабатывает POST запросы к /api/totp/confirm.
+// Принимает JSON {"code"} с кодом из приложения-аутентификатора, включает TOTP и возвращает
+// JSON {"recovery_codes": []string}. Коды восстановления показываются только один раз.
+func PostTOTPConfirmHandler(w http.ResponseWriter, r *http.Request) {
+	err := requireSession(r)
+	if err != nil {
+		writeErr(err, w)
+		return
+	}
+	code, err := decodeTOTPCode(r)
+	if err != nil {
+		writeErr(err, w)
+		return
+	}
+	storage := userStorage(r.Context())
+	totp, err := storage.GetTOTP(r.Context())
+	if err != nil {
+		writeErr(err, w)
+		return
+	}
+	if totp.Enabled {
+		writeErr(db.ErrTOTPEnabled, w)
+		return
+	}
+	step, ok := auth.CheckTOTP(totp.Secret, code, time.Now(), totp.LastStep)
+	if !ok {
+		writeErr(nd.NewValidationError("code", errTOTPCode), w)
+		return
+	}
+
+	codes, err := auth.NewRecoveryCodes()
+	if err != nil {
+		writeErr(err, w)
+		return
+	}
+	err = storage.EnableTOTP(r.Context(), step, codes)
+	if err != nil {
+		writeErr(err, w)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string][]string{"recovery_codes": codes})
+}
+
+// PostSigninTOTPHandler обрабатывает POST запросы к /api/signin/totp.
+// Принимает JSON {"mfa_token", "code"}, где mfa_token выдан api/signin после проверки пароля, а code — код TOTP
+// или код восстановления. Возвращает пару токенов в том же формате и с теми же cookie, что и api/signin. Неверные коды учитываются
+// вместе с неудачными попытками входа по паролю.
+func PostSigninTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	var req totpSignin
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		writeErr(err, w)
+		return
+	}
+	if len(req.Code) == 0 {
+		writeErr(nd.NewValidationError("code", errTOTPCodeEmpty), w)
+		return
+	}
+
+	ip := ratelimit.ClientIP(r)
+	now := time.Now()
+	if lock := attemptSignin(ip, now); lock > 0 {
+		ratelimit.WriteTooManyRequests(w, lock)
+		return
+	}
+	claims, err := auth.ParseToken(r.Context(), req.MFAToken, auth.TokenMFA)
+	if err != nil {
+		releaseSignin(ip)
+		writeErr(err, w)
+		return
+	}
+	userID, _ := claims.UserID()
+	db.AuditSourceFromContext(r.Context()).SetOwner(userID)
+	ok, err := checkSecondFactor(r.Context(), dbs.ForUser(userID), req.Code, now)
+	if err != nil {
+		releaseSignin(ip)
+		writeErr(err, w)
+		return
+	}
+	// Неверный код остаётся учтённой неудачной попыткой
+	if !ok {
+		writeErr(errTOTPCode, w)
+		return
+	}
+	signinSucceeded(ip)
+	db.AuditSourceFromContext(r.Context()).SetUser(userID)
+
+	// mfa_token обменивается на токены один раз
+	err = auth.Revoke(r.Context(), claims, now)
+	if err != nil {
+		writeErr(err, w)
+		return
+	}
+	tokens, err := auth.IssueTokens(userID, now)
+	if err == nil {
+		err = auth.SetSessionCookies(w, tokens, now)
+	}
+	if err != nil {
+		writeErr(err, w)
+		return
+	}
+	writeJSON(w, http.StatusOK, tokens)
+}
+
+// totpEnabled возвращает true, если пользователь userID включил TOTP и вход требует второго фактора
+func totpEnabled(ctx context.Context, userID int64) (bool, error) {
+	totp, err := dbs.ForUser(userID).GetTOTP(ctx)
+	if errors.Is(err, db.ErrTOTPNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return totp.Enabled, nil
+}
+
+// checkSecondFactor проверяет код TOTP или код восстановления code пользователя storage в момент now.
+// Принятый код TOTP и использованный код восстановления повторно не принимаются.
+func checkSecondFactor(ctx context.Context, storage *db.Storage, code string, now time.Time) (bool, error) {
+	totp, err := storage.GetTOTP(ctx)
+	if err != nil {
+		return false, err
+	}
+	if !totp.Enabled {
+		return false, db.ErrTOTPNotFound
+	}
+	if auth.IsTOTPCode(code) {
+		step, ok := auth.CheckTOTP(totp.Secret, code, now, totp.LastStep)
+		if !ok {
+			return false, nil
+		}
+		return storage.UseTOTPStep(ctx, step)
+	}
+	return storage.UseRecoveryCode(ctx, auth.NormalizeRecoveryCode(code))
+}
+
+// decodeTOTPCode возвращает код из тела запроса JSON {"code"}
+func decodeTOTPCode(r *http.Request) (string, error) {
+	var req totpCode
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		return "", err
+	}
+	if len(req.Code) == 0 {
+		return "", nd.NewValidationError("code", errTOTPCodeEmpty)
+	}
+	return req.Code, nil
+}
@@ -0,0 +1,268 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/AsyaBiryukova/go_final_project/internal/auth"
+	"github.com/AsyaBiryukova/go_final_project/internal/db"
+	"github.com/AsyaBiryukova/go_final_project/internal/notify"
+	"github.com/go-chi/chi/v5"
+)
+
+// v2.go содержит обработчики REST API /api/v2, где id задачи передаётся в пути запроса.
+// API v1 (api/task, api/tasks, api/task/done) работает поверх тех же функций и того же хранилища.
+
+// taskPath возвращает путь к задаче в API v2, используется в заголовке Location
+func taskPath(id string) string {
+	return fmt.Sprintf("/api/v2/tasks/%s", id)
+}
+
+// pathID возвращает id задачи из пути запроса, или ошибку если id некорректен
+func pathID(r *http.Request) (string, error) {
+	id := chi.URLParam(r, "id")
+	if !isID(id) {
+		return "", errInvalidID
+	}
+	return id, nil
+}
+
+// ListTasksV2Handler обрабатывает GET /api/v2/tasks.
+// Возвращает JSON {"tasks": []Task} с последними задачами или задачами, подходящими под поисковой запрос search и сроку status.
+// Параметр list ограничивает выборку задачами одного списка.
+func ListTasksV2Handler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	tasks, err := searchTasks(r.Context(), q.Get("search"), q.Get("status"), q.Get("list"))
+	if err != nil {
+		writeErr(err, w)
+		return
+	}
+	if tasks == nil {
+		tasks = []db.Task{}
+	}
+	writeJSON(w, http.StatusOK, map[string][]db.Task{"tasks": tasks})
+}
+
+// CreateTaskV2Handler обрабатывает POST /api/v2/tasks.
+// Добавляет задачу и возвращает её со статусом Created и заголовком Location.
+func CreateTaskV2Handler(w http.ResponseWriter, r *http.Request) {
+	var task db.Task
+	err := json.NewDecoder(r.Body).Decode(&task)
+	if err != nil {
+		writeErr(err, w)
+		return
+	}
+
+	// id задачи назначает база данных
+	task.ID = ""
+	task, err = task.FormatTask()
+	if err != nil {
+		writeErr(err, w)
+		return
+	}
+	storage := userStorage(r.Context())
+	err = authorizeList(r.Context(), storage, task.ListID, auth.ActionWrite)
+	if err != nil {
+		writeErr(err, w)
+		return
+	}
+	id, err := storage.AddTask(r.Context(), task)
+	if err != nil {
+		writeErr(err, w)
+		return
+	}
+	task.ID = strconv.FormatInt(id, 10)
+	task.Version = 1
+	publish(r.Context(), notify.EventTaskCreated, task)
+
+	w.Header().Set("Location", taskPath(task.ID))
+	w.Header().Set("ETag", etag(task.Version))
+	writeJSON(w, http.StatusCreated, task)
+}
+
+// GetTaskV2Handler обрабатывает GET /api/v2/tasks/{id} и возвращает задачу.
+func GetTaskV2Handler(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r)
+	if err != nil {
+		writeErr(err, w)
+		return
+	}
+	task, err := userStorage(r.Context()).GetTaskByID(r.Context(), id)
+	if err != nil {
+		writeErr(err, w)
+		return
+	}
+	w.Header().Set("ETag", etag(task.Version))
+	writeJSON(w, http.StatusOK, task)
+}
+
+// PutTaskV2Handler обрабатывает PUT /api/v2/tasks/{id}.
+// Требует заголовок If-Match с ETag задачи. Полностью заменяет поля задачи и возвращает обновлённую задачу.
+func PutTaskV2Handler(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r)
+	if err != nil {
+		writeErr(err, w)
+		return
+	}
+	version, err := requireIfMatch(r)
+	if err != nil {
+		writeErr(err, w)
+		return
+	}
+	var task db.Task
+	err = json.NewDecoder(r.Body).Decode(&task)
+	if err != nil {
+		writeErr(err, w)
+		return
+	}
+	task.ID = id
+
+	task, err = task.FormatTask()
+	if err != nil {
+		writeErr(err, w)
+		return
+	}
+	storage := userStorage(r.Context())
+	// Список задачи не изменяется при обновлении
+	task.ListID, err = authorizeTask(r.Context(), storage, id, auth.ActionWrite)
+	if err != nil {
+		writeErr(err, w)
+		return
+	}
+	task.Version = version
+	task.Version, err = storage.PutTask(r.Context(), task)
+	if err != nil {
+		writeErr(err, w)
+		return
+	}
+	task.SnoozedFrom = ""
+	publish(r.Context(), notify.EventTaskUpdated, task)
+	w.Header().Set("ETag", etag(task.Version))
+	writeJSON(w, http.StatusOK, task)
+}
+
+// PatchTaskV2Handler обрабатывает PATCH /api/v2/tasks/{id}.
+// Требует заголовок If-Match с ETag задачи. Тело запроса в формате JSON Merge Patch изменяет только
+// переданные поля задачи, null сбрасывает поле. Возвращает обновлённую задачу.
+func PatchTaskV2Handler(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r)
+	if err != nil {
+		writeErr(err, w)
+		return
+	}
+	version, err := requireIfMatch(r)
+	if err != nil {
+		writeErr(err, w)
+		return
+	}
+	task, err := applyTaskPatch(r.Context(), id, version, r.Body)
+	if err != nil {
+		writeErr(err, w)
+		return
+	}
+	w.Header().Set("ETag", etag(task.Version))
+	writeJSON(w, http.StatusOK, task)
+}
+
+// DeleteTaskV2Handler обрабатывает DELETE /api/v2/tasks/{id}. Требует заголовок If-Match с ETag задачи.
+// Возвращает статус No Content.
+func DeleteTaskV2Handler(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r)
+	if err != nil {
+		writeErr(err, w)
+		return
+	}
+	version, err := requireIfMatch(r)
+	if err != nil {
+		writeErr(err, w)
+		return
+	}
+	storage := userStorage(r.Context())
+	listID, err := authorizeTask(r.Context(), storage, id, auth.ActionWrite)
+	if err == nil {
+		err = storage.DeleteTask(r.Context(), id, version)
+	}
+	if err != nil {
+		writeErr(err, w)
+		return
+	}
+	publish(r.Context(), notify.EventTaskDeleted, db.Task{ID: id, ListID: listID})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// CompleteTaskV2Handler обрабатывает POST /api/v2/tasks/{id}/complete. Требует заголовок If-Match с ETag задачи.
+// Задачу с правилом repeat переносит на следующую дату и возвращает её, задачу без repeat удаляет и возвращает статус No Content.
+func CompleteTaskV2Handler(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r)
+	if err != nil {
+		writeErr(err, w)
+		return
+	}
+	version, err := requireIfMatch(r)
+	if err != nil {
+		writeErr(err, w)
+		return
+	}
+	storage := userStorage(r.Context())
+	_, err = authorizeTask(r.Context(), storage, id, auth.ActionWrite)
+	if err != nil {
+		writeErr(err, w)
+		return
+	}
+	task, deleted, err := storage.CompleteTask(r.Context(), id, version, time.Now())
+	if err != nil {
+		writeErr(err, w)
+		return
+	}
+	publish(r.Context(), notify.EventTaskCompleted, task)
+	if deleted {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	w.Header().Set("ETag", etag(task.Version))
+	writeJSON(w, http.StatusOK, task)
+}
+
+// SnoozeTaskV2Handler обрабатывает POST /api/v2/tasks/{id}/snooze?until=. Требует заголовок If-Match с ETag задачи.
+// Откладывает задачу на дату until, не изменяя правило repeat, и возвращает её.
+func SnoozeTaskV2Handler(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r)
+	if err != nil {
+		writeErr(err, w)
+		return
+	}
+	version, err := requireIfMatch(r)
+	if err != nil {
+		writeErr(err, w)
+		return
+	}
+	task, err := snoozeTask(r.Context(), id, version, r.URL.Query().Get("until"))
+	if err != nil {
+		writeErr(err, w)
+		return
+	}
+	publish(r.Context(), notify.EventTaskUpdated, task)
+	w.Header().Set("ETag", etag(task.Version))
+	writeJSON(w, http.StatusOK, task)
+}
+
+// MethodNotAllowedHandler отвечает ошибкой 405 с заголовком Allow, в котором перечислены методы,
+// зарегистрированные в роутере для пути запроса.
+func MethodNotAllowedHandler(w http.ResponseWriter, r *http.Request) {
+	var allowed []string
+	rctx := chi.RouteContext(r.Context())
+	if rctx != nil && rctx.Routes != nil {
+		// rctx.Routes указывает на корневой роутер, поэтому ищем по полному пути
+		path := r.URL.Path
+		methods := []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+		for _, method := range methods {
+			if rctx.Routes.Match(chi.NewRouteContext(), method, path) {
+				allowed = append(allowed, method)
+			}
+		}
+	}
+	writeMethodNotAllowed(w, allowed...)
+}
@@ -0,0 +1,141 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/AsyaBiryukova/go_final_project/internal/db"
+	nd "github.com/AsyaBiryukova/go_final_project/internal/nextdate"
+	"github.com/AsyaBiryukova/go_final_project/internal/webhook"
+)
+
+// webhooks.go содержит обработчики запросов к api/webhooks
+
+// deliveriesLimit ограничивает количество попыток доставки в ответе api/webhooks/deliveries
+const deliveriesLimit = 50
+
+var (
+	errWebhookURL    = errors.New("некорректный адрес webhook")
+	errWebhookEvents = errors.New("не указаны события webhook")
+	errWebhookEvent  = errors.New("неизвестное событие webhook")
+)
+
+// WebhooksHandler обрабатывает запросы к /api/webhooks.
+// GET возвращает JSON {"webhooks": []Webhook}. POST с JSON {"url", "events", "secret"} создаёт подписку
+// и возвращает её вместе с ключом подписи, если secret не указан, ключ создаётся случайно.
+// DELETE с параметром id удаляет подписку.
+// Управлять webhook можно только после входа по паролю, но не с помощью API токена.
+func WebhooksHandler(w http.ResponseWriter, r *http.Request) {
+	err := requireSession(r)
+	if err != nil {
+		writeErr(err, w)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		getWebhooks(w, r)
+	case http.MethodPost:
+		postWebhook(w, r)
+	case http.MethodDelete:
+		deleteWebhook(w, r)
+	default:
+		writeMethodNotAllowed(w, http.MethodGet, http.MethodPost, http.MethodDelete)
+	}
+}
+
+func getWebhooks(w http.ResponseWriter, r *http.Request) {
+	webhooks, err := userStorage(r.Context()).GetWebhooks(r.Context())
+	if err != nil {
+		writeErr(err, w)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string][]db.Webhook{"webhooks": webhooks})
+}
+
+// postWebhook возвращает JSON созданной подписки со статусом 201
+func postWebhook(w http.ResponseWriter, r *http.Request) {
+	var hook db.Webhook
+	err := json.NewDecoder(r.Body).Decode(&hook)
+	if err != nil {
+		writeErr(err, w)
+		return
+	}
+	err = validateWebhook(hook)
+	if err != nil {
+		writeErr(err, w)
+		return
+	}
+	if len(hook.Secret) == 0 {
+		hook.Secret, err = webhook.NewSecret()
+		if err != nil {
+			writeErr(err, w)
+			return
+		}
+	}
+
+	now := time.Now()
+	hook.ID, err = userStorage(r.Context()).AddWebhook(r.Context(), hook, now)
+	if err != nil {
+		writeErr(err, w)
+		return
+	}
+	hook.CreatedAt = now.UTC().Format(time.RFC3339)
+	writeJSON(w, http.StatusCreated, hook)
+}
+
+func deleteWebhook(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("id")
+	if !isID(id) {
+		writeErr(errInvalidID, w)
+		return
+	}
+	err := userStorage(r.Context()).DeleteWebhook(r.Context(), id)
+	if err != nil {
+		writeErr(err, w)
+		return
+	}
+	writeEmptyJson(w)
+}
+
+// validateWebhook проверяет, что адрес подписки является абсолютным http(s) адресом,
+// а события входят в список webhook.Events.
+func validateWebhook(hook db.Webhook) error {
+	u, err := url.Parse(hook.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || len(u.Host) == 0 {
+		return nd.NewValidationError("url", errWebhookURL)
+	}
+	if len(hook.Events) == 0 {
+		return nd.NewValidationError("events", errWebhookEvents)
+	}
+	for _, event := range hook.Events {
+		if !slices.Contains(webhook.Events, event) {
+			return nd.NewValidationError("events", errWebhookEvent)
+		}
+	}
+	return nil
+}
+
+// GetWebhookDeliveriesHandler обрабатывает GET запросы к /api/webhooks/deliveries.
+// Возвращает JSON {"deliveries": []Delivery} с последними попытками доставки на webhook с указанным id.
+func GetWebhookDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	err := requireSession(r)
+	if err != nil {
+		writeErr(err, w)
+		return
+	}
+	id := r.URL.Query().Get("id")
+	if !isID(id) {
+		writeErr(errInvalidID, w)
+		return
+	}
+	deliveries, err := userStorage(r.Context()).GetDeliveries(r.Context(), id, deliveriesLimit)
+	if err != nil {
+		writeErr(err, w)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string][]db.Delivery{"deliveries": deliveries})
+}
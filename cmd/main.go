@@ -1,20 +1,41 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/AsyaBiryukova/go_final_project/api"
 	"github.com/AsyaBiryukova/go_final_project/internal/auth"
 	"github.com/AsyaBiryukova/go_final_project/internal/db"
+	"github.com/AsyaBiryukova/go_final_project/internal/i18n"
+	"github.com/AsyaBiryukova/go_final_project/internal/notify"
+	"github.com/AsyaBiryukova/go_final_project/internal/ratelimit"
+	"github.com/AsyaBiryukova/go_final_project/internal/sse"
+	"github.com/AsyaBiryukova/go_final_project/internal/webhook"
+	"github.com/AsyaBiryukova/go_final_project/internal/worker"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/joho/godotenv"
 	_ "github.com/mattn/go-sqlite3"
 )
 
+// shutdownTimeout ограничивает время завершения обработки запросов при остановке сервера
+const shutdownTimeout = time.Second * 10
+
+// Частота запросов с одного адреса, если не заданы переменные TODO_API_RATE_LIMIT и TODO_AUTH_RATE_LIMIT.
+// Для входа и регистрации ограничение строже, чем для остального api.
+var (
+	defaultAPIRate  = ratelimit.Rate{Limit: 1200, Per: time.Minute}
+	defaultAuthRate = ratelimit.Rate{Limit: 30, Per: time.Minute}
+)
+
 func main() {
 	// Загружаем переменные среды
 	err := godotenv.Load(".env")
@@ -45,7 +66,69 @@ func main() {
 	if err != nil {
 		log.Fatal(err)
 	}
-	api.ApiInit(dbStorage)
+	err = auth.Init(&dbStorage)
+	if err != nil {
+		log.Fatal(err)
+	}
+	// События об изменении задач попадают в очередь доставки на webhook и в поток api/events
+	// каждого участника общего списка задачи или владельца личной задачи
+	hub := sse.NewHub(sse.DefaultHistory)
+	events := notify.NewMembers(&dbStorage, webhook.NewOutbox(&dbStorage))
+	streams := notify.NewMembers(&dbStorage, hub)
+	api.ApiInit(dbStorage, notify.Multi{events, streams}, hub)
+	err = api.SigninInit()
+	if err != nil {
+		log.Fatal(err)
+	}
+	apiRate, err := ratelimit.RateFromEnv("TODO_API_RATE_LIMIT", defaultAPIRate)
+	if err != nil {
+		log.Fatal(err)
+	}
+	authRate, err := ratelimit.RateFromEnv("TODO_AUTH_RATE_LIMIT", defaultAuthRate)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Фоновая обработка задач останавливается по сигналу завершения вместе с сервером
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	interval, err := worker.Interval()
+	if err != nil {
+		log.Fatal(err)
+	}
+	// Напоминания отправляются в журнал, на webhook, в поток api/events и по почте, если настроен SMTP сервер
+	notifiers := notify.Multi{notify.Log{}, events, streams}
+	smtpConfig, err := notify.SMTPConfigFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(smtpConfig.Addr) > 0 {
+		notifiers = append(notifiers, notify.NewSMTP(smtpConfig))
+	}
+	digestAt, digest, err := worker.DigestTime()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var bgWorker *worker.Worker
+	if interval > 0 {
+		bgWorker = worker.New(&dbStorage, notifiers, interval)
+		if digest {
+			bgWorker.SendDigestAt(digestAt)
+		}
+		bgWorker.Start(ctx)
+	}
+
+	webhookInterval, err := webhook.Interval()
+	if err != nil {
+		log.Fatal(err)
+	}
+	var dispatcher *webhook.Dispatcher
+	if webhookInterval > 0 {
+		dispatcher = webhook.NewDispatcher(&dbStorage, &http.Client{}, webhookInterval)
+		dispatcher.Start(ctx)
+	}
 
 	// Адрес для запуска сервера
 	ip := ""
@@ -54,20 +137,92 @@ func main() {
 
 	// Router
 	r := chi.NewRouter()
+	r.Use(i18n.Middleware)
+
+	r.Handle("/*", i18n.FileServer("./web"))
+
+	// Вход, регистрация и выпуск токенов ограничены отдельно от остального api.
+	// Журнал аудита только дополняется, поэтому в него записываются изменяющие запросы, прошедшие ограничение частоты
+	// и проверку запроса, чтобы поток некорректных запросов не заполнил журнал.
+	r.Group(func(r chi.Router) {
+		r.Use(ratelimit.NewLimiter(authRate).Middleware)
+		r.Use(api.ValidateRequest)
+		r.Use(api.AuditRequests)
+
+		r.Post("/api/signin", api.PostSigninHandler)
+		r.Post("/api/signin/totp", api.PostSigninTOTPHandler)
+		r.Post("/api/signin/refresh", api.PostRefreshHandler)
+		r.Post("/api/register", api.PostRegisterHandler)
+		r.Post("/api/logout", api.PostLogoutHandler)
+	})
 
-	r.Handle("/*", http.FileServer(http.Dir("./web")))
+	r.Group(func(r chi.Router) {
+		r.Use(ratelimit.NewLimiter(apiRate).Middleware)
+		r.Use(api.ValidateRequest)
+		r.Use(api.AuditRequests)
 
-	r.Get("/api/nextdate", api.GetNextDateHandler)
-	r.Get("/api/tasks", auth.Auth(api.GetTasksHandler))
-	r.Post("/api/task/done", auth.Auth(api.PostTaskDoneHandler))
-	r.Post("/api/signin", auth.Auth(api.PostSigninHandler))
-	r.Handle("/api/task", auth.Auth(api.TaskHandler))
+		r.Get("/api/openapi.json", api.GetOpenAPIHandler)
+		r.Get("/api/nextdate", api.GetNextDateHandler)
+		r.Get("/api/parse", api.GetParseHandler)
+		r.Get("/api/tasks", auth.Auth(api.GetTasksHandler))
+		r.Get("/api/events", auth.Auth(api.GetEventsHandler))
+		r.Post("/api/tasks/batch", auth.Auth(api.PostTasksBatchHandler))
+		r.Post("/api/task/done", auth.Auth(api.PostTaskDoneHandler))
+		r.Post("/api/task/snooze", auth.Auth(api.PostTaskSnoozeHandler))
+		r.Handle("/api/task/skip", auth.Auth(api.TaskSkipHandler))
+		r.Handle("/api/task", auth.Auth(api.TaskHandler))
+		r.Handle("/api/webhooks", auth.Auth(api.WebhooksHandler))
+		r.Get("/api/webhooks/deliveries", auth.Auth(api.GetWebhookDeliveriesHandler))
+		r.Handle("/api/tokens", auth.Auth(api.TokensHandler))
+		r.Handle("/api/totp", auth.Auth(api.TOTPHandler))
+		r.Post("/api/totp/confirm", auth.Auth(api.PostTOTPConfirmHandler))
+		r.Handle("/api/lists", auth.Auth(api.ListsHandler))
+		r.Handle("/api/lists/members", auth.Auth(api.MembersHandler))
+		r.Post("/api/lists/invites", auth.Auth(api.PostInviteHandler))
+		r.Post("/api/lists/join", auth.Auth(api.PostJoinHandler))
+		r.Get("/api/audit", auth.Auth(api.GetAuditHandler))
+
+		// REST API v2, id задачи передаётся в пути
+		r.Route("/api/v2", func(r chi.Router) {
+			r.Use(auth.Middleware)
+			r.MethodNotAllowed(api.MethodNotAllowedHandler)
+
+			r.Get("/tasks", api.ListTasksV2Handler)
+			r.Post("/tasks", api.CreateTaskV2Handler)
+			r.Get("/tasks/{id}", api.GetTaskV2Handler)
+			r.Put("/tasks/{id}", api.PutTaskV2Handler)
+			r.Patch("/tasks/{id}", api.PatchTaskV2Handler)
+			r.Delete("/tasks/{id}", api.DeleteTaskV2Handler)
+			r.Post("/tasks/{id}/complete", api.CompleteTaskV2Handler)
+			r.Post("/tasks/{id}/snooze", api.SnoozeTaskV2Handler)
+		})
+	})
 
 	// Запуск сервера
-	err = http.ListenAndServe(addr, r)
-	if err != nil {
+	server := &http.Server{Addr: addr, Handler: r}
+	// Shutdown ждёт завершения активных запросов, а потоки api/events сами не завершаются, поэтому закрываем подписки
+	server.RegisterOnShutdown(hub.Close)
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		err := server.Shutdown(shutdownCtx)
+		if err != nil {
+			log.Println(err)
+		}
+	}()
+
+	log.Printf("Server running on %s\n", port)
+	err = server.ListenAndServe()
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
 		log.Println(err)
 	}
-	log.Printf("Server running on %s\n", port)
 
+	stop()
+	if bgWorker != nil {
+		bgWorker.Wait()
+	}
+	if dispatcher != nil {
+		dispatcher.Wait()
+	}
 }
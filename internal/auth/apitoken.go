@@ -0,0 +1,90 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AsyaBiryukova/go_final_project/internal/db"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// apitoken.go содержит персональные API токены для скриптов и CLI
+
+// APITokenPrefix начало каждого API токена, по нему API токен отличается от JWT
+const APITokenPrefix = "todo_"
+
+// Права API токенов
+const (
+	// ScopeTasksRead разрешает запросы GET
+	ScopeTasksRead = "tasks:read"
+	// ScopeTasksWrite разрешает изменяющие запросы POST, PUT, PATCH и DELETE
+	ScopeTasksWrite = "tasks:write"
+)
+
+// Scopes содержит все права, которые можно выдать API токену
+var Scopes = []string{ScopeTasksRead, ScopeTasksWrite}
+
+// NewAPIToken возвращает новый случайный API токен с префиксом APITokenPrefix.
+func NewAPIToken() (string, error) {
+	token := make([]byte, 32)
+	_, err := rand.Read(token)
+	if err != nil {
+		return "", err
+	}
+	return APITokenPrefix + hex.EncodeToString(token), nil
+}
+
+// ParseAPIToken проверяет, что API токен token существует и не отозван, и отмечает время его использования now.
+// Возвращает содержимое токена в виде Claims с типом TokenAPI и правами токена или ErrInvalidToken.
+func ParseAPIToken(ctx context.Context, token string, now time.Time) (*Claims, error) {
+	if storage == nil {
+		return nil, ErrInvalidToken
+	}
+	id, userID, scopes, err := storage.UseAPIToken(ctx, token, now)
+	if errors.Is(err, db.ErrAPITokenNotFound) {
+		return nil, ErrInvalidToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Claims{
+		Type:   TokenAPI,
+		Scopes: scopes,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:      id,
+			Subject: strconv.FormatInt(userID, 10),
+		},
+	}, nil
+}
+
+// HasScope возвращает true, если токен даёт право scope. Токены доступа, выданные при входе, дают все права.
+func (c *Claims) HasScope(scope string) bool {
+	if c.Type != TokenAPI {
+		return true
+	}
+	return slices.Contains(c.Scopes, scope)
+}
+
+// requiredScope возвращает право, необходимое API токену для выполнения запроса r
+func requiredScope(r *http.Request) string {
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		return ScopeTasksRead
+	}
+	return ScopeTasksWrite
+}
+
+// authenticate проверяет API токен или токен доступа из запроса r
+func authenticate(r *http.Request) (*Claims, error) {
+	token := TokenFromRequest(r)
+	if strings.HasPrefix(token, APITokenPrefix) {
+		return ParseAPIToken(r.Context(), token, time.Now())
+	}
+	return ParseToken(r.Context(), token, TokenAccess)
+}
@@ -1,73 +1,99 @@
 package auth
 
 import (
-	"crypto/sha256"
-	"fmt"
+	"context"
+	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 	"os"
 
-	"github.com/golang-jwt/jwt/v5"
+	"github.com/AsyaBiryukova/go_final_project/internal/db"
+	"github.com/AsyaBiryukova/go_final_project/internal/i18n"
 )
 
 var (
 	pass string = os.Getenv("TODO_PASSWORD")
+
+	errUnauthorized = errors.New("требуется авторизация")
+	errScope        = errors.New("у токена нет нужного права")
 )
 
+// claimsKey ключ контекста запроса, по которому хранится содержимое проверенного токена
+type claimsKey struct{}
+
+// Auth проверяет токен доступа из cookie token или заголовка Authorization, если задан пароль TODO_PASSWORD.
+// В заголовке Authorization: Bearer также принимается API токен, запросы GET требуют у него право tasks:read,
+// остальные — tasks:write. Изменяющие запросы с токеном из cookie должны передавать CSRF токен в заголовке
+// X-XSRF-TOKEN. Содержимое токена передаётся обработчику в контексте запроса, его можно получить
+// через ClaimsFromContext, а пользователя — через UserID. Если пароль не задан, токен необязателен:
+// без действующего токена запрос выполняется от имени пользователя db.DefaultUserID.
 func Auth(next http.HandlerFunc) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, err := authenticate(r)
+		if err != nil && !errors.Is(err, ErrInvalidToken) {
+			log.Println(err)
+		}
 		// смотрим наличие пароля
-		if len(pass) > 0 {
-			err := getAndVerifyToken(r)
-			if err != nil {
-				// возвращаем ошибку авторизации 401
-				http.Error(w, "Authentification required", http.StatusUnauthorized)
-				return
-			}
+		if err != nil && len(pass) > 0 {
+			// возвращаем ошибку авторизации 401
+			writeAuthErr(w, http.StatusUnauthorized, "unauthorized", errUnauthorized)
+			return
+		}
+		// Токен из cookie действует для изменяющих запросов только вместе с CSRF токеном
+		if err == nil && fromCookie(r) && checkCSRF(r) != nil {
+			writeAuthErr(w, http.StatusForbidden, "forbidden", ErrCSRF)
+			return
+		}
+		if err == nil && !claims.HasScope(requiredScope(r)) {
+			writeAuthErr(w, http.StatusForbidden, "forbidden", errScope)
+			return
 		}
+		if err == nil {
+			r = r.WithContext(context.WithValue(r.Context(), claimsKey{}, claims))
+		}
+		db.AuditSourceFromContext(r.Context()).SetUser(UserID(r.Context()))
 		next(w, r)
 	})
 }
 
-// verifyToken проверяет токен на подлинность, возвращает true если токен корректен
-func verifyToken(signedToken string) bool {
-	passByte := []byte(pass)
-	passwordChecksum := sha256.Sum256(passByte)
+// Middleware работает как Auth, но имеет сигнатуру middleware для роутера chi.
+func Middleware(next http.Handler) http.Handler {
+	return Auth(next.ServeHTTP)
+}
 
-	jwtToken, err := jwt.Parse(signedToken, func(t *jwt.Token) (interface{}, error) {
-		return passByte, nil
-	})
-	if err != nil {
-		log.Printf("Failed to parse token: %s\n", err)
-	}
+// ClaimsFromContext возвращает содержимое токена, проверенного Auth. Если запрос выполнен без токена, возвращает false.
+func ClaimsFromContext(ctx context.Context) (*Claims, bool) {
+	claims, ok := ctx.Value(claimsKey{}).(*Claims)
+	return claims, ok
+}
 
-	claims, ok := jwtToken.Claims.(jwt.MapClaims)
+// UserID возвращает ID пользователя, выполняющего запрос, или db.DefaultUserID, если запрос выполнен без токена.
+func UserID(ctx context.Context) int64 {
+	claims, ok := ClaimsFromContext(ctx)
 	if !ok {
-		return false
+		return db.DefaultUserID
 	}
-
-	passRaw, ok := claims["password"]
-	if !ok {
-		return false
+	userID, err := claims.UserID()
+	if err != nil {
+		return db.DefaultUserID
 	}
-	// костыль чтобы лениво преобразовать jwt.Claims password и password из .env к одному типу :')
-	claimsPassChSm := fmt.Sprintf("%v", passRaw)
-	envPassChSm := fmt.Sprintf("%v", passwordChecksum)
-
-	return claimsPassChSm == envPassChSm
-
+	return userID
 }
 
-// getAndVerifyToken проверяет cookie на наличие токена авторизации, и проверяет его подлинность.
-// Возвращает ошибку, если токен не найден, или токен не прошёл проверку.
-func getAndVerifyToken(r *http.Request) error {
-	token, err := r.Cookie("token")
-
+// writeAuthErr пишет в response ошибку err с кодом code в формате JSON и статусом status
+func writeAuthErr(w http.ResponseWriter, status int, code string, err error) {
+	resp, err := json.Marshal(map[string]string{
+		"error": i18n.Err(i18n.FromResponse(w), err),
+		"code":  code,
+	})
 	if err != nil {
-		return err
+		log.Println(err)
 	}
-	if verifyToken(token.Value) {
-		return nil
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(status)
+	_, err = w.Write(resp)
+	if err != nil {
+		log.Println(err)
 	}
-	return fmt.Errorf("ошибка авторизации")
 }
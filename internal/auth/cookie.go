@@ -0,0 +1,121 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// cookie.go содержит cookie сессии веб-клиента и защиту от CSRF по схеме double-submit cookie
+
+const (
+	// TokenCookie cookie с токеном доступа веб-клиента, недоступна из JavaScript
+	TokenCookie = "token"
+	// CSRFCookie cookie с CSRF токеном, доступна из JavaScript. Клиент передаёт её значение в заголовке CSRFHeader.
+	// Имена совпадают с теми, что axios в web/ использует по умолчанию, поэтому веб-клиент передаёт заголовок сам.
+	CSRFCookie = "XSRF-TOKEN"
+	// CSRFHeader заголовок с CSRF токеном из cookie CSRFCookie
+	CSRFHeader = "X-XSRF-TOKEN"
+	// RefreshCookie cookie с токеном обновления веб-клиента, недоступна из JavaScript и передаётся только в api/signin
+	RefreshCookie = "refresh_token"
+	// refreshPath путь, для которого браузер передаёт cookie RefreshCookie
+	refreshPath = "/api/"
+)
+
+var (
+	// secureCookies добавляет cookie сессии атрибут Secure, cookie передаются только по HTTPS и на localhost
+	secureCookies = true
+
+	// ErrCSRF возвращается, если изменяющий запрос с cookie сессии не передал CSRF токен
+	ErrCSRF = errors.New("недействительный CSRF токен")
+)
+
+// SetSessionCookies устанавливает cookie TokenCookie с токеном доступа tokens и новый CSRF токен в cookie CSRFCookie,
+// которые действуют столько же, сколько токен доступа, и cookie RefreshCookie с токеном обновления.
+// Cookie не передаются в запросах с других сайтов.
+func SetSessionCookies(w http.ResponseWriter, tokens TokenPair, now time.Time) error {
+	csrf := make([]byte, 32)
+	_, err := rand.Read(csrf)
+	if err != nil {
+		return err
+	}
+	expires := now.Add(time.Duration(tokens.ExpiresIn) * time.Second)
+	http.SetCookie(w, sessionCookie(TokenCookie, tokens.AccessToken, expires, true))
+	http.SetCookie(w, sessionCookie(CSRFCookie, hex.EncodeToString(csrf), expires, false))
+	if len(tokens.RefreshToken) > 0 {
+		cookie := sessionCookie(RefreshCookie, tokens.RefreshToken, now.Add(refreshTTL), true)
+		cookie.Path = refreshPath
+		http.SetCookie(w, cookie)
+	}
+	return nil
+}
+
+// ClearSessionCookies удаляет cookie сессии веб-клиента.
+func ClearSessionCookies(w http.ResponseWriter) {
+	for _, cookie := range []*http.Cookie{
+		sessionCookie(TokenCookie, "", time.Unix(0, 0), true),
+		sessionCookie(CSRFCookie, "", time.Unix(0, 0), false),
+		sessionCookie(RefreshCookie, "", time.Unix(0, 0), true),
+	} {
+		if cookie.Name == RefreshCookie {
+			cookie.Path = refreshPath
+		}
+		cookie.MaxAge = -1
+		http.SetCookie(w, cookie)
+	}
+}
+
+// sessionCookie возвращает cookie сессии name со значением value и сроком действия expires
+func sessionCookie(name, value string, expires time.Time, httpOnly bool) *http.Cookie {
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		Expires:  expires,
+		MaxAge:   max(int(time.Until(expires).Seconds()), 0),
+		HttpOnly: httpOnly,
+		Secure:   secureCookies,
+		SameSite: http.SameSiteStrictMode,
+	}
+}
+
+// RefreshTokenFromCookie возвращает токен обновления из cookie RefreshCookie запроса r или пустую строку,
+// если cookie нет. Запрос с cookie должен передавать CSRF токен, иначе возвращается ErrCSRF.
+func RefreshTokenFromCookie(r *http.Request) (string, error) {
+	cookie, err := r.Cookie(RefreshCookie)
+	if err != nil || len(cookie.Value) == 0 {
+		return "", nil
+	}
+	err = checkCSRF(r)
+	if err != nil {
+		return "", err
+	}
+	return cookie.Value, nil
+}
+
+// fromCookie возвращает true, если токен запроса r передан в cookie, а не в заголовке Authorization.
+// Браузер добавляет cookie к запросам сам, поэтому только такие запросы нуждаются в защите от CSRF.
+func fromCookie(r *http.Request) bool {
+	return !strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ")
+}
+
+// checkCSRF проверяет, что изменяющий запрос r передаёт в заголовке CSRFHeader значение cookie CSRFCookie.
+// Сайт злоумышленника может отправить запрос с cookie пользователя, но не может прочитать её значение.
+func checkCSRF(r *http.Request) error {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return nil
+	}
+	cookie, err := r.Cookie(CSRFCookie)
+	if err != nil || len(cookie.Value) == 0 {
+		return ErrCSRF
+	}
+	if subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(r.Header.Get(CSRFHeader))) != 1 {
+		return ErrCSRF
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"regexp"
+	"sync"
+	"unicode/utf8"
+
+	nd "github.com/AsyaBiryukova/go_final_project/internal/nextdate"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// password.go содержит проверку логинов и хеширование паролей пользователей
+
+const (
+	// minPasswordLen минимальная длина пароля в символах
+	minPasswordLen = 8
+	// maxPasswordBytes максимальная длина пароля в байтах. bcrypt учитывает только первые 72 байта пароля,
+	// поэтому более длинные пароли не принимаются.
+	maxPasswordBytes = 72
+)
+
+// loginRe допустимый логин: от 3 до 32 латинских букв, цифр и символов _ . -
+var loginRe = regexp.MustCompile(`^[a-zA-Z0-9_.-]{3,32}$`)
+
+var (
+	errLogin         = errors.New("логин должен содержать от 3 до 32 латинских букв, цифр и символов _ . -")
+	errPasswordShort = errors.New("пароль должен содержать не меньше 8 символов")
+	errPasswordLong  = errors.New("пароль должен быть не длиннее 72 байт")
+)
+
+// ValidateCredentials проверяет логин и пароль нового пользователя. Возвращает ошибку валидации поля login или password.
+func ValidateCredentials(login, password string) error {
+	if !loginRe.MatchString(login) {
+		return nd.NewValidationError("login", errLogin)
+	}
+	if utf8.RuneCountInString(password) < minPasswordLen {
+		return nd.NewValidationError("password", errPasswordShort)
+	}
+	if len(password) > maxPasswordBytes {
+		return nd.NewValidationError("password", errPasswordLong)
+	}
+	return nil
+}
+
+// HashPassword возвращает хеш пароля bcrypt.
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// CheckPassword возвращает true, если пароль password соответствует хешу hash.
+func CheckPassword(hash, password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+// dummyHash хеш пароля, с которым сравнивается пароль при входе под несуществующим логином
+var dummyHash = sync.OnceValue(func() string {
+	hash, _ := HashPassword("несуществующий пользователь")
+	return hash
+})
+
+// CheckMissingUser тратит на проверку пароля несуществующего пользователя столько же времени, сколько CheckPassword,
+// чтобы по времени ответа нельзя было узнать, существует ли логин.
+func CheckMissingUser(password string) {
+	CheckPassword(dummyHash(), password)
+}
+
+// EqualPasswords сравнивает пароли за время, не зависящее от их содержимого и длины.
+func EqualPasswords(password, target string) bool {
+	a := sha256.Sum256([]byte(password))
+	b := sha256.Sum256([]byte(target))
+	return subtle.ConstantTimeCompare(a[:], b[:]) == 1
+}
@@ -0,0 +1,44 @@
+package auth
+
+import (
+	"github.com/AsyaBiryukova/go_final_project/internal/db"
+)
+
+// roles.go содержит права участников общих списков задач
+
+// Action действие с задачей или списком задач, доступ к которому зависит от роли пользователя
+type Action int
+
+const (
+	// ActionRead чтение задач и участников списка
+	ActionRead Action = iota
+	// ActionWrite добавление, изменение, выполнение и удаление задач
+	ActionWrite
+	// ActionManage управление участниками, приглашениями и удаление списка
+	ActionManage
+)
+
+// permissions содержит действия, разрешённые каждой роли
+var permissions = map[string][]Action{
+	db.RoleOwner:  {ActionRead, ActionWrite, ActionManage},
+	db.RoleEditor: {ActionRead, ActionWrite},
+	db.RoleViewer: {ActionRead},
+}
+
+// Can возвращает true, если роль role позволяет выполнить действие action.
+func Can(role string, action Action) bool {
+	for _, allowed := range permissions[role] {
+		if allowed == action {
+			return true
+		}
+	}
+	return false
+}
+
+// Authorize возвращает db.ErrForbidden, если роль role не позволяет выполнить действие action.
+func Authorize(role string, action Action) error {
+	if !Can(role, action) {
+		return db.ErrForbidden
+	}
+	return nil
+}
@@ -0,0 +1,236 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AsyaBiryukova/go_final_project/internal/db"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// token.go содержит выпуск, проверку и отзыв JWT
+
+// Типы токенов
+const (
+	// TokenAccess короткоживущий токен для доступа к api
+	TokenAccess = "access"
+	// TokenRefresh долгоживущий токен для получения новой пары токенов, используется один раз
+	TokenRefresh = "refresh"
+	// TokenMFA короткоживущий токен, подтверждающий пароль, который обменивается на пару токенов после проверки кода TOTP
+	TokenMFA = "mfa"
+	// TokenAPI персональный API токен, хранится в базе данных, а не в виде JWT
+	TokenAPI = "api"
+)
+
+const (
+	// defaultAccessTTL срок действия токена доступа, если не задана переменная TODO_ACCESS_TTL
+	defaultAccessTTL = time.Hour
+	// defaultRefreshTTL срок действия токена обновления, если не задана переменная TODO_REFRESH_TTL
+	defaultRefreshTTL = time.Hour * 24 * 30
+	// mfaTTL срок действия токена TokenMFA, за который нужно ввести код TOTP
+	mfaTTL = time.Minute * 5
+)
+
+// ErrInvalidToken возвращается, если токен не найден, подделан, просрочен или отозван.
+var ErrInvalidToken = errors.New("недействительный токен")
+
+var (
+	// secret ключ подписи JWT, не связан с паролем
+	secret []byte
+	// accessTTL и refreshTTL сроки действия токенов
+	accessTTL  = defaultAccessTTL
+	refreshTTL = defaultRefreshTTL
+	// storage хранит список отозванных токенов
+	storage *db.Storage
+)
+
+// Claims описывает содержимое JWT: стандартные поля sub, exp, iat, jti и тип токена typ.
+// sub содержит ID пользователя. Для API токена jti содержит ID токена, а Scopes — его права.
+type Claims struct {
+	Type   string   `json:"typ"`
+	Scopes []string `json:"-"`
+	jwt.RegisteredClaims
+}
+
+// UserID возвращает ID пользователя, которому выдан токен.
+func (c *Claims) UserID() (int64, error) {
+	return strconv.ParseInt(c.Subject, 10, 64)
+}
+
+// TokenPair описывает токены, выданные при входе или обновлении. ExpiresIn — срок действия токена доступа в секундах.
+type TokenPair struct {
+	AccessToken  string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"`
+}
+
+// MFAChallenge описывает ответ на вход с паролем пользователя, включившего TOTP. MFAToken обменивается
+// на пару токенов вместе с кодом TOTP или кодом восстановления. ExpiresIn — срок действия MFAToken в секундах.
+type MFAChallenge struct {
+	MFAToken  string `json:"mfa_token"`
+	ExpiresIn int64  `json:"expires_in"`
+}
+
+// Init инициализирует выпуск токенов: читает ключ подписи из переменной TODO_JWT_SECRET и сроки действия токенов
+// из TODO_ACCESS_TTL и TODO_REFRESH_TTL в формате time.ParseDuration. Значение false переменной TODO_COOKIE_SECURE
+// разрешает передавать cookie сессии без HTTPS. Отозванные токены хранятся в s.
+// Если ключ не задан, создаётся случайный ключ, и выданные токены перестают действовать после перезапуска.
+func Init(s *db.Storage) error {
+	storage = s
+
+	secret = []byte(os.Getenv("TODO_JWT_SECRET"))
+	if len(secret) == 0 {
+		secret = make([]byte, 32)
+		_, err := rand.Read(secret)
+		if err != nil {
+			return err
+		}
+		if len(pass) > 0 {
+			log.Println("не задана переменная TODO_JWT_SECRET, токены перестанут действовать после перезапуска")
+		}
+	}
+
+	var err error
+	if env := os.Getenv("TODO_COOKIE_SECURE"); len(env) > 0 {
+		secureCookies, err = strconv.ParseBool(env)
+		if err != nil {
+			return fmt.Errorf("некорректное значение TODO_COOKIE_SECURE: %q", env)
+		}
+	}
+	accessTTL, err = ttlFromEnv("TODO_ACCESS_TTL", defaultAccessTTL)
+	if err != nil {
+		return err
+	}
+	refreshTTL, err = ttlFromEnv("TODO_REFRESH_TTL", defaultRefreshTTL)
+	return err
+}
+
+// ttlFromEnv возвращает срок действия из переменной name или def, если переменная не задана
+func ttlFromEnv(name string, def time.Duration) (time.Duration, error) {
+	env := os.Getenv(name)
+	if len(env) == 0 {
+		return def, nil
+	}
+	ttl, err := time.ParseDuration(env)
+	if err != nil || ttl <= 0 {
+		return 0, fmt.Errorf("некорректное значение %s: %q", name, env)
+	}
+	return ttl, nil
+}
+
+// IssueTokens выпускает для пользователя userID новую пару из токена доступа и токена обновления.
+func IssueTokens(userID int64, now time.Time) (TokenPair, error) {
+	access, err := signToken(TokenAccess, userID, now, accessTTL)
+	if err != nil {
+		return TokenPair{}, err
+	}
+	refresh, err := signToken(TokenRefresh, userID, now, refreshTTL)
+	if err != nil {
+		return TokenPair{}, err
+	}
+	return TokenPair{AccessToken: access, RefreshToken: refresh, ExpiresIn: int64(accessTTL.Seconds())}, nil
+}
+
+// IssueMFAToken выпускает для пользователя userID, подтвердившего пароль, токен для проверки кода TOTP.
+func IssueMFAToken(userID int64, now time.Time) (MFAChallenge, error) {
+	token, err := signToken(TokenMFA, userID, now, mfaTTL)
+	if err != nil {
+		return MFAChallenge{}, err
+	}
+	return MFAChallenge{MFAToken: token, ExpiresIn: int64(mfaTTL.Seconds())}, nil
+}
+
+// signToken возвращает подписанный токен типа typ пользователя userID со сроком действия ttl и случайным jti
+func signToken(typ string, userID int64, now time.Time, ttl time.Duration) (string, error) {
+	jti := make([]byte, 16)
+	_, err := rand.Read(jti)
+	if err != nil {
+		return "", err
+	}
+	claims := Claims{
+		Type: typ,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        hex.EncodeToString(jti),
+			Subject:   strconv.FormatInt(userID, 10),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		},
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(secret)
+}
+
+// ParseToken проверяет подпись и срок действия токена signed, его тип typ и то, что токен не отозван.
+// Возвращает ErrInvalidToken, если токен не прошёл проверку.
+func ParseToken(ctx context.Context, signed string, typ string) (*Claims, error) {
+	var claims Claims
+	_, err := jwt.ParseWithClaims(signed, &claims, func(t *jwt.Token) (interface{}, error) {
+		return secret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired(), jwt.WithIssuedAt())
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	if claims.Type != typ || len(claims.ID) == 0 || claims.IssuedAt == nil {
+		return nil, ErrInvalidToken
+	}
+	if _, err = claims.UserID(); err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	if storage != nil {
+		revoked, err := storage.IsTokenRevoked(ctx, claims.ID)
+		if err != nil {
+			return nil, err
+		}
+		if revoked {
+			return nil, ErrInvalidToken
+		}
+	}
+	return &claims, nil
+}
+
+// Refresh проверяет токен обновления refreshToken, отзывает его и выпускает новую пару токенов для того же пользователя.
+// Каждый токен обновления можно использовать только один раз.
+func Refresh(ctx context.Context, refreshToken string, now time.Time) (TokenPair, error) {
+	claims, err := ParseToken(ctx, refreshToken, TokenRefresh)
+	if err != nil {
+		return TokenPair{}, err
+	}
+	revoked, err := storage.RevokeToken(ctx, claims.ID, claims.ExpiresAt.Time, now)
+	if err != nil {
+		return TokenPair{}, err
+	}
+	// Токен уже использован параллельным запросом
+	if !revoked {
+		return TokenPair{}, ErrInvalidToken
+	}
+	userID, _ := claims.UserID()
+	return IssueTokens(userID, now)
+}
+
+// Revoke отзывает токен с содержимым claims до истечения его срока действия.
+func Revoke(ctx context.Context, claims *Claims, now time.Time) error {
+	_, err := storage.RevokeToken(ctx, claims.ID, claims.ExpiresAt.Time, now)
+	return err
+}
+
+// TokenFromRequest возвращает токен доступа из заголовка Authorization: Bearer или из cookie token.
+func TokenFromRequest(r *http.Request) string {
+	header := r.Header.Get("Authorization")
+	if token, ok := strings.CutPrefix(header, "Bearer "); ok {
+		return strings.TrimSpace(token)
+	}
+	cookie, err := r.Cookie(TokenCookie)
+	if err != nil {
+		return ""
+	}
+	return cookie.Value
+}
@@ -0,0 +1,133 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// totp.go содержит одноразовые коды TOTP (RFC 6238) и коды восстановления для второго фактора входа
+
+const (
+	// totpPeriod период смены кода TOTP
+	totpPeriod = 30 * time.Second
+	// totpDigits количество цифр в коде TOTP
+	totpDigits = 6
+	// totpSkew количество соседних периодов, коды которых тоже принимаются, чтобы учесть расхождение часов
+	totpSkew = 1
+	// totpIssuer название сервиса в приложении-аутентификаторе
+	totpIssuer = "Планировщик задач"
+	// recoveryCodes количество кодов восстановления, выдаваемых при включении TOTP
+	recoveryCodes = 10
+)
+
+// base32NoPad кодировка секрета TOTP, которую понимают приложения-аутентификаторы
+var base32NoPad = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// NewTOTPSecret возвращает новый случайный секрет TOTP длиной 160 бит в кодировке base32 без дополнения.
+func NewTOTPSecret() (string, error) {
+	secret := make([]byte, 20)
+	_, err := rand.Read(secret)
+	if err != nil {
+		return "", err
+	}
+	return base32NoPad.EncodeToString(secret), nil
+}
+
+// TOTPURI возвращает адрес otpauth:// для добавления секрета secret учётной записи account в приложение-аутентификатор.
+func TOTPURI(secret, account string) string {
+	q := url.Values{}
+	q.Set("secret", secret)
+	q.Set("issuer", totpIssuer)
+	q.Set("algorithm", "SHA1")
+	q.Set("digits", fmt.Sprint(totpDigits))
+	q.Set("period", fmt.Sprint(int(totpPeriod.Seconds())))
+	u := url.URL{Scheme: "otpauth", Host: "totp", Path: "/" + totpIssuer + ":" + account, RawQuery: q.Encode()}
+	return u.String()
+}
+
+// TOTPStep возвращает номер периода TOTP, которому принадлежит момент now.
+func TOTPStep(now time.Time) int64 {
+	return now.Unix() / int64(totpPeriod.Seconds())
+}
+
+// TOTPCode возвращает код TOTP секрета secret для периода step.
+func TOTPCode(secret string, step int64) (string, error) {
+	key, err := base32NoPad.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", err
+	}
+	// HOTP (RFC 4226) от номера периода
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%06d", value%1000000), nil
+}
+
+// CheckTOTP проверяет код code секрета secret в момент now с допустимым расхождением часов в один период.
+// Коды периодов не позже lastStep уже использованы и не принимаются повторно.
+// Возвращает номер периода подошедшего кода или false.
+func CheckTOTP(secret, code string, now time.Time, lastStep int64) (int64, bool) {
+	if len(code) != totpDigits {
+		return 0, false
+	}
+	current := TOTPStep(now)
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if step <= lastStep {
+			continue
+		}
+		want, err := TOTPCode(secret, step)
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(want), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// IsTOTPCode возвращает true, если code похож на код TOTP, а не на код восстановления.
+func IsTOTPCode(code string) bool {
+	if len(code) != totpDigits {
+		return false
+	}
+	for _, c := range code {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// NewRecoveryCodes возвращает коды восстановления вида xxxx-xxxx-xxxx-xxxx. Каждый код позволяет войти один раз
+// без кода TOTP, например если телефон с приложением-аутентификатором потерян.
+func NewRecoveryCodes() ([]string, error) {
+	codes := make([]string, recoveryCodes)
+	for i := range codes {
+		raw := make([]byte, 10)
+		_, err := rand.Read(raw)
+		if err != nil {
+			return nil, err
+		}
+		code := strings.ToLower(base32NoPad.EncodeToString(raw))
+		codes[i] = code[0:4] + "-" + code[4:8] + "-" + code[8:12] + "-" + code[12:16]
+	}
+	return codes, nil
+}
+
+// NormalizeRecoveryCode приводит введённый код восстановления к виду, в котором он был выдан.
+func NormalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.TrimSpace(code))
+}
@@ -0,0 +1,240 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// audit.go содержит журнал аудита audit_log: запросы к api и изменения задач. Записи журнала нельзя изменить или удалить.
+
+// Действия, которые записываются в журнал аудита
+const (
+	// AuditRequest изменяющий запрос к api, включая вход и регистрацию
+	AuditRequest  = "request"
+	AuditCreate   = "create"
+	AuditUpdate   = "update"
+	AuditDelete   = "delete"
+	AuditComplete = "complete"
+	AuditSnooze   = "snooze"
+	AuditSkip     = "skip"
+	// AuditRoll перенос просроченной задачи фоновой обработкой
+	AuditRoll = "roll"
+)
+
+// AuditActions перечисляет действия журнала аудита
+var AuditActions = []string{AuditRequest, AuditCreate, AuditUpdate, AuditDelete, AuditComplete, AuditSnooze, AuditSkip, AuditRoll}
+
+// AuditChange описывает изменение одного поля задачи. Пустое значение Old означает, что поле появилось,
+// пустое New — что поле удалено.
+type AuditChange struct {
+	Old string `json:"old"`
+	New string `json:"new"`
+}
+
+// AuditEntry описывает запись журнала аудита. UserID — пользователь, выполнивший действие, или nil, если
+// пользователь неизвестен, например при неудачном входе или переносе задачи фоновой обработкой.
+// Changes содержит изменённые поля задачи по названиям из JSON задачи Task.
+type AuditEntry struct {
+	ID        string                 `json:"id"`
+	UserID    *int64                 `json:"user_id,omitempty"`
+	IP        string                 `json:"ip,omitempty"`
+	Method    string                 `json:"method,omitempty"`
+	Route     string                 `json:"route,omitempty"`
+	Action    string                 `json:"action"`
+	Status    int                    `json:"status,omitempty"`
+	TaskID    string                 `json:"task_id,omitempty"`
+	ListID    string                 `json:"list_id,omitempty"`
+	Changes   map[string]AuditChange `json:"changes,omitempty"`
+	CreatedAt string                 `json:"created_at"`
+}
+
+// AuditSource описывает запрос, в котором выполняются изменения. Middleware журнала аудита сохраняет его
+// в контексте запроса, и Storage добавляет его к записям об изменении задач.
+type AuditSource struct {
+	IP     string
+	Method string
+	Route  string
+	// UserID пользователь, выполняющий запрос. Задаётся после проверки токена или пароля
+	UserID *int64
+	// OwnerID учётная запись, к которой обращается запрос без пользователя, например вход по логину.
+	// Задаётся до проверки пароля, чтобы владелец учётной записи видел и неудачные попытки
+	OwnerID *int64
+}
+
+type auditSourceKey struct{}
+
+// WithAuditSource возвращает контекст с источником изменений source.
+func WithAuditSource(ctx context.Context, source *AuditSource) context.Context {
+	return context.WithValue(ctx, auditSourceKey{}, source)
+}
+
+// AuditSourceFromContext возвращает источник изменений из ctx или nil, если изменения выполняются вне запроса.
+func AuditSourceFromContext(ctx context.Context) *AuditSource {
+	source, _ := ctx.Value(auditSourceKey{}).(*AuditSource)
+	return source
+}
+
+// SetUser запоминает пользователя userID, выполняющего запрос. Ничего не делает, если source равен nil.
+func (source *AuditSource) SetUser(userID int64) {
+	if source != nil {
+		source.UserID = &userID
+	}
+}
+
+// SetOwner запоминает учётную запись ownerID, к которой обращается запрос. Ничего не делает, если source равен nil.
+func (source *AuditSource) SetOwner(ownerID int64) {
+	if source != nil {
+		source.OwnerID = &ownerID
+	}
+}
+
+// TaskChanges возвращает поля задачи, которые различаются в before и after. Для новой задачи before пустая,
+// для удалённой пустая after.
+func TaskChanges(before, after Task) map[string]AuditChange {
+	changes := map[string]AuditChange{}
+	for field, values := range map[string][2]string{
+		"date":         {before.Date, after.Date},
+		"title":        {before.Title, after.Title},
+		"comment":      {before.Comment, after.Comment},
+		"repeat":       {before.Repeat, after.Repeat},
+		"snoozed_from": {before.SnoozedFrom, after.SnoozedFrom},
+		"list_id":      {before.ListID, after.ListID},
+	} {
+		if values[0] != values[1] {
+			changes[field] = AuditChange{Old: values[0], New: values[1]}
+		}
+	}
+	return changes
+}
+
+// AddAuditEntry добавляет в журнал аудита запись entry о запросе с моментом now. Запись видна пользователю entry.UserID
+// и учётной записи ownerID, к которой обращался запрос. Если оба неизвестны, например при неудачном входе без логина
+// или регистрации, запись видна пользователю по умолчанию.
+func (dbHandl *Storage) AddAuditEntry(ctx context.Context, entry AuditEntry, ownerID *int64, now time.Time) error {
+	if ownerID == nil {
+		ownerID = entry.UserID
+	}
+	if ownerID == nil {
+		defaultID := DefaultUserID
+		ownerID = &defaultID
+	}
+	return dbHandl.insertAudit(ctx, entry, ownerID, now)
+}
+
+// auditTask записывает в журнал аудита действие action пользователя Storage над задачей: состояние до изменения before
+// и после изменения after.
+func (dbHandl *Storage) auditTask(ctx context.Context, action string, before, after Task) error {
+	task := before
+	if len(task.ID) == 0 {
+		task = after
+	}
+	return dbHandl.auditChanges(ctx, action, task, TaskChanges(before, after))
+}
+
+// auditChanges записывает в журнал аудита действие action пользователя Storage над задачей task с изменениями changes.
+// IP и адрес запроса берутся из источника изменений в ctx.
+func (dbHandl *Storage) auditChanges(ctx context.Context, action string, task Task, changes map[string]AuditChange) error {
+	entry := AuditEntry{Action: action, TaskID: task.ID, ListID: task.ListID, Changes: changes}
+	// Фоновая обработка изменяет задачи без пользователя
+	if dbHandl.userID != allUsers {
+		entry.UserID = &dbHandl.userID
+	}
+	if source := AuditSourceFromContext(ctx); source != nil {
+		entry.IP, entry.Method, entry.Route = source.IP, source.Method, source.Route
+	}
+	return dbHandl.insertAudit(ctx, entry, &task.UserID, time.Now())
+}
+
+// insertAudit добавляет запись entry в журнал аудита. ownerID — пользователь, чьи данные затронуты, запись видна ему,
+// пользователю entry.UserID и участникам списка entry.ListID.
+func (dbHandl *Storage) insertAudit(ctx context.Context, entry AuditEntry, ownerID *int64, now time.Time) error {
+	var changes string
+	if len(entry.Changes) > 0 {
+		data, err := json.Marshal(entry.Changes)
+		if err != nil {
+			return err
+		}
+		changes = string(data)
+	}
+
+	ctx, cancel := dbHandl.withTimeout(ctx)
+	defer cancel()
+
+	_, err := dbHandl.db.ExecContext(ctx, `INSERT INTO audit_log (user_id, owner_id, ip, method, route, action, status, task_id, list_id, changes, created_at)
+		VALUES (:user_id, :owner_id, :ip, :method, :route, :action, :status, NULLIF(:task_id, ''), NULLIF(:list_id, ''), :changes, :created_at)`,
+		sql.Named("user_id", entry.UserID), sql.Named("owner_id", ownerID), sql.Named("ip", entry.IP),
+		sql.Named("method", entry.Method), sql.Named("route", entry.Route), sql.Named("action", entry.Action),
+		sql.Named("status", entry.Status), sql.Named("task_id", entry.TaskID), sql.Named("list_id", entry.ListID),
+		sql.Named("changes", changes), sql.Named("created_at", now.UTC().Format(time.RFC3339)))
+	return wrapErr(err)
+}
+
+// AuditFilter описывает условия выборки журнала аудита в GetAuditLog. Пустые поля не ограничивают выборку.
+type AuditFilter struct {
+	TaskID string
+	Action string
+	// UserID пользователь, выполнивший действие
+	UserID string
+	// Since и Until ограничивают время записи, включительно, в формате RFC3339
+	Since string
+	Until string
+	// Limit наибольшее количество записей
+	Limit int
+}
+
+// GetAuditLog возвращает последние записи журнала аудита, подходящие под условия filter, начиная с новых.
+// Пользователю Storage видны его действия, изменения его задач и задач списков, в которых он состоит.
+func (dbHandl *Storage) GetAuditLog(ctx context.Context, filter AuditFilter) ([]AuditEntry, error) {
+	where := []string{"(owner_id = :user_id OR user_id = :user_id OR list_id IN (SELECT list_id FROM list_members WHERE user_id = :user_id))"}
+	args := []any{sql.Named("user_id", dbHandl.userID), sql.Named("limit", filter.Limit)}
+	for _, cond := range []struct {
+		query, name, value string
+	}{
+		{"task_id = :task_id", "task_id", filter.TaskID},
+		{"action = :action", "action", filter.Action},
+		{"user_id = :actor_id", "actor_id", filter.UserID},
+		{"created_at >= :since", "since", filter.Since},
+		{"created_at <= :until", "until", filter.Until},
+	} {
+		if len(cond.value) > 0 {
+			where = append(where, cond.query)
+			args = append(args, sql.Named(cond.name, cond.value))
+		}
+	}
+
+	ctx, cancel := dbHandl.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := dbHandl.db.QueryContext(ctx, `SELECT id, user_id, ip, method, route, action, status, IFNULL(task_id, ''), IFNULL(list_id, ''), changes, created_at
+		FROM audit_log WHERE `+strings.Join(where, " AND ")+" ORDER BY id DESC LIMIT :limit", args...)
+	if err != nil {
+		return nil, wrapErr(err)
+	}
+	defer rows.Close()
+
+	entries := []AuditEntry{}
+	for rows.Next() {
+		var entry AuditEntry
+		var userID sql.NullInt64
+		var changes string
+		err = rows.Scan(&entry.ID, &userID, &entry.IP, &entry.Method, &entry.Route, &entry.Action, &entry.Status,
+			&entry.TaskID, &entry.ListID, &changes, &entry.CreatedAt)
+		if err != nil {
+			return nil, wrapErr(err)
+		}
+		if userID.Valid {
+			entry.UserID = &userID.Int64
+		}
+		if len(changes) > 0 {
+			err = json.Unmarshal([]byte(changes), &entry.Changes)
+			if err != nil {
+				return nil, err
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries, wrapErr(rows.Err())
+}
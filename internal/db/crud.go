@@ -1,9 +1,12 @@
 package db
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"log"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -13,113 +16,376 @@ var (
 	rowsLimit = 15
 )
 
-// AddTask отправляет SQL запрос на добавление переданной задачи Task. Возвращает ID добавленной задачи и/или ошибку.
-func (dbHandl *Storage) AddTask(task Task) (int64, error) {
+// AddTask отправляет SQL запрос на добавление переданной задачи Task пользователю Storage.
+// Если у задачи указан список ListID, задача добавляется в список, и пользователь должен иметь в нём роль
+// RoleOwner или RoleEditor, иначе возвращается ErrForbidden. Добавление записывается в журнал аудита.
+// Возвращает ID добавленной задачи и/или ошибку.
+func (dbHandl *Storage) AddTask(ctx context.Context, task Task) (int64, error) {
 	var id int64
-	res, err := dbHandl.db.Exec("INSERT INTO scheduler (date, title, comment, repeat) VALUES (:date, :title, :comment, :repeat)",
+	err := dbHandl.WithTx(ctx, func(tx *Storage) error {
+		var err error
+		id, err = tx.addTask(ctx, task)
+		if err != nil {
+			return err
+		}
+		task.ID, task.UserID = strconv.FormatInt(id, 10), tx.userID
+		return tx.auditTask(ctx, AuditCreate, Task{}, task)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+// addTask добавляет задачу без записи в журнал аудита
+func (dbHandl *Storage) addTask(ctx context.Context, task Task) (int64, error) {
+	ctx, cancel := dbHandl.withTimeout(ctx)
+	defer cancel()
+
+	var id int64
+	res, err := dbHandl.db.ExecContext(ctx, "INSERT INTO scheduler (date, title, comment, repeat, user_id, list_id) SELECT :date, :title, :comment, :repeat, :user_id, NULLIF(:list_id, '') WHERE :list_id = '' OR "+writableList,
 		sql.Named("date", task.Date), sql.Named("title", task.Title),
-		sql.Named("comment", task.Comment), sql.Named("repeat", task.Repeat))
-	if err == nil {
-		id, _ = res.LastInsertId()
+		sql.Named("comment", task.Comment), sql.Named("repeat", task.Repeat), sql.Named("user_id", dbHandl.userID),
+		sql.Named("list_id", task.ListID))
+	if err != nil {
+		return 0, wrapErr(err)
+	}
+	affected, _ := res.RowsAffected()
+	if affected != 1 {
+		return 0, ErrForbidden
 	}
-	return id, err
+	id, _ = res.LastInsertId()
+	return id, nil
 }
 
-// GetTaskByID возвращает задачу Task с указанным ID, или ошибку.
-func (dbHandl *Storage) GetTaskByID(id string) (Task, error) {
+// taskColumns перечисляет столбцы scheduler в порядке полей, которые читает scanTask
+const taskColumns = "id, date, title, comment, repeat, version, snoozed_from, user_id, IFNULL(list_id, '')"
+
+// rowScanner общий интерфейс для *sql.Row и *sql.Rows
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanTask читает задачу Task из строки результата запроса, выбравшего столбцы taskColumns
+func scanTask(row rowScanner) (Task, error) {
 	var task Task
+	err := row.Scan(&task.ID, &task.Date, &task.Title, &task.Comment, &task.Repeat, &task.Version, &task.SnoozedFrom, &task.UserID, &task.ListID)
+	return task, err
+}
+
+// GetTaskByID возвращает задачу Task с указанным ID, или ошибку. Пользователь Storage может читать свои задачи
+// и задачи списков, в которых он состоит.
+func (dbHandl *Storage) GetTaskByID(ctx context.Context, id string) (Task, error) {
+	ctx, cancel := dbHandl.withTimeout(ctx)
+	defer cancel()
 
-	row := dbHandl.db.QueryRow("SELECT * FROM scheduler WHERE id = :id", sql.Named("id", id))
+	row := dbHandl.db.QueryRowContext(ctx, "SELECT "+taskColumns+" FROM scheduler WHERE id = :id AND "+readableTasks,
+		sql.Named("id", id), sql.Named("user_id", dbHandl.userID))
 
-	err := row.Scan(&task.ID, &task.Date, &task.Title, &task.Comment, &task.Repeat)
+	task, err := scanTask(row)
 	if err != nil {
 		log.Println(err)
-		return Task{}, err
+		return Task{}, wrapErr(err)
 	}
 	return task, nil
 
 }
 
-// PutTask отправляет SQL запрос на обновление задачи Task, возвращает ошибку в случае неудачи.
-func (dbHandl *Storage) PutTask(updateTask Task) error {
-	res, err := dbHandl.db.Exec("UPDATE scheduler SET date = :date, title = :title, comment = :comment, repeat = :repeat WHERE id = :id",
+// PutTask отправляет SQL запрос на обновление задачи Task.
+// Если у задачи указана версия Version, задача обновляется только если её версия в базе данных не изменилась.
+// Отметка об откладывании задачи сбрасывается. Изменённые поля записываются в журнал аудита.
+// Возвращает новую версию задачи, или ошибку в случае неудачи.
+func (dbHandl *Storage) PutTask(ctx context.Context, updateTask Task) (int64, error) {
+	var version int64
+	err := dbHandl.changeTask(ctx, AuditUpdate, updateTask.ID, func(tx *Storage) error {
+		var err error
+		version, err = tx.putTask(ctx, updateTask)
+		return err
+	})
+	return version, err
+}
+
+// putTask обновляет задачу без записи в журнал аудита
+func (dbHandl *Storage) putTask(ctx context.Context, updateTask Task) (int64, error) {
+	queryCtx, cancel := dbHandl.withTimeout(ctx)
+	defer cancel()
+
+	var version int64
+	row := dbHandl.db.QueryRowContext(queryCtx, "UPDATE scheduler SET date = :date, title = :title, comment = :comment, repeat = :repeat, snoozed_from = '', version = version + 1 WHERE id = :id AND "+writableTasks+" AND (:version = 0 OR version = :version) RETURNING version",
 		sql.Named("date", updateTask.Date),
 		sql.Named("title", updateTask.Title),
 		sql.Named("comment", updateTask.Comment),
 		sql.Named("repeat", updateTask.Repeat),
-		sql.Named("id", updateTask.ID))
+		sql.Named("id", updateTask.ID),
+		sql.Named("user_id", dbHandl.userID),
+		sql.Named("version", updateTask.Version))
+	err := row.Scan(&version)
 	if err != nil {
+		return 0, dbHandl.versionErr(ctx, updateTask.ID, err)
+	}
+	return version, nil
+}
+
+// PatchTask отправляет SQL запрос на обновление только переданных полей задачи с указанным ID.
+// Ключи columns должны быть названиями столбцов из patchColumns. Если version не равна 0, задача обновляется
+// только если её версия в базе данных не изменилась. Изменение даты сбрасывает отметку об откладывании задачи.
+// Изменённые поля записываются в журнал аудита. Возвращает новую версию задачи, или ошибку в случае неудачи.
+func (dbHandl *Storage) PatchTask(ctx context.Context, id string, version int64, columns map[string]string) (int64, error) {
+	var newVersion int64
+	err := dbHandl.changeTask(ctx, AuditUpdate, id, func(tx *Storage) error {
+		var err error
+		newVersion, err = tx.patchTask(ctx, id, version, columns)
 		return err
+	})
+	return newVersion, err
+}
+
+// patchTask обновляет поля задачи без записи в журнал аудита
+func (dbHandl *Storage) patchTask(ctx context.Context, id string, version int64, columns map[string]string) (int64, error) {
+	set := []string{"version = version + 1"}
+	args := []any{sql.Named("id", id), sql.Named("user_id", dbHandl.userID), sql.Named("version", version)}
+	// Обходим patchColumns, а не columns, чтобы в запрос попали только известные столбцы в постоянном порядке
+	for _, column := range patchColumns {
+		value, ok := columns[column]
+		if !ok {
+			continue
+		}
+		set = append(set, fmt.Sprintf("%s = :%s", column, column))
+		args = append(args, sql.Named(column, value))
 	}
-	if rowsAffected, _ := res.RowsAffected(); rowsAffected != 1 {
-		return fmt.Errorf("ошибка при обновление задачи")
+	if len(set) != len(columns)+1 {
+		return 0, fmt.Errorf("неизвестное поле задачи")
 	}
-	return nil
-}
+	if _, ok := columns["date"]; ok {
+		set = append(set, "snoozed_from = ''")
+	}
+
+	queryCtx, cancel := dbHandl.withTimeout(ctx)
+	defer cancel()
 
-// DeleteTask отправялет SQL запрос на удаление задачи с указанным ID. Возваращает ошибку в случае неудачи.
-func (dbHandl *Storage) DeleteTask(id string) error {
-	_, err := dbHandl.GetTaskByID(id)
+	var newVersion int64
+	row := dbHandl.db.QueryRowContext(queryCtx, "UPDATE scheduler SET "+strings.Join(set, ", ")+" WHERE id = :id AND "+writableTasks+" AND (:version = 0 OR version = :version) RETURNING version", args...)
+	err := row.Scan(&newVersion)
 	if err != nil {
-		return err
+		return 0, dbHandl.versionErr(ctx, id, err)
 	}
+	return newVersion, nil
+}
+
+// DeleteTask отправялет SQL запрос на удаление задачи с указанным ID.
+// Если version не равна 0, задача удаляется только если её версия в базе данных не изменилась.
+// Удалённая задача записывается в журнал аудита. Возваращает ошибку в случае неудачи.
+func (dbHandl *Storage) DeleteTask(ctx context.Context, id string, version int64) error {
+	return dbHandl.WithTx(ctx, func(tx *Storage) error {
+		before, err := tx.GetTaskByID(ctx, id)
+		if err != nil {
+			return err
+		}
+		err = tx.deleteTask(ctx, id, version)
+		if err != nil {
+			return err
+		}
+		return tx.auditTask(ctx, AuditDelete, before, Task{})
+	})
+}
+
+// deleteTask удаляет задачу без записи в журнал аудита
+func (dbHandl *Storage) deleteTask(ctx context.Context, id string, version int64) error {
+	queryCtx, cancel := dbHandl.withTimeout(ctx)
+	defer cancel()
 
-	res, err := dbHandl.db.Exec("DELETE FROM scheduler WHERE id= :id", sql.Named("id", id))
+	res, err := dbHandl.db.ExecContext(queryCtx, "DELETE FROM scheduler WHERE id = :id AND "+writableTasks+" AND (:version = 0 OR version = :version)",
+		sql.Named("id", id), sql.Named("user_id", dbHandl.userID), sql.Named("version", version))
 	if err != nil {
-		return err
+		return wrapErr(err)
 	}
 	affected, _ := res.RowsAffected()
 	if affected != 1 {
-		return fmt.Errorf("при удаление что-то пошло не так")
+		return dbHandl.versionErr(ctx, id, sql.ErrNoRows)
 	}
 	return nil
 }
 
-// GetTasksList возвращает послдение добавленные задачи []Task, либо последние добавленные задачи подходящие под поисковой запрос search при его наличие.
-// Возвращает ошибку, если что-то пошло не так
-func (dbHandl *Storage) GetTasksList(search ...string) ([]Task, error) {
-	var tasks []Task
-	var rows *sql.Rows
-	var err error
-
-	switch {
-	case len(search) == 0:
-		rows, err = dbHandl.db.Query("SELECT * FROM scheduler ORDER BY id LIMIT :limit", sql.Named("limit", rowsLimit))
+// CompleteTask отмечает задачу выполненной в одной транзакции и записывает выполнение в журнал completions:
+// задачу без правила repeat удаляет, задачу с правилом repeat переносит на следующую после now дату.
+// Если version не равна 0, задача изменяется только если её версия в базе данных не изменилась.
+// Выполнение записывается в журнал аудита. Возвращает задачу после переноса и true, если задача была удалена.
+func (dbHandl *Storage) CompleteTask(ctx context.Context, id string, version int64, now time.Time) (Task, bool, error) {
+	var task Task
+	var deleted bool
+	err := dbHandl.WithTx(ctx, func(tx *Storage) error {
+		var err error
+		task, err = tx.GetTaskByID(ctx, id)
 		if err != nil {
-			return []Task{}, err
+			return err
+		}
+		if version != 0 && task.Version != version {
+			return ErrVersionConflict
 		}
-	case len(search) > 0:
-		search := search[0]
-		_, err = time.Parse(DateFormat, search)
+		err = tx.logCompletion(ctx, task, now)
 		if err != nil {
-			rows, err = dbHandl.db.Query("SELECT * FROM scheduler WHERE title LIKE :search OR comment LIKE :search ORDER BY date LIMIT :limit",
-				sql.Named("search", search),
-				sql.Named("limit", rowsLimit))
+			return err
+		}
+		before := task
+		if len(task.Repeat) == 0 {
+			deleted = true
+			err = tx.deleteTask(ctx, id, task.Version)
 			if err != nil {
-				return []Task{}, err
+				return err
 			}
-			break
+			return tx.auditTask(ctx, AuditComplete, before, Task{})
+		}
+		task, err = tx.advanceTask(ctx, task, now)
+		if err != nil {
+			return err
+		}
+		return tx.auditTask(ctx, AuditComplete, before, task)
+	})
+	if err != nil {
+		return Task{}, false, err
+	}
+	return task, deleted, nil
+}
+
+// SnoozeTask откладывает задачу с указанным ID на дату date, не изменяя правило repeat.
+// Запоминает дату, с которой задача отложена впервые, чтобы CompleteTask продолжил исходное расписание.
+// Если version не равна 0, задача изменяется только если её версия в базе данных не изменилась.
+// Новая дата записывается в журнал аудита. Возвращает отложенную задачу, или ошибку в случае неудачи.
+func (dbHandl *Storage) SnoozeTask(ctx context.Context, id string, version int64, date string) (Task, error) {
+	var task Task
+	err := dbHandl.changeTask(ctx, AuditSnooze, id, func(tx *Storage) error {
+		var err error
+		task, err = tx.snoozeTask(ctx, id, version, date)
+		return err
+	})
+	return task, err
+}
+
+// snoozeTask откладывает задачу без записи в журнал аудита
+func (dbHandl *Storage) snoozeTask(ctx context.Context, id string, version int64, date string) (Task, error) {
+	queryCtx, cancel := dbHandl.withTimeout(ctx)
+	defer cancel()
+
+	row := dbHandl.db.QueryRowContext(queryCtx, "UPDATE scheduler SET snoozed_from = CASE WHEN snoozed_from = '' THEN date ELSE snoozed_from END, date = :date, version = version + 1 WHERE id = :id AND "+writableTasks+" AND (:version = 0 OR version = :version) RETURNING "+taskColumns,
+		sql.Named("date", date), sql.Named("id", id), sql.Named("user_id", dbHandl.userID), sql.Named("version", version))
+	task, err := scanTask(row)
+	if err != nil {
+		return Task{}, dbHandl.versionErr(ctx, id, err)
+	}
+	return task, nil
+}
+
+// changeTask изменяет задачу с указанным ID функцией fn в транзакции и записывает действие action
+// в журнал аудита вместе с полями задачи, которые изменила fn.
+func (dbHandl *Storage) changeTask(ctx context.Context, action string, id string, fn func(tx *Storage) error) error {
+	return dbHandl.WithTx(ctx, func(tx *Storage) error {
+		before, err := tx.GetTaskByID(ctx, id)
+		if err != nil {
+			return err
 		}
-		rows, err = dbHandl.db.Query("SELECT * FROM scheduler WHERE date = :date LIMIT :limit",
-			sql.Named("date", search),
-			sql.Named("limit", rowsLimit))
+		err = fn(tx)
 		if err != nil {
-			return []Task{}, err
+			return err
 		}
+		after, err := tx.GetTaskByID(ctx, id)
+		if err != nil {
+			return err
+		}
+		return tx.auditTask(ctx, action, before, after)
+	})
+}
+
+// versionErr уточняет ошибку изменения задачи: если задача существует, значит не совпала её версия
+// или пользователь может только читать задачу.
+func (dbHandl *Storage) versionErr(ctx context.Context, id string, err error) error {
+	if err != sql.ErrNoRows {
+		return wrapErr(err)
+	}
+	err = dbHandl.requireTaskWrite(ctx, id)
+	if err != nil {
+		return err
+	}
+	return ErrVersionConflict
+}
+
+// Сроки задач относительно текущей даты, по которым фильтрует TaskFilter.Status
+const (
+	StatusOverdue  = "overdue"
+	StatusToday    = "today"
+	StatusUpcoming = "upcoming"
+)
+
+// TaskFilter описывает условия выборки задач в GetTasksList. Пустые поля не ограничивают выборку.
+type TaskFilter struct {
+	// Search подстрока заголовка или комментария в формате LIKE
+	Search string
+	// Date дата задачи в формате DateFormat
+	Date string
+	// Status срок задачи: StatusOverdue, StatusToday или StatusUpcoming
+	Status string
+	// ListID ID списка задач. Без него выбираются личные задачи и задачи всех списков пользователя
+	ListID string
+}
+
+// GetTasksList возвращает послдение добавленные задачи []Task, либо задачи подходящие под условия filter.
+// У задач с прошедшей датой устанавливается признак Overdue. Возвращает ошибку, если что-то пошло не так
+func (dbHandl *Storage) GetTasksList(ctx context.Context, filter TaskFilter) ([]Task, error) {
+	ctx, cancel := dbHandl.withTimeout(ctx)
+	defer cancel()
+
+	// Даты сравниваются в формате sortableDate, в котором порядок строк совпадает с порядком дат
+	today := time.Now().Format(sortableDate)
+	where := []string{readableTasks}
+	args := []any{sql.Named("limit", rowsLimit), sql.Named("today", today), sql.Named("user_id", dbHandl.userID)}
+	order := "id"
+
+	if len(filter.Search) > 0 {
+		where = append(where, "(title LIKE :search OR comment LIKE :search)")
+		args = append(args, sql.Named("search", filter.Search))
+		order = "date_key(date)"
+	}
+	if len(filter.ListID) > 0 {
+		where = append(where, "list_id = :list_id")
+		args = append(args, sql.Named("list_id", filter.ListID))
+	}
+	if len(filter.Date) > 0 {
+		where = append(where, "date = :date")
+		args = append(args, sql.Named("date", filter.Date))
+	}
+	switch filter.Status {
+	case "":
+	case StatusOverdue:
+		where = append(where, "date_key(date) < :today")
+	case StatusToday:
+		where = append(where, "date_key(date) = :today")
+	case StatusUpcoming:
+		where = append(where, "date_key(date) > :today")
+	default:
+		return []Task{}, newValidationError("status", "неизвестный срок задачи")
+	}
+	if len(filter.Status) > 0 {
+		order = "date_key(date)"
 	}
 
+	var tasks []Task
+	rows, err := dbHandl.db.QueryContext(ctx, "SELECT "+taskColumns+" FROM scheduler WHERE "+strings.Join(where, " AND ")+" ORDER BY "+order+" LIMIT :limit", args...)
+	if err != nil {
+		return []Task{}, wrapErr(err)
+	}
 	defer rows.Close()
 
 	for rows.Next() {
-		task := Task{}
-
-		err := rows.Scan(&task.ID, &task.Date, &task.Title, &task.Comment, &task.Repeat)
+		task, err := scanTask(rows)
 		if err != nil {
 			log.Println(err)
-			return []Task{}, err
+			return []Task{}, wrapErr(err)
 		}
+		task.Overdue = dateKey(task.Date) < today
 		tasks = append(tasks, task)
 
 	}
+	if err = rows.Err(); err != nil {
+		return []Task{}, wrapErr(err)
+	}
 	return tasks, nil
 }
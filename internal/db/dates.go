@@ -0,0 +1,35 @@
+package db
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// dates.go содержит сравнение дат задач. Даты хранятся в формате TODO_DATEFORMAT, строки которого в общем случае
+// нельзя сравнивать напрямую, поэтому перед сравнением и сортировкой даты приводятся к формату sortableDate.
+
+// sortableDate формат дат, в котором порядок строк совпадает с порядком дат
+const sortableDate = "20060102"
+
+// driverName драйвер SQLite с функцией date_key для сравнения дат в запросах
+const driverName = "sqlite3_scheduler"
+
+func init() {
+	sql.Register(driverName, &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			return conn.RegisterFunc("date_key", dateKey, true)
+		},
+	})
+}
+
+// dateKey возвращает дату date в формате TODO_DATEFORMAT в формате sortableDate.
+// Если date не соответствует формату, возвращает её без изменений.
+func dateKey(date string) string {
+	t, err := time.Parse(DateFormat, date)
+	if err != nil {
+		return date
+	}
+	return t.Format(sortableDate)
+}
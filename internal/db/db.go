@@ -1,25 +1,41 @@
 package db
 
 import (
+	"context"
 	"database/sql"
+	"fmt"
 	"os"
 	"time"
-
-	_ "github.com/mattn/go-sqlite3"
 )
 
+// Storage выполняет запросы к базе данных. Внутри WithTx запросы выполняются в транзакции.
 type Storage struct {
-	db *sql.DB
+	conn    *sql.DB
+	db      queryer
+	timeout time.Duration
+	// userID владелец задач и подписок, к которым обращаются запросы. Задаётся через ForUser.
+	userID int64
+}
+
+// queryer общий интерфейс для *sql.DB и *sql.Tx
+type queryer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
 }
 
 const (
 	maxIdleConns    = 2
 	maxOpenConns    = 5
 	connMaxIdleTime = time.Minute * 5
+	// defaultQueryTimeout ограничивает время одного запроса, если не задана переменная TODO_DB_TIMEOUT
+	defaultQueryTimeout = time.Second * 5
 )
 
 var (
 	DateFormat string
+	// OverduePolicy определяет, что происходит с просроченными задачами с правилом repeat
+	OverduePolicy string
 )
 
 // DBExists проверяет существует ли файл переданный аргументом
@@ -37,8 +53,15 @@ func DbExists(dbFile string) bool {
 func StartDB() (Storage, error) {
 	dbFile := os.Getenv("TODO_DBFILE")
 	DateFormat = os.Getenv("TODO_DATEFORMAT")
+	policy, err := overduePolicy()
+	if err != nil {
+		return Storage{}, err
+	}
+	OverduePolicy = policy
 
-	db, err := sql.Open("sqlite3", dbFile)
+	// Транзакции сразу берут блокировку на запись, а конкурирующие запросы ждут её вместо ошибки database is locked
+	// Внешние ключи включены, чтобы исключения задачи удалялись вместе с ней
+	db, err := sql.Open(driverName, dbFile+"?_busy_timeout=5000&_txlock=immediate&_foreign_keys=on")
 	if err != nil {
 		return Storage{}, err
 	}
@@ -46,14 +69,46 @@ func StartDB() (Storage, error) {
 	db.SetMaxOpenConns(maxOpenConns)
 	db.SetConnMaxIdleTime(connMaxIdleTime)
 	dbStorage := Storage{}
+	dbStorage.conn = db
 	dbStorage.db = db
+	dbStorage.timeout, err = queryTimeout()
+	if err != nil {
+		return dbStorage, err
+	}
+
+	err = migrate(db)
+	if err != nil {
+		return dbStorage, err
+	}
 
 	return dbStorage, nil
 }
 
+// queryTimeout возвращает время ожидания одного запроса из переменной TODO_DB_TIMEOUT в формате time.ParseDuration,
+// например "3s" или "500ms". Значение 0 отключает ограничение.
+func queryTimeout() (time.Duration, error) {
+	env := os.Getenv("TODO_DB_TIMEOUT")
+	if len(env) == 0 {
+		return defaultQueryTimeout, nil
+	}
+	timeout, err := time.ParseDuration(env)
+	if err != nil {
+		return 0, fmt.Errorf("некорректное значение TODO_DB_TIMEOUT: %w", err)
+	}
+	return timeout, nil
+}
+
+// withTimeout возвращает контекст одного запроса, который отменяется вместе с ctx или по истечении времени ожидания запроса.
+func (dbHandl *Storage) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if dbHandl.timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, dbHandl.timeout)
+}
+
 // CloseDB закрывает подключение к базе данных.
 func (dbHandl *Storage) CloseDB() error {
-	db := dbHandl.db
+	db := dbHandl.conn
 	err := db.Close()
 	if err != nil {
 		return err
@@ -83,3 +138,181 @@ func InstallDB() error {
 
 	return nil
 }
+
+// columnMigrations содержит столбцы, добавленные в schema.sql после создания первых баз данных
+var columnMigrations = []struct {
+	table  string
+	column string
+	query  string
+}{
+	{"scheduler", "version", `ALTER TABLE scheduler ADD COLUMN version INTEGER NOT NULL DEFAULT 1`},
+	{"scheduler", "snoozed_from", `ALTER TABLE scheduler ADD COLUMN snoozed_from TEXT NOT NULL DEFAULT ''`},
+	{"scheduler", "user_id", `ALTER TABLE scheduler ADD COLUMN user_id INTEGER NOT NULL DEFAULT 0`},
+	{"webhooks", "user_id", `ALTER TABLE webhooks ADD COLUMN user_id INTEGER NOT NULL DEFAULT 0`},
+	{"scheduler", "list_id", `ALTER TABLE scheduler ADD COLUMN list_id INTEGER REFERENCES lists(id) ON DELETE CASCADE`},
+}
+
+// tableMigrations содержит таблицы, добавленные в schema.sql после создания первых баз данных
+var tableMigrations = []string{
+	`CREATE TABLE IF NOT EXISTS "completions" (
+		"id"	INTEGER,
+		"task_id"	INTEGER NOT NULL,
+		"date"	TEXT NOT NULL,
+		"completed_at"	TEXT NOT NULL,
+		PRIMARY KEY("id" AUTOINCREMENT)
+	)`,
+	`CREATE TABLE IF NOT EXISTS "task_exceptions" (
+		"task_id"	INTEGER NOT NULL REFERENCES "scheduler"("id") ON DELETE CASCADE,
+		"date"	TEXT NOT NULL,
+		PRIMARY KEY("task_id", "date")
+	)`,
+	`CREATE TABLE IF NOT EXISTS "reminders" (
+		"task_id"	INTEGER NOT NULL REFERENCES "scheduler"("id") ON DELETE CASCADE,
+		"date"	TEXT NOT NULL,
+		PRIMARY KEY("task_id", "date")
+	)`,
+	`CREATE TABLE IF NOT EXISTS "webhooks" (
+		"id"	INTEGER,
+		"url"	TEXT NOT NULL,
+		"secret"	TEXT NOT NULL,
+		"events"	TEXT NOT NULL,
+		"created_at"	TEXT NOT NULL,
+		PRIMARY KEY("id" AUTOINCREMENT)
+	)`,
+	`CREATE TABLE IF NOT EXISTS "webhook_outbox" (
+		"id"	INTEGER,
+		"webhook_id"	INTEGER NOT NULL REFERENCES "webhooks"("id") ON DELETE CASCADE,
+		"event"	TEXT NOT NULL,
+		"payload"	TEXT NOT NULL,
+		"status"	TEXT NOT NULL,
+		"attempts"	INTEGER NOT NULL DEFAULT 0,
+		"last_error"	TEXT NOT NULL DEFAULT "",
+		"next_attempt_at"	TEXT NOT NULL,
+		"created_at"	TEXT NOT NULL,
+		PRIMARY KEY("id" AUTOINCREMENT)
+	)`,
+	`CREATE TABLE IF NOT EXISTS "webhook_deliveries" (
+		"id"	INTEGER,
+		"outbox_id"	INTEGER NOT NULL,
+		"webhook_id"	INTEGER NOT NULL REFERENCES "webhooks"("id") ON DELETE CASCADE,
+		"event"	TEXT NOT NULL,
+		"attempt"	INTEGER NOT NULL,
+		"status_code"	INTEGER NOT NULL,
+		"error"	TEXT NOT NULL,
+		"status"	TEXT NOT NULL,
+		"created_at"	TEXT NOT NULL,
+		PRIMARY KEY("id" AUTOINCREMENT)
+	)`,
+	`CREATE INDEX IF NOT EXISTS "webhook_outbox_pending" ON "webhook_outbox" ("status", "next_attempt_at")`,
+	`CREATE TABLE IF NOT EXISTS "digests" (
+		"date"	TEXT NOT NULL,
+		PRIMARY KEY("date")
+	)`,
+	`CREATE TABLE IF NOT EXISTS "users" (
+		"id"	INTEGER,
+		"login"	TEXT NOT NULL UNIQUE COLLATE NOCASE,
+		"password_hash"	TEXT NOT NULL,
+		"created_at"	TEXT NOT NULL,
+		PRIMARY KEY("id" AUTOINCREMENT)
+	)`,
+	`CREATE TABLE IF NOT EXISTS "lists" (
+		"id"	INTEGER,
+		"name"	TEXT NOT NULL,
+		"created_at"	TEXT NOT NULL,
+		CHECK(length("name") > 0)
+		PRIMARY KEY("id" AUTOINCREMENT)
+	)`,
+	`CREATE TABLE IF NOT EXISTS "list_members" (
+		"list_id"	INTEGER NOT NULL REFERENCES "lists"("id") ON DELETE CASCADE,
+		"user_id"	INTEGER NOT NULL,
+		"role"	TEXT NOT NULL,
+		PRIMARY KEY("list_id", "user_id")
+	)`,
+	`CREATE TABLE IF NOT EXISTS "list_invites" (
+		"token_hash"	TEXT NOT NULL,
+		"list_id"	INTEGER NOT NULL REFERENCES "lists"("id") ON DELETE CASCADE,
+		"role"	TEXT NOT NULL,
+		"expires_at"	TEXT NOT NULL,
+		PRIMARY KEY("token_hash")
+	)`,
+	`CREATE TABLE IF NOT EXISTS "revoked_tokens" (
+		"jti"	TEXT NOT NULL,
+		"expires_at"	INTEGER NOT NULL,
+		PRIMARY KEY("jti")
+	)`,
+	`CREATE TABLE IF NOT EXISTS "api_tokens" (
+		"id"	INTEGER,
+		"user_id"	INTEGER NOT NULL,
+		"name"	TEXT NOT NULL,
+		"token_hash"	TEXT NOT NULL UNIQUE,
+		"scopes"	TEXT NOT NULL,
+		"created_at"	TEXT NOT NULL,
+		"last_used_at"	TEXT NOT NULL DEFAULT "",
+		PRIMARY KEY("id" AUTOINCREMENT)
+	)`,
+	`CREATE TABLE IF NOT EXISTS "totp" (
+		"user_id"	INTEGER NOT NULL,
+		"secret"	TEXT NOT NULL,
+		"enabled"	INTEGER NOT NULL DEFAULT 0,
+		"last_step"	INTEGER NOT NULL DEFAULT 0,
+		"created_at"	TEXT NOT NULL,
+		PRIMARY KEY("user_id")
+	)`,
+	`CREATE TABLE IF NOT EXISTS "recovery_codes" (
+		"user_id"	INTEGER NOT NULL,
+		"code_hash"	TEXT NOT NULL,
+		PRIMARY KEY("user_id", "code_hash")
+	)`,
+	`CREATE TABLE IF NOT EXISTS "audit_log" (
+		"id"	INTEGER,
+		"user_id"	INTEGER,
+		"owner_id"	INTEGER,
+		"ip"	TEXT NOT NULL,
+		"method"	TEXT NOT NULL,
+		"route"	TEXT NOT NULL,
+		"action"	TEXT NOT NULL,
+		"status"	INTEGER NOT NULL,
+		"task_id"	INTEGER,
+		"list_id"	INTEGER,
+		"changes"	TEXT NOT NULL,
+		"created_at"	TEXT NOT NULL,
+		PRIMARY KEY("id" AUTOINCREMENT)
+	)`,
+	`CREATE INDEX IF NOT EXISTS "audit_log_owner" ON "audit_log" ("owner_id", "id")`,
+	// Журнал аудита только дополняется
+	`CREATE TRIGGER IF NOT EXISTS "audit_log_no_update" BEFORE UPDATE ON "audit_log"
+	BEGIN
+		SELECT RAISE(ABORT, 'журнал аудита нельзя изменять');
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS "audit_log_no_delete" BEFORE DELETE ON "audit_log"
+	BEGIN
+		SELECT RAISE(ABORT, 'журнал аудита нельзя изменять');
+	END`,
+}
+
+// migrate добавляет в существующую базу данных таблицы и столбцы, которых в ней ещё нет.
+func migrate(db *sql.DB) error {
+	for _, query := range tableMigrations {
+		_, err := db.Exec(query)
+		if err != nil {
+			return err
+		}
+	}
+	for _, m := range columnMigrations {
+		var count int
+		row := db.QueryRow("SELECT count(*) FROM pragma_table_info(:table) WHERE name = :column",
+			sql.Named("table", m.table), sql.Named("column", m.column))
+		err := row.Scan(&count)
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			continue
+		}
+		_, err = db.Exec(m.query)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
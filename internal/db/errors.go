@@ -0,0 +1,53 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+
+	nd "github.com/AsyaBiryukova/go_final_project/internal/nextdate"
+	"github.com/mattn/go-sqlite3"
+)
+
+// errors.go содержит ошибки, которые возвращает пакет db
+
+var (
+	// ErrNotFound возвращается, если задача с указанным ID не существует.
+	ErrNotFound = errors.New("задача не найдена")
+	// ErrConflict возвращается, если изменение нарушает ограничения базы данных.
+	ErrConflict = errors.New("конфликт при изменении задачи")
+	// ErrVersionConflict возвращается, если задача была изменена после того, как её прочитали.
+	ErrVersionConflict = errors.New("задача была изменена после чтения")
+	// ErrTimeout возвращается, если запрос не выполнился за время TODO_DB_TIMEOUT.
+	ErrTimeout = errors.New("превышено время ожидания базы данных")
+	// ErrCanceled возвращается, если запрос отменён, например потому что клиент закрыл соединение.
+	ErrCanceled = errors.New("запрос отменён")
+)
+
+// ValidationError описывает некорректное значение поля задачи. Совпадает с ошибкой пакета nextdate,
+// чтобы обработчики могли проверять ошибки валидации одним типом.
+type ValidationError = nd.ValidationError
+
+// newValidationError возвращает ValidationError для поля field с сообщением msg.
+func newValidationError(field, msg string) error {
+	return nd.NewValidationError(field, errors.New(msg))
+}
+
+// wrapErr приводит ошибки драйвера базы данных к ошибкам пакета db.
+func wrapErr(err error) error {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return ErrNotFound
+	case errors.Is(err, context.DeadlineExceeded):
+		return ErrTimeout
+	case errors.Is(err, context.Canceled):
+		return ErrCanceled
+	}
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) && sqliteErr.Code == sqlite3.ErrConstraint {
+		log.Println(err)
+		return ErrConflict
+	}
+	return err
+}
@@ -0,0 +1,361 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// lists.go содержит общие списки задач, их участников и приглашения
+
+// Роли участников списка задач
+const (
+	// RoleOwner управляет участниками и приглашениями, может удалить список
+	RoleOwner = "owner"
+	// RoleEditor добавляет, изменяет и выполняет задачи списка
+	RoleEditor = "editor"
+	// RoleViewer только читает задачи списка
+	RoleViewer = "viewer"
+)
+
+// Roles перечисляет роли участников списка задач
+var Roles = []string{RoleOwner, RoleEditor, RoleViewer}
+
+// allUsers пользователь Storage, которому доступны задачи всех пользователей. Используется фоновой обработкой задач.
+const allUsers int64 = -1
+
+// readableTasks условие SQL для задач, которые может читать пользователь :user_id: его личные задачи
+// и задачи списков, в которых он состоит
+const readableTasks = "(:user_id = -1 OR list_id IS NULL AND user_id = :user_id OR list_id IN (SELECT list_id FROM list_members WHERE user_id = :user_id))"
+
+// writableTasks условие SQL для задач, которые может изменять пользователь :user_id: в списках нужна роль owner или editor
+const writableTasks = "(:user_id = -1 OR list_id IS NULL AND user_id = :user_id OR list_id IN (SELECT list_id FROM list_members WHERE user_id = :user_id AND role != 'viewer'))"
+
+// writableList условие SQL для списка :list_id, в который пользователь :user_id может добавлять задачи
+const writableList = ":list_id IN (SELECT list_id FROM list_members WHERE user_id = :user_id AND role != 'viewer')"
+
+var (
+	// ErrForbidden возвращается, если роль пользователя в списке задач не позволяет выполнить действие.
+	ErrForbidden = errors.New("недостаточно прав")
+	// ErrListNotFound возвращается, если список не существует или пользователь в нём не состоит.
+	ErrListNotFound = errors.New("список задач не найден")
+	// ErrMemberNotFound возвращается, если пользователь не состоит в списке задач.
+	ErrMemberNotFound = errors.New("участник списка не найден")
+	// ErrLastOwner возвращается, если изменение оставит список без владельца.
+	ErrLastOwner = errors.New("в списке должен остаться владелец")
+	// ErrInviteNotFound возвращается, если приглашение не существует, уже использовано или истекло.
+	ErrInviteNotFound = errors.New("приглашение не найдено или истекло")
+)
+
+// List описывает общий список задач. Role — роль пользователя Storage в списке.
+type List struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Role      string `json:"role"`
+	CreatedAt string `json:"created_at"`
+}
+
+// Member описывает участника списка задач
+type Member struct {
+	UserID int64  `json:"user_id"`
+	Login  string `json:"login"`
+	Role   string `json:"role"`
+}
+
+// AddList создаёт список задач с названием name, пользователь Storage становится его владельцем.
+// Возвращает ID списка.
+func (dbHandl *Storage) AddList(ctx context.Context, name string, now time.Time) (string, error) {
+	var id string
+	err := dbHandl.WithTx(ctx, func(tx *Storage) error {
+		queryCtx, cancel := tx.withTimeout(ctx)
+		defer cancel()
+
+		err := tx.db.QueryRowContext(queryCtx, "INSERT INTO lists (name, created_at) VALUES (:name, :created_at) RETURNING id",
+			sql.Named("name", name), sql.Named("created_at", now.UTC().Format(time.RFC3339))).Scan(&id)
+		if err != nil {
+			return wrapErr(err)
+		}
+		_, err = tx.db.ExecContext(queryCtx, "INSERT INTO list_members (list_id, user_id, role) VALUES (:list_id, :user_id, :role)",
+			sql.Named("list_id", id), sql.Named("user_id", tx.userID), sql.Named("role", RoleOwner))
+		return wrapErr(err)
+	})
+	if err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// GetLists возвращает списки задач, в которых состоит пользователь Storage.
+func (dbHandl *Storage) GetLists(ctx context.Context) ([]List, error) {
+	ctx, cancel := dbHandl.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := dbHandl.db.QueryContext(ctx, `SELECT l.id, l.name, m.role, l.created_at FROM lists l
+		JOIN list_members m ON m.list_id = l.id WHERE m.user_id = :user_id ORDER BY l.id`,
+		sql.Named("user_id", dbHandl.userID))
+	if err != nil {
+		return nil, wrapErr(err)
+	}
+	defer rows.Close()
+
+	lists := []List{}
+	for rows.Next() {
+		var list List
+		err = rows.Scan(&list.ID, &list.Name, &list.Role, &list.CreatedAt)
+		if err != nil {
+			return nil, wrapErr(err)
+		}
+		lists = append(lists, list)
+	}
+	return lists, wrapErr(rows.Err())
+}
+
+// DeleteList удаляет список задач вместе с его задачами, участниками и приглашениями.
+// Удалить список может только его владелец.
+func (dbHandl *Storage) DeleteList(ctx context.Context, id string) error {
+	return dbHandl.WithTx(ctx, func(tx *Storage) error {
+		err := tx.requireRole(ctx, id, RoleOwner)
+		if err != nil {
+			return err
+		}
+		queryCtx, cancel := tx.withTimeout(ctx)
+		defer cancel()
+		_, err = tx.db.ExecContext(queryCtx, "DELETE FROM lists WHERE id = :id", sql.Named("id", id))
+		return wrapErr(err)
+	})
+}
+
+// ListRole возвращает роль пользователя Storage в списке задач с указанным ID или ErrListNotFound,
+// если пользователь в нём не состоит.
+func (dbHandl *Storage) ListRole(ctx context.Context, listID string) (string, error) {
+	ctx, cancel := dbHandl.withTimeout(ctx)
+	defer cancel()
+
+	var role string
+	err := dbHandl.db.QueryRowContext(ctx, "SELECT role FROM list_members WHERE list_id = :list_id AND user_id = :user_id",
+		sql.Named("list_id", listID), sql.Named("user_id", dbHandl.userID)).Scan(&role)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrListNotFound
+	}
+	if err != nil {
+		return "", wrapErr(err)
+	}
+	return role, nil
+}
+
+// TaskRole возвращает ID списка задачи с указанным ID и роль в нём пользователя Storage. Для личной задачи
+// возвращает пустой ID списка и RoleOwner. Возвращает ErrNotFound, если пользователь не может читать задачу.
+func (dbHandl *Storage) TaskRole(ctx context.Context, id string) (listID string, role string, err error) {
+	ctx, cancel := dbHandl.withTimeout(ctx)
+	defer cancel()
+
+	err = dbHandl.db.QueryRowContext(ctx, `SELECT IFNULL(s.list_id, ''), IFNULL(m.role, :owner) FROM scheduler s
+		LEFT JOIN list_members m ON m.list_id = s.list_id AND m.user_id = :user_id
+		WHERE s.id = :id AND (s.list_id IS NULL AND s.user_id = :user_id OR m.role IS NOT NULL)`,
+		sql.Named("id", id), sql.Named("user_id", dbHandl.userID), sql.Named("owner", RoleOwner)).Scan(&listID, &role)
+	if err != nil {
+		return "", "", wrapErr(err)
+	}
+	return listID, role, nil
+}
+
+// requireTaskWrite возвращает ErrForbidden, если пользователь Storage может только читать задачу с указанным ID
+func (dbHandl *Storage) requireTaskWrite(ctx context.Context, id string) error {
+	_, role, err := dbHandl.TaskRole(ctx, id)
+	if err != nil {
+		return err
+	}
+	if role == RoleViewer {
+		return ErrForbidden
+	}
+	return nil
+}
+
+// requireRole возвращает ErrForbidden, если роль пользователя Storage в списке listID не равна role,
+// и ErrListNotFound, если пользователь в списке не состоит
+func (dbHandl *Storage) requireRole(ctx context.Context, listID, role string) error {
+	current, err := dbHandl.ListRole(ctx, listID)
+	if err != nil {
+		return err
+	}
+	if current != role {
+		return ErrForbidden
+	}
+	return nil
+}
+
+// GetMembers возвращает участников списка задач с указанным ID. Список участников доступен всем участникам.
+func (dbHandl *Storage) GetMembers(ctx context.Context, listID string) ([]Member, error) {
+	_, err := dbHandl.ListRole(ctx, listID)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := dbHandl.withTimeout(ctx)
+	defer cancel()
+
+	// Пользователь по умолчанию не имеет учётной записи, поэтому логин у него пустой
+	rows, err := dbHandl.db.QueryContext(ctx, `SELECT m.user_id, IFNULL(u.login, ''), m.role FROM list_members m
+		LEFT JOIN users u ON u.id = m.user_id WHERE m.list_id = :list_id ORDER BY m.user_id`,
+		sql.Named("list_id", listID))
+	if err != nil {
+		return nil, wrapErr(err)
+	}
+	defer rows.Close()
+
+	members := []Member{}
+	for rows.Next() {
+		var member Member
+		err = rows.Scan(&member.UserID, &member.Login, &member.Role)
+		if err != nil {
+			return nil, wrapErr(err)
+		}
+		members = append(members, member)
+	}
+	return members, wrapErr(rows.Err())
+}
+
+// GetMemberIDs возвращает ID всех участников списка задач с указанным ID без проверки прав пользователя Storage.
+// Используется для доставки событий о задачах списка его участникам.
+func (dbHandl *Storage) GetMemberIDs(ctx context.Context, listID string) ([]int64, error) {
+	ctx, cancel := dbHandl.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := dbHandl.db.QueryContext(ctx, "SELECT user_id FROM list_members WHERE list_id = :list_id ORDER BY user_id",
+		sql.Named("list_id", listID))
+	if err != nil {
+		return nil, wrapErr(err)
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		err = rows.Scan(&id)
+		if err != nil {
+			return nil, wrapErr(err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, wrapErr(rows.Err())
+}
+
+// SetMemberRole изменяет роль участника userID в списке задач listID. Изменять роли может только владелец списка.
+// Возвращает ErrLastOwner, если у списка не останется владельца.
+func (dbHandl *Storage) SetMemberRole(ctx context.Context, listID string, userID int64, role string) error {
+	return dbHandl.WithTx(ctx, func(tx *Storage) error {
+		err := tx.requireRole(ctx, listID, RoleOwner)
+		if err != nil {
+			return err
+		}
+		queryCtx, cancel := tx.withTimeout(ctx)
+		defer cancel()
+
+		res, err := tx.db.ExecContext(queryCtx, "UPDATE list_members SET role = :role WHERE list_id = :list_id AND user_id = :member",
+			sql.Named("role", role), sql.Named("list_id", listID), sql.Named("member", userID))
+		if err != nil {
+			return wrapErr(err)
+		}
+		affected, _ := res.RowsAffected()
+		if affected != 1 {
+			return ErrMemberNotFound
+		}
+		return tx.checkOwner(queryCtx, listID)
+	})
+}
+
+// DeleteMember удаляет участника userID из списка задач listID. Удалять других участников может только владелец,
+// а выйти из списка может любой участник. Возвращает ErrLastOwner, если у списка не останется владельца.
+func (dbHandl *Storage) DeleteMember(ctx context.Context, listID string, userID int64) error {
+	return dbHandl.WithTx(ctx, func(tx *Storage) error {
+		var err error
+		if userID == tx.userID {
+			_, err = tx.ListRole(ctx, listID)
+		} else {
+			err = tx.requireRole(ctx, listID, RoleOwner)
+		}
+		if err != nil {
+			return err
+		}
+		queryCtx, cancel := tx.withTimeout(ctx)
+		defer cancel()
+
+		res, err := tx.db.ExecContext(queryCtx, "DELETE FROM list_members WHERE list_id = :list_id AND user_id = :member",
+			sql.Named("list_id", listID), sql.Named("member", userID))
+		if err != nil {
+			return wrapErr(err)
+		}
+		affected, _ := res.RowsAffected()
+		if affected != 1 {
+			return ErrMemberNotFound
+		}
+		return tx.checkOwner(queryCtx, listID)
+	})
+}
+
+// checkOwner возвращает ErrLastOwner, если у списка listID нет владельца. Вызывается внутри транзакции,
+// чтобы отменить изменение.
+func (dbHandl *Storage) checkOwner(ctx context.Context, listID string) error {
+	var owners int
+	err := dbHandl.db.QueryRowContext(ctx, "SELECT count(*) FROM list_members WHERE list_id = :list_id AND role = :role",
+		sql.Named("list_id", listID), sql.Named("role", RoleOwner)).Scan(&owners)
+	if err != nil {
+		return wrapErr(err)
+	}
+	if owners == 0 {
+		return ErrLastOwner
+	}
+	return nil
+}
+
+// AddInvite сохраняет приглашение в список задач listID с ролью role, действующее до expiresAt.
+// Приглашать может только владелец списка. Хранится только хеш token, поэтому приглашение нельзя получить из базы данных.
+func (dbHandl *Storage) AddInvite(ctx context.Context, listID, role, token string, expiresAt time.Time) error {
+	return dbHandl.WithTx(ctx, func(tx *Storage) error {
+		err := tx.requireRole(ctx, listID, RoleOwner)
+		if err != nil {
+			return err
+		}
+		queryCtx, cancel := tx.withTimeout(ctx)
+		defer cancel()
+
+		_, err = tx.db.ExecContext(queryCtx, "INSERT INTO list_invites (token_hash, list_id, role, expires_at) VALUES (:hash, :list_id, :role, :expires_at)",
+			sql.Named("hash", tokenHash(token)), sql.Named("list_id", listID), sql.Named("role", role),
+			sql.Named("expires_at", expiresAt.UTC().Format(time.RFC3339)))
+		return wrapErr(err)
+	})
+}
+
+// AcceptInvite добавляет пользователя Storage в список задач по приглашению token и удаляет приглашение.
+// Если пользователь уже состоит в списке, его роль не изменяется. Возвращает список с ролью пользователя
+// или ErrInviteNotFound, если приглашение не действует к now.
+func (dbHandl *Storage) AcceptInvite(ctx context.Context, token string, now time.Time) (List, error) {
+	var list List
+	err := dbHandl.WithTx(ctx, func(tx *Storage) error {
+		queryCtx, cancel := tx.withTimeout(ctx)
+		defer cancel()
+
+		var role string
+		err := tx.db.QueryRowContext(queryCtx, "DELETE FROM list_invites WHERE token_hash = :hash AND expires_at > :now RETURNING list_id, role",
+			sql.Named("hash", tokenHash(token)), sql.Named("now", now.UTC().Format(time.RFC3339))).Scan(&list.ID, &role)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrInviteNotFound
+		}
+		if err != nil {
+			return wrapErr(err)
+		}
+		_, err = tx.db.ExecContext(queryCtx, "INSERT OR IGNORE INTO list_members (list_id, user_id, role) VALUES (:list_id, :user_id, :role)",
+			sql.Named("list_id", list.ID), sql.Named("user_id", tx.userID), sql.Named("role", role))
+		if err != nil {
+			return wrapErr(err)
+		}
+		return wrapErr(tx.db.QueryRowContext(queryCtx, `SELECT l.id, l.name, m.role, l.created_at FROM lists l
+			JOIN list_members m ON m.list_id = l.id WHERE l.id = :list_id AND m.user_id = :user_id`,
+			sql.Named("list_id", list.ID), sql.Named("user_id", tx.userID)).Scan(&list.ID, &list.Name, &list.Role, &list.CreatedAt))
+	})
+	if err != nil {
+		return List{}, err
+	}
+	return list, nil
+}
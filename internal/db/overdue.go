@@ -0,0 +1,87 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"time"
+)
+
+// overdue.go содержит обработку просроченных задач с правилом repeat
+
+// Политики для просроченных задач с правилом repeat
+const (
+	// OverdueRoll переносит просроченную задачу на ближайшую дату по правилу repeat, начиная с сегодняшней
+	OverdueRoll = "roll"
+	// OverdueKeep оставляет задачу просроченной до отметки о выполнении или пропуска
+	OverdueKeep = "keep"
+)
+
+// overduePolicy возвращает политику для просроченных задач из переменной TODO_OVERDUE_POLICY. По умолчанию OverdueRoll.
+func overduePolicy() (string, error) {
+	policy := os.Getenv("TODO_OVERDUE_POLICY")
+	switch policy {
+	case "":
+		return OverdueRoll, nil
+	case OverdueRoll, OverdueKeep:
+		return policy, nil
+	}
+	return "", fmt.Errorf("некорректное значение TODO_OVERDUE_POLICY: %q", policy)
+}
+
+// RollOverdueTasks переносит просроченные задачи всех пользователей с правилом repeat на ближайшую дату не раньше now, если
+// политика OverduePolicy равна OverdueRoll. Задачи без repeat остаются просроченными.
+// Переносы записываются в журнал аудита без пользователя. Возвращает количество перенесённых задач.
+func (dbHandl *Storage) RollOverdueTasks(ctx context.Context, now time.Time) (int, error) {
+	if OverduePolicy != OverdueRoll {
+		return 0, nil
+	}
+
+	var rolled int
+	err := dbHandl.WithTx(ctx, func(tx *Storage) error {
+		tasks, err := tx.overdueRepeatingTasks(ctx, now)
+		if err != nil {
+			return err
+		}
+		// advanceTask ищет дату строго после переданной, поэтому считаем от вчерашнего дня
+		yesterday := now.AddDate(0, 0, -1)
+		for _, task := range tasks {
+			system := tx.ForUser(allUsers)
+			next, err := system.advanceTask(ctx, task, yesterday)
+			if err != nil {
+				return err
+			}
+			err = system.auditTask(ctx, AuditRoll, task, next)
+			if err != nil {
+				return err
+			}
+		}
+		rolled = len(tasks)
+		return nil
+	})
+	return rolled, err
+}
+
+// overdueRepeatingTasks возвращает задачи всех пользователей с правилом repeat, дата которых раньше now
+func (dbHandl *Storage) overdueRepeatingTasks(ctx context.Context, now time.Time) ([]Task, error) {
+	ctx, cancel := dbHandl.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := dbHandl.db.QueryContext(ctx, "SELECT "+taskColumns+" FROM scheduler WHERE date_key(date) < :today AND repeat != ''",
+		sql.Named("today", now.Format(sortableDate)))
+	if err != nil {
+		return nil, wrapErr(err)
+	}
+	defer rows.Close()
+
+	var tasks []Task
+	for rows.Next() {
+		task, err := scanTask(rows)
+		if err != nil {
+			return nil, wrapErr(err)
+		}
+		tasks = append(tasks, task)
+	}
+	return tasks, wrapErr(rows.Err())
+}
@@ -0,0 +1,84 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+)
+
+// reminders.go содержит учёт отправленных напоминаний о задачах
+
+// ClaimDueTasks возвращает задачи всех пользователей на дату date, напоминания о которых ещё не отправлялись, и отмечает их
+// как отправленные, чтобы напоминание о каждой задаче на эту дату было отправлено один раз.
+// Если напоминание не удалось доставить, отметку нужно снять через ReleaseReminder.
+func (dbHandl *Storage) ClaimDueTasks(ctx context.Context, date string) ([]Task, error) {
+	var tasks []Task
+	err := dbHandl.WithTx(ctx, func(tx *Storage) error {
+		queryCtx, cancel := tx.withTimeout(ctx)
+		defer cancel()
+
+		rows, err := tx.db.QueryContext(queryCtx, "SELECT "+taskColumns+" FROM scheduler WHERE date = :date AND id NOT IN (SELECT task_id FROM reminders WHERE date = :date) ORDER BY id",
+			sql.Named("date", date))
+		if err != nil {
+			return wrapErr(err)
+		}
+		tasks = nil
+		for rows.Next() {
+			task, err := scanTask(rows)
+			if err != nil {
+				rows.Close()
+				return wrapErr(err)
+			}
+			tasks = append(tasks, task)
+		}
+		rows.Close()
+		if err = rows.Err(); err != nil {
+			return wrapErr(err)
+		}
+
+		for _, task := range tasks {
+			_, err = tx.db.ExecContext(queryCtx, "INSERT INTO reminders (task_id, date) VALUES (:id, :date)",
+				sql.Named("id", task.ID), sql.Named("date", date))
+			if err != nil {
+				return wrapErr(err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tasks, nil
+}
+
+// ReleaseReminder снимает отметку об отправленном напоминании о задаче с указанным ID на дату date.
+func (dbHandl *Storage) ReleaseReminder(ctx context.Context, id string, date string) error {
+	ctx, cancel := dbHandl.withTimeout(ctx)
+	defer cancel()
+
+	_, err := dbHandl.db.ExecContext(ctx, "DELETE FROM reminders WHERE task_id = :id AND date = :date",
+		sql.Named("id", id), sql.Named("date", date))
+	return wrapErr(err)
+}
+
+// ClaimDigest отмечает сводку задач на дату date как отправленную. Возвращает false, если сводка на эту дату
+// уже была отправлена. Если сводку не удалось доставить, отметку нужно снять через ReleaseDigest.
+func (dbHandl *Storage) ClaimDigest(ctx context.Context, date string) (bool, error) {
+	ctx, cancel := dbHandl.withTimeout(ctx)
+	defer cancel()
+
+	res, err := dbHandl.db.ExecContext(ctx, "INSERT OR IGNORE INTO digests (date) VALUES (:date)", sql.Named("date", date))
+	if err != nil {
+		return false, wrapErr(err)
+	}
+	affected, _ := res.RowsAffected()
+	return affected == 1, nil
+}
+
+// ReleaseDigest снимает отметку об отправленной сводке задач на дату date.
+func (dbHandl *Storage) ReleaseDigest(ctx context.Context, date string) error {
+	ctx, cancel := dbHandl.withTimeout(ctx)
+	defer cancel()
+
+	_, err := dbHandl.db.ExecContext(ctx, "DELETE FROM digests WHERE date = :date", sql.Named("date", date))
+	return wrapErr(err)
+}
@@ -4,6 +4,10 @@ CREATE TABLE "scheduler" (
 	"title"	TEXT NOT NULL,
 	"comment"	TEXT,
 	"repeat"	TEXT NOT NULL DEFAULT "",
+	"version"	INTEGER NOT NULL DEFAULT 1,
+	"snoozed_from"	TEXT NOT NULL DEFAULT "",
+	"user_id"	INTEGER NOT NULL DEFAULT 0,
+	"list_id"	INTEGER REFERENCES "lists"("id") ON DELETE CASCADE,
 	CHECK(length("repeat") <= 128)
 	CHECK(length("title") > 0)
 	PRIMARY KEY("id" AUTOINCREMENT)
@@ -11,4 +15,162 @@ CREATE TABLE "scheduler" (
 
 CREATE INDEX "scheduler_date" ON "scheduler" (
 	"date"	DESC
-);
\ No newline at end of file
+);
+
+CREATE TABLE "completions" (
+	"id"	INTEGER,
+	"task_id"	INTEGER NOT NULL,
+	"date"	TEXT NOT NULL,
+	"completed_at"	TEXT NOT NULL,
+	PRIMARY KEY("id" AUTOINCREMENT)
+);
+
+CREATE TABLE "task_exceptions" (
+	"task_id"	INTEGER NOT NULL REFERENCES "scheduler"("id") ON DELETE CASCADE,
+	"date"	TEXT NOT NULL,
+	PRIMARY KEY("task_id", "date")
+);
+
+CREATE TABLE "reminders" (
+	"task_id"	INTEGER NOT NULL REFERENCES "scheduler"("id") ON DELETE CASCADE,
+	"date"	TEXT NOT NULL,
+	PRIMARY KEY("task_id", "date")
+);
+
+CREATE TABLE "webhooks" (
+	"id"	INTEGER,
+	"user_id"	INTEGER NOT NULL DEFAULT 0,
+	"url"	TEXT NOT NULL,
+	"secret"	TEXT NOT NULL,
+	"events"	TEXT NOT NULL,
+	"created_at"	TEXT NOT NULL,
+	PRIMARY KEY("id" AUTOINCREMENT)
+);
+
+CREATE TABLE "webhook_outbox" (
+	"id"	INTEGER,
+	"webhook_id"	INTEGER NOT NULL REFERENCES "webhooks"("id") ON DELETE CASCADE,
+	"event"	TEXT NOT NULL,
+	"payload"	TEXT NOT NULL,
+	"status"	TEXT NOT NULL,
+	"attempts"	INTEGER NOT NULL DEFAULT 0,
+	"last_error"	TEXT NOT NULL DEFAULT "",
+	"next_attempt_at"	TEXT NOT NULL,
+	"created_at"	TEXT NOT NULL,
+	PRIMARY KEY("id" AUTOINCREMENT)
+);
+
+CREATE TABLE "webhook_deliveries" (
+	"id"	INTEGER,
+	"outbox_id"	INTEGER NOT NULL,
+	"webhook_id"	INTEGER NOT NULL REFERENCES "webhooks"("id") ON DELETE CASCADE,
+	"event"	TEXT NOT NULL,
+	"attempt"	INTEGER NOT NULL,
+	"status_code"	INTEGER NOT NULL,
+	"error"	TEXT NOT NULL,
+	"status"	TEXT NOT NULL,
+	"created_at"	TEXT NOT NULL,
+	PRIMARY KEY("id" AUTOINCREMENT)
+);
+
+CREATE INDEX "webhook_outbox_pending" ON "webhook_outbox" (
+	"status",
+	"next_attempt_at"
+);
+
+CREATE TABLE "digests" (
+	"date"	TEXT NOT NULL,
+	PRIMARY KEY("date")
+);
+
+CREATE TABLE "users" (
+	"id"	INTEGER,
+	"login"	TEXT NOT NULL UNIQUE COLLATE NOCASE,
+	"password_hash"	TEXT NOT NULL,
+	"created_at"	TEXT NOT NULL,
+	PRIMARY KEY("id" AUTOINCREMENT)
+);
+
+CREATE TABLE "lists" (
+	"id"	INTEGER,
+	"name"	TEXT NOT NULL,
+	"created_at"	TEXT NOT NULL,
+	CHECK(length("name") > 0)
+	PRIMARY KEY("id" AUTOINCREMENT)
+);
+
+CREATE TABLE "list_members" (
+	"list_id"	INTEGER NOT NULL REFERENCES "lists"("id") ON DELETE CASCADE,
+	"user_id"	INTEGER NOT NULL,
+	"role"	TEXT NOT NULL,
+	PRIMARY KEY("list_id", "user_id")
+);
+
+CREATE TABLE "list_invites" (
+	"token_hash"	TEXT NOT NULL,
+	"list_id"	INTEGER NOT NULL REFERENCES "lists"("id") ON DELETE CASCADE,
+	"role"	TEXT NOT NULL,
+	"expires_at"	TEXT NOT NULL,
+	PRIMARY KEY("token_hash")
+);
+
+CREATE TABLE "revoked_tokens" (
+	"jti"	TEXT NOT NULL,
+	"expires_at"	INTEGER NOT NULL,
+	PRIMARY KEY("jti")
+);
+
+CREATE TABLE "api_tokens" (
+	"id"	INTEGER,
+	"user_id"	INTEGER NOT NULL,
+	"name"	TEXT NOT NULL,
+	"token_hash"	TEXT NOT NULL UNIQUE,
+	"scopes"	TEXT NOT NULL,
+	"created_at"	TEXT NOT NULL,
+	"last_used_at"	TEXT NOT NULL DEFAULT "",
+	PRIMARY KEY("id" AUTOINCREMENT)
+);
+
+CREATE TABLE "totp" (
+	"user_id"	INTEGER NOT NULL,
+	"secret"	TEXT NOT NULL,
+	"enabled"	INTEGER NOT NULL DEFAULT 0,
+	"last_step"	INTEGER NOT NULL DEFAULT 0,
+	"created_at"	TEXT NOT NULL,
+	PRIMARY KEY("user_id")
+);
+
+CREATE TABLE "recovery_codes" (
+	"user_id"	INTEGER NOT NULL,
+	"code_hash"	TEXT NOT NULL,
+	PRIMARY KEY("user_id", "code_hash")
+);
+
+CREATE TABLE "audit_log" (
+	"id"	INTEGER,
+	"user_id"	INTEGER,
+	"owner_id"	INTEGER,
+	"ip"	TEXT NOT NULL,
+	"method"	TEXT NOT NULL,
+	"route"	TEXT NOT NULL,
+	"action"	TEXT NOT NULL,
+	"status"	INTEGER NOT NULL,
+	"task_id"	INTEGER,
+	"list_id"	INTEGER,
+	"changes"	TEXT NOT NULL,
+	"created_at"	TEXT NOT NULL,
+	PRIMARY KEY("id" AUTOINCREMENT)
+);
+
+CREATE INDEX "audit_log_owner" ON "audit_log" ("owner_id", "id");
+
+-- Журнал аудита только дополняется
+CREATE TRIGGER "audit_log_no_update" BEFORE UPDATE ON "audit_log"
+BEGIN
+	SELECT RAISE(ABORT, 'журнал аудита нельзя изменять');
+END;
+
+CREATE TRIGGER "audit_log_no_delete" BEFORE DELETE ON "audit_log"
+BEGIN
+	SELECT RAISE(ABORT, 'журнал аудита нельзя изменять');
+END;
\ No newline at end of file
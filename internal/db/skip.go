@@ -0,0 +1,182 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	nd "github.com/AsyaBiryukova/go_final_project/internal/nextdate"
+)
+
+// skip.go содержит пропуск повторений задачи и журнал выполнения задач
+
+// maxSkippedDates ограничивает количество подряд пропускаемых дат при поиске следующей даты задачи
+const maxSkippedDates = 1000
+
+// SkipTask пропускает повторение задачи с указанным ID, не записывая выполнение в журнал completions.
+// Если date пустая строка или совпадает с текущей датой задачи, переносит задачу на следующую дату по правилу repeat.
+// Если date — будущая дата, запоминает её как исключение, и задача не будет назначена на эту дату.
+// Если version не равна 0, задача изменяется только если её версия в базе данных не изменилась.
+// Пропуск записывается в журнал аудита. Возвращает задачу после изменения, или ошибку в случае неудачи.
+func (dbHandl *Storage) SkipTask(ctx context.Context, id string, version int64, date string, now time.Time) (Task, error) {
+	var task Task
+	err := dbHandl.WithTx(ctx, func(tx *Storage) error {
+		var err error
+		task, err = tx.GetTaskByID(ctx, id)
+		if err != nil {
+			return err
+		}
+		if version != 0 && task.Version != version {
+			return ErrVersionConflict
+		}
+		if len(task.Repeat) == 0 {
+			return newValidationError("repeat", "нельзя пропустить задачу без правила повторения")
+		}
+
+		before := task
+		if len(date) == 0 || date == task.Date {
+			task, err = tx.advanceTask(ctx, task, now)
+			if err != nil {
+				return err
+			}
+			return tx.auditTask(ctx, AuditSkip, before, task)
+		}
+		_, err = time.Parse(DateFormat, date)
+		if err != nil {
+			return nd.NewValidationError("date", nd.ErrInvalidDate)
+		}
+		if dateKey(date) < dateKey(task.Date) {
+			return newValidationError("date", "можно пропустить только будущую дату задачи")
+		}
+		err = tx.requireTaskWrite(ctx, id)
+		if err != nil {
+			return err
+		}
+		err = tx.addException(ctx, id, date)
+		if err != nil {
+			return err
+		}
+		// Дата задачи не меняется, поэтому в журнал записывается пропускаемая дата
+		return tx.auditChanges(ctx, AuditSkip, before, map[string]AuditChange{"exceptions": {New: date}})
+	})
+	if err != nil {
+		return Task{}, err
+	}
+	return task, nil
+}
+
+// GetTaskExceptions возвращает пропускаемые даты задачи с указанным ID в порядке возрастания.
+func (dbHandl *Storage) GetTaskExceptions(ctx context.Context, id string) ([]string, error) {
+	_, err := dbHandl.GetTaskByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := dbHandl.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := dbHandl.db.QueryContext(ctx, "SELECT date FROM task_exceptions WHERE task_id = :id ORDER BY date_key(date)",
+		sql.Named("id", id))
+	if err != nil {
+		return nil, wrapErr(err)
+	}
+	defer rows.Close()
+
+	dates := []string{}
+	for rows.Next() {
+		var date string
+		if err := rows.Scan(&date); err != nil {
+			return nil, wrapErr(err)
+		}
+		dates = append(dates, date)
+	}
+	return dates, wrapErr(rows.Err())
+}
+
+// DeleteTaskException удаляет пропускаемую дату date задачи с указанным ID.
+// Возвращает ErrNotFound, если такой даты у задачи нет.
+func (dbHandl *Storage) DeleteTaskException(ctx context.Context, id string, date string) error {
+	ctx, cancel := dbHandl.withTimeout(ctx)
+	defer cancel()
+
+	res, err := dbHandl.db.ExecContext(ctx, "DELETE FROM task_exceptions WHERE task_id = (SELECT id FROM scheduler WHERE id = :id AND "+writableTasks+") AND date = :date",
+		sql.Named("id", id), sql.Named("user_id", dbHandl.userID), sql.Named("date", date))
+	if err != nil {
+		return wrapErr(err)
+	}
+	affected, _ := res.RowsAffected()
+	if affected != 1 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// addException запоминает дату date как пропускаемую дату задачи
+func (dbHandl *Storage) addException(ctx context.Context, id string, date string) error {
+	ctx, cancel := dbHandl.withTimeout(ctx)
+	defer cancel()
+
+	_, err := dbHandl.db.ExecContext(ctx, "INSERT OR IGNORE INTO task_exceptions (task_id, date) VALUES (:id, :date)",
+		sql.Named("id", id), sql.Named("date", date))
+	return wrapErr(err)
+}
+
+// advanceTask переносит задачу с правилом repeat на следующую после now дату, пропуская даты-исключения.
+// Следующая дата отложенной задачи считается от даты, с которой её отложили, чтобы не сдвигать расписание repeat.
+// Исключения на даты до новой даты задачи больше не нужны и удаляются.
+func (dbHandl *Storage) advanceTask(ctx context.Context, task Task, now time.Time) (Task, error) {
+	exceptions, err := dbHandl.GetTaskExceptions(ctx, task.ID)
+	if err != nil {
+		return Task{}, err
+	}
+	skipped := make(map[string]bool, len(exceptions))
+	for _, date := range exceptions {
+		skipped[date] = true
+	}
+
+	from := task.Date
+	if len(task.SnoozedFrom) > 0 {
+		from = task.SnoozedFrom
+	}
+	next, err := nd.NextDate(now, from, task.Repeat)
+	for i := 0; err == nil && skipped[next]; i++ {
+		if i == maxSkippedDates {
+			return Task{}, fmt.Errorf("не удалось найти дату задачи без исключений")
+		}
+		var nextTime time.Time
+		nextTime, err = time.Parse(DateFormat, next)
+		if err == nil {
+			next, err = nd.NextDate(nextTime, from, task.Repeat)
+		}
+	}
+	if err != nil {
+		return Task{}, err
+	}
+
+	task.Date = next
+	task.SnoozedFrom = ""
+	task.Version, err = dbHandl.putTask(ctx, task)
+	if err != nil {
+		return Task{}, err
+	}
+
+	queryCtx, cancel := dbHandl.withTimeout(ctx)
+	defer cancel()
+	_, err = dbHandl.db.ExecContext(queryCtx, "DELETE FROM task_exceptions WHERE task_id = :id AND date_key(date) < :date",
+		sql.Named("id", task.ID), sql.Named("date", dateKey(task.Date)))
+	if err != nil {
+		return Task{}, wrapErr(err)
+	}
+	return task, nil
+}
+
+// logCompletion записывает выполнение текущего повторения задачи в журнал completions
+func (dbHandl *Storage) logCompletion(ctx context.Context, task Task, now time.Time) error {
+	ctx, cancel := dbHandl.withTimeout(ctx)
+	defer cancel()
+
+	_, err := dbHandl.db.ExecContext(ctx, "INSERT INTO completions (task_id, date, completed_at) VALUES (:id, :date, :completed_at)",
+		sql.Named("id", task.ID), sql.Named("date", task.Date), sql.Named("completed_at", now.Format(time.RFC3339)))
+	return wrapErr(err)
+}
@@ -1,7 +1,6 @@
 package db
 
 import (
-	"fmt"
 	"log"
 	"regexp"
 	"strings"
@@ -16,28 +15,56 @@ type Task struct {
 	Title   string `json:"title"`
 	Comment string `json:"comment"`
 	Repeat  string `json:"repeat"`
+	// Version увеличивается при каждом изменении задачи, передаётся клиенту в заголовке ETag
+	Version int64 `json:"-"`
+	// SnoozedFrom содержит дату по правилу repeat, с которой задача была отложена, или пустую строку
+	SnoozedFrom string `json:"snoozed_from,omitempty"`
+	// Overdue показывает, что дата задачи прошла, а задача не выполнена. Вычисляется при чтении списка задач
+	Overdue bool `json:"overdue,omitempty"`
+	// UserID пользователь, создавший задачу
+	UserID int64 `json:"-"`
+	// ListID содержит ID общего списка задач или пустую строку для личной задачи
+	ListID string `json:"list_id,omitempty"`
 }
 
-// formatTask проверяет переданную задачу Task на корректность полей, а так же корректирует дату задачи.
+// formatTask проверяет переданную задачу Task на корректность полей, а так же корректирует дату задачи:
+// прошедшая дата задачи без repeat переносится на сегодня, задачи с repeat — на следующую дату, если политика OverduePolicy равна OverdueRoll.
 // Возвращает отформатированную задачу или ошибку.
 func (task Task) FormatTask() (Task, error) {
 	var date time.Time
 	var err error
 
-	if len(task.Date) == 0 || strings.ToLower(task.Date) == "today" {
+	relDate, isRelative := nd.RelativeDate(task.Date, time.Now())
+	switch {
+	case len(task.Date) == 0:
 		date = time.Now()
 		task.Date = date.Format(DateFormat)
 
-	} else {
+	// Относительные даты вида "today", "завтра", "через 3 дня"
+	case isRelative:
+		date = relDate
+		task.Date = date.Format(DateFormat)
+
+	default:
 		date, err = time.Parse(DateFormat, task.Date)
 		if err != nil {
 			log.Println(err)
-			return Task{}, err
+			return Task{}, nd.NewValidationError("date", nd.ErrInvalidDate)
 		}
 	}
-	if isID, _ := regexp.Match("[0-9]+", []byte(task.ID)); !isID && task.ID != "" {
-		err = fmt.Errorf("некорректный формат ID")
-		return Task{}, err
+	if isID, _ := regexp.Match("^[0-9]+$", []byte(task.ID)); !isID && task.ID != "" {
+		return Task{}, newValidationError("id", "некорректный формат ID")
+	}
+	if len(strings.TrimSpace(task.Title)) == 0 {
+		return Task{}, newValidationError("title", "не указан заголовок задачи")
+	}
+
+	// Проверяем правило повторения, даже если дата не требует корректировки
+	if len(task.Repeat) > 0 {
+		_, err = nd.NextDate(time.Now(), task.Date, task.Repeat)
+		if err != nil {
+			return Task{}, err
+		}
 	}
 
 	// Даты с временем приведённым к 00:00:00
@@ -46,6 +73,8 @@ func (task Task) FormatTask() (Task, error) {
 
 	if dateTrunc.Before(nowTrunc) {
 		switch {
+		// При политике OverdueKeep повторяющаяся задача остаётся просроченной до отметки о выполнении
+		case len(task.Repeat) > 0 && OverduePolicy == OverdueKeep:
 		case len(task.Repeat) > 0:
 			task.Date, err = nd.NextDate(time.Now(), task.Date, task.Repeat)
 			if err != nil {
@@ -59,3 +88,65 @@ func (task Task) FormatTask() (Task, error) {
 	}
 	return task, nil
 }
+
+// TaskPatch описывает изменение задачи в формате JSON Merge Patch (RFC 7396).
+// Переданные поля заменяют поля задачи, поле со значением null сбрасывается в пустую строку.
+type TaskPatch map[string]*string
+
+// patchColumns содержит поля задачи, которые можно изменить через TaskPatch
+var patchColumns = []string{"date", "title", "comment", "repeat"}
+
+// ApplyPatch применяет изменения patch к задаче. Дата проверяется и корректируется только если изменились date или repeat.
+// Возвращает изменённую задачу и значения изменившихся полей, или ошибку.
+func (task Task) ApplyPatch(patch TaskPatch) (Task, map[string]string, error) {
+	orig := task
+	for field, value := range patch {
+		var str string
+		if value != nil {
+			str = *value
+		}
+		switch field {
+		case "id":
+			// id задачи нельзя изменить, но его можно передать вместе с задачей
+			if str != task.ID {
+				return Task{}, nil, newValidationError("id", "некорректный формат ID")
+			}
+		case "date":
+			task.Date = str
+		case "title":
+			task.Title = str
+		case "comment":
+			task.Comment = str
+		case "repeat":
+			task.Repeat = str
+		default:
+			return Task{}, nil, newValidationError(field, "неизвестное поле задачи")
+		}
+	}
+
+	if _, ok := patch["title"]; ok && len(strings.TrimSpace(task.Title)) == 0 {
+		return Task{}, nil, newValidationError("title", "не указан заголовок задачи")
+	}
+
+	if task.Date != orig.Date || task.Repeat != orig.Repeat {
+		var err error
+		task, err = task.FormatTask()
+		if err != nil {
+			return Task{}, nil, err
+		}
+	}
+
+	changed := make(map[string]string)
+	values := map[string][2]string{
+		"date":    {orig.Date, task.Date},
+		"title":   {orig.Title, task.Title},
+		"comment": {orig.Comment, task.Comment},
+		"repeat":  {orig.Repeat, task.Repeat},
+	}
+	for _, column := range patchColumns {
+		if values[column][0] != values[column][1] {
+			changed[column] = values[column][1]
+		}
+	}
+	return task, changed, nil
+}
@@ -0,0 +1,152 @@
+package db
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+)
+
+// tokens.go содержит список отозванных JWT и API токены
+
+// ErrAPITokenNotFound возвращается, если API токен с указанным ID не существует.
+var ErrAPITokenNotFound = errors.New("токен не найден")
+
+// APIToken описывает персональный токен пользователя для доступа к api из скриптов.
+// Token возвращается только при создании, в базе данных хранится его хеш.
+type APIToken struct {
+	ID         string   `json:"id"`
+	Name       string   `json:"name"`
+	Scopes     []string `json:"scopes"`
+	Token      string   `json:"token,omitempty"`
+	CreatedAt  string   `json:"created_at"`
+	LastUsedAt string   `json:"last_used_at,omitempty"`
+}
+
+// RevokeToken добавляет jti токена в список отозванных до истечения срока действия токена expiresAt.
+// Возвращает false, если токен уже был отозван. Записи об отозванных токенах с истёкшим сроком удаляются,
+// такие токены и так не проходят проверку.
+func (dbHandl *Storage) RevokeToken(ctx context.Context, jti string, expiresAt, now time.Time) (bool, error) {
+	var revoked bool
+	err := dbHandl.WithTx(ctx, func(tx *Storage) error {
+		queryCtx, cancel := tx.withTimeout(ctx)
+		defer cancel()
+
+		_, err := tx.db.ExecContext(queryCtx, "DELETE FROM revoked_tokens WHERE expires_at < :now",
+			sql.Named("now", now.Unix()))
+		if err != nil {
+			return wrapErr(err)
+		}
+		res, err := tx.db.ExecContext(queryCtx, "INSERT OR IGNORE INTO revoked_tokens (jti, expires_at) VALUES (:jti, :expires_at)",
+			sql.Named("jti", jti), sql.Named("expires_at", expiresAt.Unix()))
+		if err != nil {
+			return wrapErr(err)
+		}
+		affected, _ := res.RowsAffected()
+		revoked = affected == 1
+		return nil
+	})
+	return revoked, err
+}
+
+// IsTokenRevoked возвращает true, если токен с указанным jti отозван.
+func (dbHandl *Storage) IsTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	ctx, cancel := dbHandl.withTimeout(ctx)
+	defer cancel()
+
+	var revoked bool
+	err := dbHandl.db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM revoked_tokens WHERE jti = :jti)",
+		sql.Named("jti", jti)).Scan(&revoked)
+	if err != nil {
+		return false, wrapErr(err)
+	}
+	return revoked, nil
+}
+
+// AddAPIToken сохраняет хеш API токена token.Token пользователя Storage и возвращает ID токена.
+func (dbHandl *Storage) AddAPIToken(ctx context.Context, token APIToken, now time.Time) (string, error) {
+	ctx, cancel := dbHandl.withTimeout(ctx)
+	defer cancel()
+
+	var id string
+	row := dbHandl.db.QueryRowContext(ctx, "INSERT INTO api_tokens (user_id, name, token_hash, scopes, created_at) VALUES (:user_id, :name, :hash, :scopes, :created_at) RETURNING id",
+		sql.Named("user_id", dbHandl.userID), sql.Named("name", token.Name), sql.Named("hash", tokenHash(token.Token)),
+		sql.Named("scopes", strings.Join(token.Scopes, ",")), sql.Named("created_at", now.UTC().Format(time.RFC3339)))
+	err := row.Scan(&id)
+	if err != nil {
+		return "", wrapErr(err)
+	}
+	return id, nil
+}
+
+// GetAPITokens возвращает API токены пользователя Storage без самих токенов.
+func (dbHandl *Storage) GetAPITokens(ctx context.Context) ([]APIToken, error) {
+	ctx, cancel := dbHandl.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := dbHandl.db.QueryContext(ctx, "SELECT id, name, scopes, created_at, last_used_at FROM api_tokens WHERE user_id = :user_id ORDER BY id",
+		sql.Named("user_id", dbHandl.userID))
+	if err != nil {
+		return nil, wrapErr(err)
+	}
+	defer rows.Close()
+
+	tokens := []APIToken{}
+	for rows.Next() {
+		var token APIToken
+		var scopes string
+		err = rows.Scan(&token.ID, &token.Name, &scopes, &token.CreatedAt, &token.LastUsedAt)
+		if err != nil {
+			return nil, wrapErr(err)
+		}
+		token.Scopes = strings.Split(scopes, ",")
+		tokens = append(tokens, token)
+	}
+	return tokens, wrapErr(rows.Err())
+}
+
+// DeleteAPIToken отзывает API токен пользователя Storage.
+func (dbHandl *Storage) DeleteAPIToken(ctx context.Context, id string) error {
+	ctx, cancel := dbHandl.withTimeout(ctx)
+	defer cancel()
+
+	res, err := dbHandl.db.ExecContext(ctx, "DELETE FROM api_tokens WHERE id = :id AND user_id = :user_id",
+		sql.Named("id", id), sql.Named("user_id", dbHandl.userID))
+	if err != nil {
+		return wrapErr(err)
+	}
+	affected, _ := res.RowsAffected()
+	if affected != 1 {
+		return ErrAPITokenNotFound
+	}
+	return nil
+}
+
+// UseAPIToken находит API токен token, отмечает время его использования now и возвращает ID токена,
+// ID пользователя и права токена. Возвращает ErrAPITokenNotFound, если токен не существует или отозван.
+func (dbHandl *Storage) UseAPIToken(ctx context.Context, token string, now time.Time) (string, int64, []string, error) {
+	ctx, cancel := dbHandl.withTimeout(ctx)
+	defer cancel()
+
+	var id, scopes string
+	var userID int64
+	err := dbHandl.db.QueryRowContext(ctx, "UPDATE api_tokens SET last_used_at = :now WHERE token_hash = :hash RETURNING id, user_id, scopes",
+		sql.Named("now", now.UTC().Format(time.RFC3339)), sql.Named("hash", tokenHash(token))).Scan(&id, &userID, &scopes)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", 0, nil, ErrAPITokenNotFound
+	}
+	if err != nil {
+		return "", 0, nil, wrapErr(err)
+	}
+	return id, userID, strings.Split(scopes, ","), nil
+}
+
+// tokenHash возвращает хеш SHA-256 секретного токена token в шестнадцатеричном виде.
+// Приглашения и API токены хранятся в базе данных только в виде хеша.
+func tokenHash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
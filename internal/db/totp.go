@@ -0,0 +1,141 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// totp.go содержит секреты TOTP и коды восстановления второго фактора входа
+
+var (
+	// ErrTOTPNotFound возвращается, если пользователь не начинал настройку TOTP.
+	ErrTOTPNotFound = errors.New("двухфакторная аутентификация не настроена")
+	// ErrTOTPEnabled возвращается при повторной настройке уже включённого TOTP.
+	ErrTOTPEnabled = errors.New("двухфакторная аутентификация уже включена")
+)
+
+// TOTP описывает секрет TOTP пользователя. Пока Enabled равен false, настройка не подтверждена кодом
+// и вход не требует второго фактора. LastStep — номер периода последнего принятого кода.
+type TOTP struct {
+	Secret   string
+	Enabled  bool
+	LastStep int64
+}
+
+// SetTOTPSecret сохраняет новый неподтверждённый секрет TOTP пользователя Storage вместо прежнего.
+// Возвращает ErrTOTPEnabled, если TOTP уже включён.
+func (dbHandl *Storage) SetTOTPSecret(ctx context.Context, secret string, now time.Time) error {
+	ctx, cancel := dbHandl.withTimeout(ctx)
+	defer cancel()
+
+	res, err := dbHandl.db.ExecContext(ctx, `INSERT INTO totp (user_id, secret, created_at) VALUES (:user_id, :secret, :created_at)
+		ON CONFLICT (user_id) DO UPDATE SET secret = excluded.secret, last_step = 0, created_at = excluded.created_at WHERE enabled = 0`,
+		sql.Named("user_id", dbHandl.userID), sql.Named("secret", secret), sql.Named("created_at", now.UTC().Format(time.RFC3339)))
+	if err != nil {
+		return wrapErr(err)
+	}
+	affected, _ := res.RowsAffected()
+	if affected != 1 {
+		return ErrTOTPEnabled
+	}
+	return nil
+}
+
+// GetTOTP возвращает секрет TOTP пользователя Storage или ErrTOTPNotFound.
+func (dbHandl *Storage) GetTOTP(ctx context.Context) (TOTP, error) {
+	ctx, cancel := dbHandl.withTimeout(ctx)
+	defer cancel()
+
+	var totp TOTP
+	err := dbHandl.db.QueryRowContext(ctx, "SELECT secret, enabled, last_step FROM totp WHERE user_id = :user_id",
+		sql.Named("user_id", dbHandl.userID)).Scan(&totp.Secret, &totp.Enabled, &totp.LastStep)
+	if errors.Is(err, sql.ErrNoRows) {
+		return TOTP{}, ErrTOTPNotFound
+	}
+	if err != nil {
+		return TOTP{}, wrapErr(err)
+	}
+	return totp, nil
+}
+
+// EnableTOTP включает TOTP пользователя Storage после проверки кода периода step и заменяет его коды восстановления
+// на codes. Коды восстановления хранятся только в виде хеша.
+func (dbHandl *Storage) EnableTOTP(ctx context.Context, step int64, codes []string) error {
+	return dbHandl.WithTx(ctx, func(tx *Storage) error {
+		queryCtx, cancel := tx.withTimeout(ctx)
+		defer cancel()
+
+		res, err := tx.db.ExecContext(queryCtx, "UPDATE totp SET enabled = 1, last_step = :step WHERE user_id = :user_id AND enabled = 0",
+			sql.Named("step", step), sql.Named("user_id", tx.userID))
+		if err != nil {
+			return wrapErr(err)
+		}
+		affected, _ := res.RowsAffected()
+		if affected != 1 {
+			return ErrTOTPEnabled
+		}
+		_, err = tx.db.ExecContext(queryCtx, "DELETE FROM recovery_codes WHERE user_id = :user_id", sql.Named("user_id", tx.userID))
+		if err != nil {
+			return wrapErr(err)
+		}
+		for _, code := range codes {
+			_, err = tx.db.ExecContext(queryCtx, "INSERT INTO recovery_codes (user_id, code_hash) VALUES (:user_id, :hash)",
+				sql.Named("user_id", tx.userID), sql.Named("hash", tokenHash(code)))
+			if err != nil {
+				return wrapErr(err)
+			}
+		}
+		return nil
+	})
+}
+
+// UseTOTPStep отмечает код периода step пользователя Storage использованным. Возвращает false, если код этого
+// или более позднего периода уже использован, так перехваченный код нельзя применить повторно.
+func (dbHandl *Storage) UseTOTPStep(ctx context.Context, step int64) (bool, error) {
+	ctx, cancel := dbHandl.withTimeout(ctx)
+	defer cancel()
+
+	res, err := dbHandl.db.ExecContext(ctx, "UPDATE totp SET last_step = :step WHERE user_id = :user_id AND last_step < :step",
+		sql.Named("step", step), sql.Named("user_id", dbHandl.userID))
+	if err != nil {
+		return false, wrapErr(err)
+	}
+	affected, _ := res.RowsAffected()
+	return affected == 1, nil
+}
+
+// UseRecoveryCode удаляет код восстановления code пользователя Storage. Возвращает false, если такого кода нет
+// или он уже использован.
+func (dbHandl *Storage) UseRecoveryCode(ctx context.Context, code string) (bool, error) {
+	ctx, cancel := dbHandl.withTimeout(ctx)
+	defer cancel()
+
+	res, err := dbHandl.db.ExecContext(ctx, "DELETE FROM recovery_codes WHERE user_id = :user_id AND code_hash = :hash",
+		sql.Named("user_id", dbHandl.userID), sql.Named("hash", tokenHash(code)))
+	if err != nil {
+		return false, wrapErr(err)
+	}
+	affected, _ := res.RowsAffected()
+	return affected == 1, nil
+}
+
+// DeleteTOTP отключает TOTP пользователя Storage и удаляет его коды восстановления.
+func (dbHandl *Storage) DeleteTOTP(ctx context.Context) error {
+	return dbHandl.WithTx(ctx, func(tx *Storage) error {
+		queryCtx, cancel := tx.withTimeout(ctx)
+		defer cancel()
+
+		res, err := tx.db.ExecContext(queryCtx, "DELETE FROM totp WHERE user_id = :user_id", sql.Named("user_id", tx.userID))
+		if err != nil {
+			return wrapErr(err)
+		}
+		affected, _ := res.RowsAffected()
+		if affected != 1 {
+			return ErrTOTPNotFound
+		}
+		_, err = tx.db.ExecContext(queryCtx, "DELETE FROM recovery_codes WHERE user_id = :user_id", sql.Named("user_id", tx.userID))
+		return wrapErr(err)
+	})
+}
@@ -0,0 +1,61 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+)
+
+// tx.go содержит выполнение запросов Storage в транзакции
+
+// WithTx выполняет fn в транзакции. Все запросы к tx внутри fn выполняются в одной транзакции.
+// Если fn возвращает ошибку, транзакция откатывается, иначе фиксируется.
+// Вызов WithTx внутри транзакции выполняет fn в уже начатой транзакции.
+func (dbHandl *Storage) WithTx(ctx context.Context, fn func(tx *Storage) error) error {
+	if dbHandl.conn == nil {
+		return fn(dbHandl)
+	}
+	sqlTx, err := dbHandl.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return wrapErr(err)
+	}
+	tx := &Storage{db: sqlTx, timeout: dbHandl.timeout, userID: dbHandl.userID}
+
+	err = fn(tx)
+	if err != nil {
+		// При отмене ctx database/sql откатывает транзакцию сам
+		if rbErr := sqlTx.Rollback(); rbErr != nil && !errors.Is(rbErr, sql.ErrTxDone) {
+			log.Println(rbErr)
+		}
+		return err
+	}
+	return wrapErr(sqlTx.Commit())
+}
+
+// WithSavepoint выполняет fn внутри точки сохранения транзакции. Если fn возвращает ошибку, откатываются только
+// изменения, сделанные в fn, а транзакция продолжается. Вызывается только у Storage, полученного в WithTx.
+func (dbHandl *Storage) WithSavepoint(ctx context.Context, fn func() error) error {
+	if dbHandl.conn != nil {
+		return fn()
+	}
+	_, err := dbHandl.db.ExecContext(ctx, "SAVEPOINT item")
+	if err != nil {
+		return wrapErr(err)
+	}
+
+	err = fn()
+	if err != nil {
+		// Откатываем точку сохранения даже если ctx уже отменён
+		ctx := context.WithoutCancel(ctx)
+		if _, rbErr := dbHandl.db.ExecContext(ctx, "ROLLBACK TO item"); rbErr != nil {
+			log.Println(rbErr)
+		}
+		if _, relErr := dbHandl.db.ExecContext(ctx, "RELEASE item"); relErr != nil {
+			log.Println(relErr)
+		}
+		return err
+	}
+	_, err = dbHandl.db.ExecContext(ctx, "RELEASE item")
+	return wrapErr(err)
+}
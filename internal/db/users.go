@@ -0,0 +1,93 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// users.go содержит учётные записи пользователей
+
+// DefaultUserID пользователь, который входит по паролю TODO_PASSWORD. Ему принадлежат задачи,
+// созданные до появления учётных записей.
+const DefaultUserID int64 = 0
+
+var (
+	// ErrUserExists возвращается, если пользователь с таким логином уже зарегистрирован.
+	ErrUserExists = errors.New("пользователь уже существует")
+	// ErrUserNotFound возвращается, если пользователь с указанным логином не существует.
+	ErrUserNotFound = errors.New("пользователь не найден")
+)
+
+// User описывает учётную запись. PasswordHash — хеш пароля bcrypt.
+type User struct {
+	ID           int64
+	Login        string
+	PasswordHash string
+	CreatedAt    string
+}
+
+// ForUser возвращает Storage, запросы которого обращаются только к задачам и подпискам пользователя userID.
+func (dbHandl *Storage) ForUser(userID int64) *Storage {
+	s := *dbHandl
+	s.userID = userID
+	return &s
+}
+
+// UserID возвращает пользователя, к задачам которого обращаются запросы Storage.
+func (dbHandl *Storage) UserID() int64 {
+	return dbHandl.userID
+}
+
+// AddUser сохраняет пользователя с логином login и хешем пароля hash и возвращает его ID.
+// Возвращает ErrUserExists, если логин уже занят. Логины сравниваются без учёта регистра.
+func (dbHandl *Storage) AddUser(ctx context.Context, login, hash string, now time.Time) (int64, error) {
+	ctx, cancel := dbHandl.withTimeout(ctx)
+	defer cancel()
+
+	res, err := dbHandl.db.ExecContext(ctx, "INSERT OR IGNORE INTO users (login, password_hash, created_at) VALUES (:login, :hash, :created_at)",
+		sql.Named("login", login), sql.Named("hash", hash), sql.Named("created_at", now.UTC().Format(time.RFC3339)))
+	if err != nil {
+		return 0, wrapErr(err)
+	}
+	affected, _ := res.RowsAffected()
+	if affected != 1 {
+		return 0, ErrUserExists
+	}
+	return res.LastInsertId()
+}
+
+// GetUserByLogin возвращает пользователя с логином login или ErrUserNotFound.
+func (dbHandl *Storage) GetUserByLogin(ctx context.Context, login string) (User, error) {
+	ctx, cancel := dbHandl.withTimeout(ctx)
+	defer cancel()
+
+	var user User
+	err := dbHandl.db.QueryRowContext(ctx, "SELECT id, login, password_hash, created_at FROM users WHERE login = :login",
+		sql.Named("login", login)).Scan(&user.ID, &user.Login, &user.PasswordHash, &user.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return User{}, ErrUserNotFound
+	}
+	if err != nil {
+		return User{}, wrapErr(err)
+	}
+	return user, nil
+}
+
+// GetUser возвращает пользователя Storage или ErrUserNotFound. У пользователя DefaultUserID нет учётной записи.
+func (dbHandl *Storage) GetUser(ctx context.Context) (User, error) {
+	ctx, cancel := dbHandl.withTimeout(ctx)
+	defer cancel()
+
+	var user User
+	err := dbHandl.db.QueryRowContext(ctx, "SELECT id, login, password_hash, created_at FROM users WHERE id = :id",
+		sql.Named("id", dbHandl.userID)).Scan(&user.ID, &user.Login, &user.PasswordHash, &user.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return User{}, ErrUserNotFound
+	}
+	if err != nil {
+		return User{}, wrapErr(err)
+	}
+	return user, nil
+}
@@ -0,0 +1,215 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+// webhooks.go содержит подписки webhook и очередь их доставки outbox
+
+// ErrWebhookNotFound возвращается, если webhook с указанным ID не существует.
+var ErrWebhookNotFound = errors.New("webhook не найден")
+
+// Статусы доставки события webhook
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+// Webhook описывает подписку на события задач. Secret используется для подписи HMAC и возвращается только при создании.
+type Webhook struct {
+	ID        string   `json:"id"`
+	URL       string   `json:"url"`
+	Events    []string `json:"events"`
+	Secret    string   `json:"secret,omitempty"`
+	CreatedAt string   `json:"created_at"`
+}
+
+// OutboxItem описывает событие, ожидающее доставки на webhook
+type OutboxItem struct {
+	ID        string
+	WebhookID string
+	URL       string
+	Secret    string
+	Event     string
+	Payload   []byte
+	Attempts  int
+}
+
+// Delivery описывает одну попытку доставки события на webhook
+type Delivery struct {
+	ID         string `json:"id"`
+	OutboxID   string `json:"outbox_id"`
+	Event      string `json:"event"`
+	Attempt    int    `json:"attempt"`
+	StatusCode int    `json:"status_code,omitempty"`
+	Error      string `json:"error,omitempty"`
+	Status     string `json:"status"`
+	CreatedAt  string `json:"created_at"`
+}
+
+// AddWebhook сохраняет подписку webhook пользователя Storage и возвращает её ID.
+func (dbHandl *Storage) AddWebhook(ctx context.Context, webhook Webhook, now time.Time) (string, error) {
+	ctx, cancel := dbHandl.withTimeout(ctx)
+	defer cancel()
+
+	var id string
+	row := dbHandl.db.QueryRowContext(ctx, "INSERT INTO webhooks (url, secret, events, created_at, user_id) VALUES (:url, :secret, :events, :created_at, :user_id) RETURNING id",
+		sql.Named("url", webhook.URL), sql.Named("secret", webhook.Secret), sql.Named("user_id", dbHandl.userID),
+		sql.Named("events", strings.Join(webhook.Events, ",")), sql.Named("created_at", now.UTC().Format(time.RFC3339)))
+	err := row.Scan(&id)
+	if err != nil {
+		return "", wrapErr(err)
+	}
+	return id, nil
+}
+
+// GetWebhooks возвращает все подписки webhook пользователя Storage без секретов.
+func (dbHandl *Storage) GetWebhooks(ctx context.Context) ([]Webhook, error) {
+	ctx, cancel := dbHandl.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := dbHandl.db.QueryContext(ctx, "SELECT id, url, events, created_at FROM webhooks WHERE user_id = :user_id ORDER BY id",
+		sql.Named("user_id", dbHandl.userID))
+	if err != nil {
+		return nil, wrapErr(err)
+	}
+	defer rows.Close()
+
+	webhooks := []Webhook{}
+	for rows.Next() {
+		var webhook Webhook
+		var events string
+		err = rows.Scan(&webhook.ID, &webhook.URL, &events, &webhook.CreatedAt)
+		if err != nil {
+			return nil, wrapErr(err)
+		}
+		webhook.Events = strings.Split(events, ",")
+		webhooks = append(webhooks, webhook)
+	}
+	return webhooks, wrapErr(rows.Err())
+}
+
+// DeleteWebhook удаляет подписку webhook вместе с её очередью и журналом доставки.
+func (dbHandl *Storage) DeleteWebhook(ctx context.Context, id string) error {
+	ctx, cancel := dbHandl.withTimeout(ctx)
+	defer cancel()
+
+	res, err := dbHandl.db.ExecContext(ctx, "DELETE FROM webhooks WHERE id = :id AND user_id = :user_id",
+		sql.Named("id", id), sql.Named("user_id", dbHandl.userID))
+	if err != nil {
+		return wrapErr(err)
+	}
+	affected, _ := res.RowsAffected()
+	if affected != 1 {
+		return ErrWebhookNotFound
+	}
+	return nil
+}
+
+// EnqueueEvent добавляет событие event с телом payload в очередь доставки каждого webhook пользователя Storage,
+// подписанного на event.
+// Возвращает количество добавленных в очередь доставок.
+func (dbHandl *Storage) EnqueueEvent(ctx context.Context, event string, payload []byte, now time.Time) (int, error) {
+	ctx, cancel := dbHandl.withTimeout(ctx)
+	defer cancel()
+
+	res, err := dbHandl.db.ExecContext(ctx, `INSERT INTO webhook_outbox (webhook_id, event, payload, status, attempts, next_attempt_at, created_at)
+		SELECT id, :event, :payload, :status, 0, :now, :now FROM webhooks WHERE user_id = :user_id AND ',' || events || ',' LIKE '%,' || :event || ',%'`,
+		sql.Named("event", event), sql.Named("user_id", dbHandl.userID), sql.Named("payload", string(payload)),
+		sql.Named("status", DeliveryPending), sql.Named("now", now.UTC().Format(time.RFC3339)))
+	if err != nil {
+		return 0, wrapErr(err)
+	}
+	affected, _ := res.RowsAffected()
+	return int(affected), nil
+}
+
+// DueOutbox возвращает не больше limit событий, время доставки которых наступило к now.
+func (dbHandl *Storage) DueOutbox(ctx context.Context, now time.Time, limit int) ([]OutboxItem, error) {
+	ctx, cancel := dbHandl.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := dbHandl.db.QueryContext(ctx, `SELECT o.id, o.webhook_id, w.url, w.secret, o.event, o.payload, o.attempts
+		FROM webhook_outbox o JOIN webhooks w ON w.id = o.webhook_id
+		WHERE o.status = :status AND o.next_attempt_at <= :now ORDER BY o.id LIMIT :limit`,
+		sql.Named("status", DeliveryPending), sql.Named("now", now.UTC().Format(time.RFC3339)), sql.Named("limit", limit))
+	if err != nil {
+		return nil, wrapErr(err)
+	}
+	defer rows.Close()
+
+	var items []OutboxItem
+	for rows.Next() {
+		var item OutboxItem
+		var payload string
+		err = rows.Scan(&item.ID, &item.WebhookID, &item.URL, &item.Secret, &item.Event, &payload, &item.Attempts)
+		if err != nil {
+			return nil, wrapErr(err)
+		}
+		item.Payload = []byte(payload)
+		items = append(items, item)
+	}
+	return items, wrapErr(rows.Err())
+}
+
+// RecordDelivery записывает попытку доставки события item в журнал и обновляет его состояние в очереди.
+// Если status равен DeliveryPending, следующая попытка будет не раньше nextAttempt.
+func (dbHandl *Storage) RecordDelivery(ctx context.Context, item OutboxItem, statusCode int, deliveryErr string, status string, now, nextAttempt time.Time) error {
+	return dbHandl.WithTx(ctx, func(tx *Storage) error {
+		queryCtx, cancel := tx.withTimeout(ctx)
+		defer cancel()
+
+		_, err := tx.db.ExecContext(queryCtx, "UPDATE webhook_outbox SET attempts = attempts + 1, status = :status, last_error = :error, next_attempt_at = :next WHERE id = :id",
+			sql.Named("status", status), sql.Named("error", deliveryErr),
+			sql.Named("next", nextAttempt.UTC().Format(time.RFC3339)), sql.Named("id", item.ID))
+		if err != nil {
+			return wrapErr(err)
+		}
+		_, err = tx.db.ExecContext(queryCtx, `INSERT INTO webhook_deliveries (outbox_id, webhook_id, event, attempt, status_code, error, status, created_at)
+			VALUES (:outbox_id, :webhook_id, :event, :attempt, :status_code, :error, :status, :created_at)`,
+			sql.Named("outbox_id", item.ID), sql.Named("webhook_id", item.WebhookID), sql.Named("event", item.Event),
+			sql.Named("attempt", item.Attempts+1), sql.Named("status_code", statusCode), sql.Named("error", deliveryErr),
+			sql.Named("status", status), sql.Named("created_at", now.UTC().Format(time.RFC3339)))
+		return wrapErr(err)
+	})
+}
+
+// GetDeliveries возвращает не больше limit последних попыток доставки на webhook с указанным ID.
+func (dbHandl *Storage) GetDeliveries(ctx context.Context, webhookID string, limit int) ([]Delivery, error) {
+	ctx, cancel := dbHandl.withTimeout(ctx)
+	defer cancel()
+
+	var exists bool
+	err := dbHandl.db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM webhooks WHERE id = :id AND user_id = :user_id)",
+		sql.Named("id", webhookID), sql.Named("user_id", dbHandl.userID)).Scan(&exists)
+	if err != nil {
+		return nil, wrapErr(err)
+	}
+	if !exists {
+		return nil, ErrWebhookNotFound
+	}
+
+	rows, err := dbHandl.db.QueryContext(ctx, `SELECT id, outbox_id, event, attempt, status_code, error, status, created_at
+		FROM webhook_deliveries WHERE webhook_id = :id ORDER BY id DESC LIMIT :limit`,
+		sql.Named("id", webhookID), sql.Named("limit", limit))
+	if err != nil {
+		return nil, wrapErr(err)
+	}
+	defer rows.Close()
+
+	deliveries := []Delivery{}
+	for rows.Next() {
+		var d Delivery
+		err = rows.Scan(&d.ID, &d.OutboxID, &d.Event, &d.Attempt, &d.StatusCode, &d.Error, &d.Status, &d.CreatedAt)
+		if err != nil {
+			return nil, wrapErr(err)
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, wrapErr(rows.Err())
+}
@@ -0,0 +1,130 @@
+package i18n
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// i18n.go содержит выбор языка ответа и перевод сообщений.
+// Исходные сообщения в коде написаны на русском и сами являются ключами каталога.
+
+// Lang код языка в формате Accept-Language
+type Lang string
+
+const (
+	RU Lang = "ru"
+	EN Lang = "en"
+)
+
+// Source язык, на котором написаны исходные сообщения
+const Source = RU
+
+var supported = []Lang{RU, EN}
+
+// Default возвращает язык по умолчанию, указанный в TODO_LANG, или русский.
+func Default() Lang {
+	lang := Lang(strings.ToLower(os.Getenv("TODO_LANG")))
+	if slices.Contains(supported, lang) {
+		return lang
+	}
+	return Source
+}
+
+// Parse возвращает поддерживаемый язык с наибольшим весом q из заголовка Accept-Language.
+// Если ни один язык не поддерживается, возвращает язык по умолчанию.
+func Parse(acceptLanguage string) Lang {
+	lang := Default()
+	bestQ := 0.0
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if qStr, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			var err error
+			q, err = strconv.ParseFloat(qStr, 64)
+			if err != nil {
+				continue
+			}
+		}
+		// en-US, en_GB и т.п. сводим к основному языку
+		base, _, _ := strings.Cut(strings.ToLower(tag), "-")
+		base, _, _ = strings.Cut(base, "_")
+		if slices.Contains(supported, Lang(base)) && q > bestQ {
+			lang = Lang(base)
+			bestQ = q
+		}
+	}
+	return lang
+}
+
+// FromRequest возвращает язык ответа на запрос r.
+func FromRequest(r *http.Request) Lang {
+	return Parse(r.Header.Get("Accept-Language"))
+}
+
+// FromResponse возвращает язык, выбранный для ответа Middleware, или язык по умолчанию.
+func FromResponse(w http.ResponseWriter) Lang {
+	lang := Lang(w.Header().Get("Content-Language"))
+	if slices.Contains(supported, lang) {
+		return lang
+	}
+	return Default()
+}
+
+// Middleware выбирает язык ответа по заголовку Accept-Language и записывает его в заголовок Content-Language,
+// чтобы обработчики могли перевести сообщения.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Language", string(FromRequest(r)))
+		w.Header().Add("Vary", "Accept-Language")
+		next.ServeHTTP(w, r)
+	})
+}
+
+// T возвращает перевод сообщения msg на язык lang. Если перевода нет, возвращает msg без изменений.
+func T(lang Lang, msg string) string {
+	if lang == Source {
+		return msg
+	}
+	if translated, ok := messages[lang][msg]; ok {
+		return translated
+	}
+	return msg
+}
+
+// Err возвращает сообщение ошибки err на языке lang. Если для сообщения err нет перевода, например потому что
+// ошибка обёрнута или содержит подробности, возвращает перевод первой ошибки из цепочки errors.Unwrap,
+// для которой он есть. Если перевода нет ни для одной ошибки, возвращает err.Error() без изменений.
+func Err(lang Lang, err error) string {
+	if lang == Source {
+		return err.Error()
+	}
+	if translated, ok := lookup(lang, err); ok {
+		return translated
+	}
+	return err.Error()
+}
+
+// lookup ищет перевод на язык lang для err и ошибок, которые она оборачивает
+func lookup(lang Lang, err error) (string, bool) {
+	if err == nil {
+		return "", false
+	}
+	if translated, ok := messages[lang][err.Error()]; ok {
+		return translated, true
+	}
+	switch wrapped := err.(type) {
+	case interface{ Unwrap() []error }:
+		for _, inner := range wrapped.Unwrap() {
+			if translated, ok := lookup(lang, inner); ok {
+				return translated, true
+			}
+		}
+	default:
+		return lookup(lang, errors.Unwrap(err))
+	}
+	return "", false
+}
@@ -0,0 +1,177 @@
+package i18n
+
+// messages.go содержит каталог переводов сообщений api.
+// Ключом является исходное сообщение на русском языке.
+
+var messages = map[Lang]map[string]string{
+	EN: {
+		// api
+		"неправильный пароль":                     "wrong password",
+		"пустая строка вместо password":           "password must not be empty",
+		"некорректный формат id":                  "invalid id format",
+		"некорректный формат JSON":                "invalid JSON",
+		"требуется авторизация":                   "authentication required",
+		"слишком много запросов, повторите позже": "too many requests, try again later",
+		"ошибка авторизации":                      "authentication failed",
+		"метод не поддерживается":                 "method not allowed",
+		"не указан заголовок If-Match":            "If-Match header is required",
+		"недействительный токен":                  "invalid token",
+		"не указан refresh_token":                 "refresh_token is required",
+		"внутренняя ошибка сервера":               "internal server error",
+		"слишком большое тело запроса":            "request body too large",
+		"регистрация закрыта, добавить пользователя может только вошедший пользователь": "registration is closed, only a signed-in user can add users",
+
+		// пакетные операции
+		"не указаны операции":              "operations are required",
+		"слишком много операций в запросе": "too many operations in the request",
+		"не указана версия задачи":         "task version is required",
+		"неизвестная операция":             "unknown operation",
+		"не указана задача":                "task is required",
+
+		// webhook
+		"некорректный адрес webhook":  "invalid webhook url",
+		"не указаны события webhook":  "webhook events are required",
+		"неизвестное событие webhook": "unknown webhook event",
+		"webhook не найден":           "webhook not found",
+
+		// пользователи
+		"логин должен содержать от 3 до 32 латинских букв, цифр и символов _ . -": "login must contain 3 to 32 latin letters, digits and _ . - characters",
+		"пароль должен содержать не меньше 8 символов":                            "password must contain at least 8 characters",
+		"пароль должен быть не длиннее 72 байт":                                   "password must not be longer than 72 bytes",
+		"пользователь уже существует":                                             "user already exists",
+
+		// списки задач
+		"недостаточно прав":                  "permission denied",
+		"список задач не найден":             "task list not found",
+		"участник списка не найден":          "list member not found",
+		"в списке должен остаться владелец":  "the list must keep an owner",
+		"приглашение не найдено или истекло": "invite not found or expired",
+		"не указано название списка":         "list name is required",
+		"неизвестная роль":                   "unknown role",
+		"некорректный формат user_id":        "invalid user_id format",
+		"не указан token приглашения":        "invite token is required",
+
+		// API токены
+		"у токена нет нужного права":  "token does not have the required scope",
+		"токен не найден":             "token not found",
+		"не указано название токена":  "token name is required",
+		"не указаны права токена":     "token scopes are required",
+		"неизвестное право токена":    "unknown token scope",
+		"недействительный CSRF токен": "invalid CSRF token",
+
+		// двухфакторная аутентификация
+		"двухфакторная аутентификация не настроена": "two-factor authentication is not set up",
+		"двухфакторная аутентификация уже включена": "two-factor authentication is already enabled",
+		"неверный код подтверждения":                "invalid verification code",
+		"не указан код подтверждения":               "verification code is required",
+
+		// журнал аудита
+		"неизвестное действие журнала аудита":          "unknown audit log action",
+		"некорректное время, ожидается формат RFC3339": "invalid time, expected RFC3339 format",
+		"некорректное количество записей":              "invalid number of entries",
+
+		// проверка запросов по спецификации OpenAPI
+		"обязательное поле не указано":      "required field is missing",
+		"некорректный тип значения":         "invalid value type",
+		"значение не соответствует формату": "value does not match the format",
+		"слишком короткое значение":         "value is too short",
+		"слишком длинное значение":          "value is too long",
+		"недопустимое значение":             "value is not allowed",
+
+		// db
+		"задача не найдена":                    "task not found",
+		"конфликт при изменении задачи":        "conflict while changing the task",
+		"некорректный формат ID":               "invalid id format",
+		"не указан заголовок задачи":           "task title is required",
+		"неизвестный срок задачи":              "unknown task status",
+		"неизвестное поле задачи":              "unknown task field",
+		"задача была изменена после чтения":    "task was changed after it was read",
+		"превышено время ожидания базы данных": "database query timed out",
+		"запрос отменён":                       "request canceled",
+
+		// nextdate
+		"нельзя пропустить задачу без правила повторения": "cannot skip a task without a repeat rule",
+		"можно пропустить только будущую дату задачи":     "only a future date of the task can be skipped",
+		"не удалось найти дату задачи без исключений":     "failed to find a task date that is not skipped",
+		"нельзя отложить задачу на прошедшую дату":        "cannot snooze a task to a past date",
+		"некорректный формат даты":                        "invalid date format",
+		"пустая строка в repeat":                          "repeat must not be empty",
+		"некорректный формат repeat":                      "invalid repeat format",
+		"некорректный формат w":                           "invalid weekly repeat format",
+		"слишком большой временной промежуток":            "interval is too long",
+		"ошибка вычисления дней недели":                   "failed to calculate weekdays",
+		"ошибка в вычисление ближайшего дня":              "failed to calculate the closest day",
+		"пустая строка в text":                            "text must not be empty",
+		"некорректный интервал повторения":                "invalid repeat interval",
+		"некорректный день месяца":                        "invalid day of month",
+		"не удалось распознать правило повторения":        "failed to recognize the repeat rule",
+	},
+}
+
+// webMessages содержит каталог переводов строк интерфейса из web/
+var webMessages = map[Lang]map[string]string{
+	EN: {
+		"Планировщик задач": "Task scheduler",
+		"Введите пароль":    "Enter password",
+		"Войти":             "Sign in",
+		"Вы действительно хотите удалить задачу?": "Do you really want to delete the task?",
+		"Выполнить": "Done",
+		"Да":        "Yes",
+		"Нет":       "No",
+		"Дата":      "Date",
+		"Дни месяца (через запятую)": "Days of month (comma separated)",
+		"Дни недели":                 "Weekdays",
+		"Добавить задачу":            "Add task",
+		"Добавить новую задачу":      "Add a new task",
+		"Ежегодно":                   "Yearly",
+		"Ежемесячно":                 "Monthly",
+		"Еженедельно":                "Weekly",
+		"Задача":                     "Task",
+		"Задачи не найдены":          "No tasks found",
+		"Закрыть":                    "Close",
+		"Заполните поле: ":           "Fill in the field: ",
+		"Заполните поля: ":           "Fill in the fields: ",
+		"Информация":                 "Information",
+		"Каждые X дней":              "Every X days",
+		"Карточка задачи":            "Task card",
+		"Комментарий":                "Comment",
+		"Месяцы":                     "Months",
+		"Найти":                      "Search",
+		"Не повторять":               "Do not repeat",
+		"ОК":                         "OK",
+		"Отмена":                     "Cancel",
+		"Отменить":                   "Cancel",
+		"Ошибка":                     "Error",
+		"Пароль":                     "Password",
+		"Повторять с интервалом":     "Repeat with interval",
+		"Подтверждение":              "Confirmation",
+		"Поиск...":                   "Search...",
+		"Последний день месяца":      "Last day of month",
+		"Предпоследний день месяца":  "Second to last day of month",
+		"Правило повторения":         "Repeat rule",
+		"Редактировать":              "Edit",
+		"Сохранить":                  "Save",
+		"Удалить":                    "Delete",
+		"пн":                         "mo",
+		"вт":                         "tu",
+		"ср":                         "we",
+		"чт":                         "th",
+		"пт":                         "fr",
+		"сб":                         "sa",
+		"вс":                         "su",
+		"пн|вт|ср|чт|пт|сб|вс":       "mo|tu|we|th|fr|sa|su",
+		"январь":                     "January",
+		"февраль":                    "February",
+		"март":                       "March",
+		"апрель":                     "April",
+		"май":                        "May",
+		"июнь":                       "June",
+		"июль":                       "July",
+		"август":                     "August",
+		"сентябрь":                   "September",
+		"октябрь":                    "October",
+		"ноябрь":                     "November",
+		"декабрь":                    "December",
+		"январь|февраль|март|апрель|май|июнь|июль|август|сентябрь|октябрь|ноябрь|декабрь": "January|February|March|April|May|June|July|August|September|October|November|December",
+	},
+}
@@ -0,0 +1,61 @@
+package i18n
+
+import (
+	"bytes"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// web.go содержит раздачу файлов web/ с переводом строк интерфейса
+
+// FileServer работает как http.FileServer, но переводит строки интерфейса в html и js файлах
+// на язык, выбранный по заголовку Accept-Language.
+func FileServer(root string) http.Handler {
+	fileServer := http.FileServer(http.Dir(root))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lang := FromRequest(r)
+		name := r.URL.Path
+		if strings.HasSuffix(name, "/") {
+			name += "index.html"
+		}
+		ext := path.Ext(name)
+		if lang == Source || (ext != ".html" && ext != ".js") {
+			fileServer.ServeHTTP(w, r)
+			return
+		}
+
+		fileName := filepath.Join(root, filepath.FromSlash(path.Clean("/"+name)))
+		info, err := os.Stat(fileName)
+		if err != nil || info.IsDir() {
+			fileServer.ServeHTTP(w, r)
+			return
+		}
+		content, err := os.ReadFile(fileName)
+		if err != nil {
+			fileServer.ServeHTTP(w, r)
+			return
+		}
+
+		http.ServeContent(w, r, name, info.ModTime(), bytes.NewReader(translateWeb(lang, content)))
+	})
+}
+
+// translateWeb заменяет строки интерфейса в содержимом файла на их перевод.
+// Заменяются только строки в кавычках и текст между тегами, чтобы не задеть код.
+func translateWeb(lang Lang, content []byte) []byte {
+	catalog, ok := webMessages[lang]
+	if !ok {
+		return content
+	}
+	pairs := []string{`lang="` + string(Source) + `"`, `lang="` + string(lang) + `"`}
+	for src, translated := range catalog {
+		pairs = append(pairs,
+			`"`+src+`"`, `"`+translated+`"`,
+			`>`+src+`<`, `>`+translated+`<`,
+		)
+	}
+	return []byte(strings.NewReplacer(pairs...).Replace(string(content)))
+}
@@ -18,6 +18,6 @@ func calcD(code string) (string, error) {
 	for nextDateDT.Before(now) || nextDateDT.Equal(now) {
 		nextDateDT = nextDateDT.AddDate(0, 0, days)
 	}
-	nextDate = nextDateDT.Format(dateFormat)
+	nextDate = nextDateDT.Format(format)
 	return nextDate, nil
 }
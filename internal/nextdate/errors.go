@@ -0,0 +1,32 @@
+package nextdate
+
+import (
+	"errors"
+)
+
+// ErrInvalidDate возвращается, если дата не соответствует формату TODO_DATEFORMAT.
+var ErrInvalidDate = errors.New("некорректный формат даты")
+
+// ValidationError описывает некорректное значение поля Field, переданного пользователем.
+type ValidationError struct {
+	Field string
+	Err   error
+}
+
+func (e *ValidationError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// NewValidationError возвращает ValidationError для поля field.
+// Если err уже является ValidationError, возвращает её без изменений.
+func NewValidationError(field string, err error) error {
+	var valErr *ValidationError
+	if errors.As(err, &valErr) {
+		return err
+	}
+	return &ValidationError{Field: field, Err: err}
+}
@@ -163,7 +163,7 @@ func calcM(code string) (string, error) {
 		return "", fmt.Errorf("ошибка в case m")
 	}
 
-	nextDate = time.Date(nextYear, time.Month(nextMonth), nextDay, 0, 0, 0, 0, time.UTC).Format(dateFormat)
+	nextDate = time.Date(nextYear, time.Month(nextMonth), nextDay, 0, 0, 0, 0, time.UTC).Format(format)
 	return nextDate, nil
 }
 
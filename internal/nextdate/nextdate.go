@@ -6,34 +6,51 @@ import (
 	"slices"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
 // переменные используемые всеми функциями в этом package
 var (
-	startDate  time.Time
-	now        time.Time
-	nextDate   string
+	// mu защищает переменные вычисления даты: NextDate одновременно вызывают обработчики запросов и фоновая обработка задач
+	mu        sync.Mutex
+	startDate time.Time
+	now       time.Time
+	nextDate  string
+	// format формат дат текущего вычисления, полученный из layout
+	format string
+
+	// formatMu защищает dateFormat при первом чтении формата из переменной среды
+	formatMu   sync.Mutex
 	dateFormat string
 )
 
-// NextDate возвращает дату и ошибку, исходя из правил указанных в repeat.
-func NextDate(nowArg time.Time, date string, repeat string) (string, error) {
-	// Если dateFormat ещё не инициализирована, берём её из .env файла
+// layout возвращает формат дат из переменной TODO_DATEFORMAT. Формат читается из .env файла при первом вызове.
+func layout() string {
+	formatMu.Lock()
+	defer formatMu.Unlock()
 	if len(dateFormat) == 0 {
 		dateFormat = os.Getenv("TODO_DATEFORMAT")
 	}
+	return dateFormat
+}
+
+// NextDate возвращает дату и ошибку, исходя из правил указанных в repeat.
+func NextDate(nowArg time.Time, date string, repeat string) (string, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	format = layout()
 
 	var err error
 
 	if repeat == "" {
-		return "", fmt.Errorf("пустая строка в repeat")
+		return "", NewValidationError("repeat", fmt.Errorf("пустая строка в repeat"))
 	}
 
 	now = nowArg
-	startDate, err = time.Parse(dateFormat, date)
+	startDate, err = time.Parse(format, date)
 	if err != nil {
-		return "", err
+		return "", NewValidationError("date", ErrInvalidDate)
 	}
 
 	repeat = strings.ToLower(repeat)
@@ -51,10 +68,11 @@ func NextDate(nowArg time.Time, date string, repeat string) (string, error) {
 	case "m":
 		_, err = calcM(code)
 	default:
-		return "", fmt.Errorf("некорректный формат repeat")
+		return "", NewValidationError("repeat", fmt.Errorf("некорректный формат repeat"))
 	}
+	// Все ошибки вычисления вызваны некорректным правилом repeat
 	if err != nil {
-		return "", err
+		return "", NewValidationError("repeat", err)
 	}
 
 	return nextDate, nil
@@ -0,0 +1,239 @@
+package nextdate
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// parse.go содержит разбор фраз на естественном языке (русском и английском) в пару date и repeat
+
+// weekdays сопоставляет названия дней недели их номерам в правиле repeat "w"
+var weekdays = map[string]int{
+	"monday": 1, "mondays": 1, "mon": 1,
+	"tuesday": 2, "tuesdays": 2, "tue": 2,
+	"wednesday": 3, "wednesdays": 3, "wed": 3,
+	"thursday": 4, "thursdays": 4, "thu": 4,
+	"friday": 5, "fridays": 5, "fri": 5,
+	"saturday": 6, "saturdays": 6, "sat": 6,
+	"sunday": 7, "sundays": 7, "sun": 7,
+	"понедельник": 1, "понедельникам": 1, "пн": 1,
+	"вторник": 2, "вторникам": 2, "вт": 2,
+	"среда": 3, "среду": 3, "средам": 3, "ср": 3,
+	"четверг": 4, "четвергам": 4, "чт": 4,
+	"пятница": 5, "пятницу": 5, "пятницам": 5, "пт": 5,
+	"суббота": 6, "субботу": 6, "субботам": 6, "сб": 6,
+	"воскресенье": 7, "воскресеньям": 7, "вс": 7,
+}
+
+// relativeDays сопоставляет словам смещение в днях относительно сегодняшнего дня
+var relativeDays = map[string]int{
+	"today":                  0,
+	"сегодня":                0,
+	"tomorrow":               1,
+	"завтра":                 1,
+	"day after tomorrow":     2,
+	"the day after tomorrow": 2,
+	"послезавтра":            2,
+	"yesterday":              -1,
+	"вчера":                  -1,
+}
+
+var (
+	// "in 3 days", "через 3 дня", "+3", "+3d"
+	inDaysRe = regexp.MustCompile(`^(?:in\s+(\d+)\s+days?|через\s+(\d+)\s+(?:день|дня|дней)|\+(\d+)\s*d?)$`)
+	// "every 3 days", "каждые 3 дня", "раз в 3 дня"
+	everyNDaysRe = regexp.MustCompile(`(?:every\s+(\d+)\s+days?|каждые\s+(\d+)\s+(?:дня|дней)|раз\s+в\s+(\d+)\s+(?:дня|дней))`)
+	// "on the 15th", "15th day of month", "15 числа", "15-го числа"
+	monthDayRe = regexp.MustCompile(`\b(\d{1,2})(?:st|nd|rd|th|-?го|-?е)?(?:\s+day)?(?:\s+of\s+(?:the\s+)?month|\s+числа|\s+число)`)
+	wordRe     = regexp.MustCompile(`[\p{L}]+`)
+)
+
+// RelativeDate возвращает дату, заданную словом вида "today", "завтра" или "через 3 дня" относительно nowArg.
+// Второе значение равно false, если строка не является относительной датой.
+func RelativeDate(text string, nowArg time.Time) (time.Time, bool) {
+	text = normalize(text)
+	if days, ok := relativeDays[text]; ok {
+		return nowArg.AddDate(0, 0, days), true
+	}
+	match := inDaysRe.FindStringSubmatch(text)
+	if match == nil {
+		return time.Time{}, false
+	}
+	for _, group := range match[1:] {
+		if len(group) == 0 {
+			continue
+		}
+		days, err := strconv.Atoi(group)
+		if err != nil || days > 400 {
+			return time.Time{}, false
+		}
+		return nowArg.AddDate(0, 0, days), true
+	}
+	return time.Time{}, false
+}
+
+// Parse разбирает фразу на естественном языке и возвращает дату начала date и правило повторения repeat.
+// Поддерживаются относительные даты ("tomorrow", "через 2 дня"), ежедневные, еженедельные,
+// ежемесячные и ежегодные повторения ("every monday and thursday", "каждый последний день месяца").
+func Parse(text string, nowArg time.Time) (string, string, error) {
+	dateFormat := layout()
+
+	text = normalize(text)
+	if len(text) == 0 {
+		return "", "", NewValidationError("text", fmt.Errorf("пустая строка в text"))
+	}
+
+	// Фраза целиком может быть относительной датой без повторения
+	if date, ok := RelativeDate(text, nowArg); ok {
+		return date.Format(dateFormat), "", nil
+	}
+
+	// Дата начала может быть указана отдельным словом внутри фразы: "every day starting tomorrow"
+	// Выбираем самое длинное совпадение, чтобы "day after tomorrow" не распознавалось как "tomorrow"
+	var start time.Time
+	var startWord string
+	for word, days := range relativeDays {
+		if strings.Contains(" "+text+" ", " "+word+" ") && len(word) > len(startWord) {
+			start = nowArg.AddDate(0, 0, days)
+			startWord = word
+		}
+	}
+	startSpecified := len(startWord) > 0
+
+	repeat, err := parseRepeat(text)
+	if err != nil {
+		return "", "", NewValidationError("text", err)
+	}
+
+	if startSpecified {
+		return start.Format(dateFormat), repeat, nil
+	}
+	date, err := firstOccurrence(nowArg, repeat, dateFormat)
+	if err != nil {
+		return "", "", err
+	}
+	return date, repeat, nil
+}
+
+// parseRepeat возвращает правило repeat, описанное во фразе, или ошибку, если правило не распознано
+func parseRepeat(text string) (string, error) {
+	if match := everyNDaysRe.FindStringSubmatch(text); match != nil {
+		for _, group := range match[1:] {
+			if len(group) == 0 {
+				continue
+			}
+			days, err := strconv.Atoi(group)
+			if err != nil || days < 1 || days > 400 {
+				return "", fmt.Errorf("некорректный интервал повторения")
+			}
+			return fmt.Sprintf("d %d", days), nil
+		}
+	}
+
+	words := wordRe.FindAllString(text, -1)
+
+	switch {
+	case containsAny(text, "every day", "daily", "каждый день", "ежедневно"):
+		return "d 1", nil
+	case containsAny(text, "every year", "yearly", "annually", "каждый год", "ежегодно"):
+		return "y", nil
+	}
+
+	// Дни недели
+	var wds []int
+	for _, word := range words {
+		if wd, ok := weekdays[word]; ok && !slices.Contains(wds, wd) {
+			wds = append(wds, wd)
+		}
+	}
+	if len(wds) > 0 {
+		slices.Sort(wds)
+		return "w " + listItoa(wds), nil
+	}
+	if containsAny(text, "every week", "weekly", "каждую неделю", "еженедельно") {
+		return "d 7", nil
+	}
+
+	// Дни месяца
+	var mds []int
+	switch {
+	case containsAny(text, "penultimate day", "second to last day", "предпоследний день"):
+		mds = append(mds, -2)
+	case containsAny(text, "last day", "последний день"):
+		mds = append(mds, -1)
+	}
+	for _, match := range monthDayRe.FindAllStringSubmatch(text, -1) {
+		day, err := strconv.Atoi(match[1])
+		if err != nil || day < 1 || day > 31 {
+			return "", fmt.Errorf("некорректный день месяца")
+		}
+		if !slices.Contains(mds, day) {
+			mds = append(mds, day)
+		}
+	}
+	if len(mds) > 0 {
+		return "m " + listItoa(mds), nil
+	}
+
+	return "", fmt.Errorf("не удалось распознать правило повторения")
+}
+
+// firstOccurrence возвращает первую подходящую под правило repeat дату, начиная с сегодняшнего дня,
+// в формате dateFormat, которым пользуется Parse
+func firstOccurrence(nowArg time.Time, repeat, dateFormat string) (string, error) {
+	switch {
+	case strings.HasPrefix(repeat, "w"):
+		targetWDs, err := listAtoi(strings.Split(strings.TrimPrefix(repeat, "w "), ","))
+		if err != nil {
+			return "", err
+		}
+		for days := range 7 {
+			date := nowArg.AddDate(0, 0, days)
+			// В правиле repeat воскресенье имеет номер 7, а в time.Weekday 0
+			wd := int(date.Weekday())
+			if wd == 0 {
+				wd = 7
+			}
+			if slices.Contains(targetWDs, wd) {
+				return date.Format(dateFormat), nil
+			}
+		}
+		return "", fmt.Errorf("ошибка вычисления дней недели")
+	case strings.HasPrefix(repeat, "m"):
+		// NextDate возвращает дату строго после now, поэтому считаем от вчерашнего дня
+		yesterday := nowArg.AddDate(0, 0, -1)
+		return NextDate(yesterday, yesterday.Format(dateFormat), repeat)
+	default:
+		return nowArg.Format(dateFormat), nil
+	}
+}
+
+// normalize приводит фразу к нижнему регистру и убирает лишние пробелы и знаки препинания
+func normalize(text string) string {
+	text = strings.ToLower(strings.TrimSpace(text))
+	text = strings.NewReplacer(",", " ", ".", " ", ";", " ", "ё", "е").Replace(text)
+	return strings.Join(strings.Fields(text), " ")
+}
+
+// containsAny возвращает true, если строка содержит хотя бы одну из подстрок
+func containsAny(text string, substrs ...string) bool {
+	for _, substr := range substrs {
+		if strings.Contains(text, substr) {
+			return true
+		}
+	}
+	return false
+}
+
+// listItoa конвертирует слайс int в строку с числами через запятую
+func listItoa(list []int) string {
+	strs := make([]string, 0, len(list))
+	for _, num := range list {
+		strs = append(strs, strconv.Itoa(num))
+	}
+	return strings.Join(strs, ",")
+}
@@ -0,0 +1,56 @@
+package nextdate
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// snooze.go содержит разбор даты, на которую откладывается задача
+
+// ErrSnoozePast возвращается, если задачу пытаются отложить на прошедшую дату.
+var ErrSnoozePast = errors.New("нельзя отложить задачу на прошедшую дату")
+
+// snoozeRe описывает сокращения вида "1d", "2w"
+var snoozeRe = regexp.MustCompile(`^(\d{1,3})([dw])$`)
+
+// SnoozeDate возвращает дату, на которую откладывается задача. until может быть датой в формате TODO_DATEFORMAT,
+// сокращением вида "1d", "2w", "next-week" (понедельник следующей недели) или относительной датой вида "tomorrow".
+// Возвращает ошибку, если until не распознано или дата раньше сегодняшней.
+func SnoozeDate(until string, nowArg time.Time) (string, error) {
+	dateFormat := layout()
+
+	today, err := time.Parse(dateFormat, nowArg.Format(dateFormat))
+	if err != nil {
+		return "", err
+	}
+
+	var date time.Time
+	if match := snoozeRe.FindStringSubmatch(until); match != nil {
+		num, _ := strconv.Atoi(match[1])
+		if match[2] == "w" {
+			num *= 7
+		}
+		date = today.AddDate(0, 0, num)
+	} else if until == "next-week" {
+		// В time.Weekday воскресенье имеет номер 0, поэтому считаем дни до понедельника от воскресенья
+		days := 8 - int(today.Weekday())
+		if days > 7 {
+			days -= 7
+		}
+		date = today.AddDate(0, 0, days)
+	} else if relDate, ok := RelativeDate(until, today); ok {
+		date = relDate
+	} else {
+		date, err = time.Parse(dateFormat, until)
+		if err != nil {
+			return "", NewValidationError("until", ErrInvalidDate)
+		}
+	}
+
+	if date.Before(today) {
+		return "", NewValidationError("until", ErrSnoozePast)
+	}
+	return date.Format(dateFormat), nil
+}
@@ -36,7 +36,7 @@ func calcW(code string) (string, error) {
 			return "", fmt.Errorf("ошибка вычисления дней недели")
 		}
 	}
-	nextDate = now.AddDate(0, 0, days).Format(dateFormat)
+	nextDate = now.AddDate(0, 0, days).Format(format)
 	return nextDate, err
 
 }
@@ -6,6 +6,6 @@ func calcY() string {
 	for nextDateDT.Before(now) || nextDateDT.Equal(now) {
 		nextDateDT = nextDateDT.AddDate(1, 0, 0)
 	}
-	nextDate = nextDateDT.Format(dateFormat)
+	nextDate = nextDateDT.Format(format)
 	return nextDate
 }
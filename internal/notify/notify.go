@@ -0,0 +1,130 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/AsyaBiryukova/go_final_project/internal/db"
+)
+
+// notify.go содержит события планировщика и интерфейс для их доставки
+
+// Типы событий
+const (
+	// EventTaskDue наступила дата задачи
+	EventTaskDue = "task.due"
+	// EventTaskCreated добавлена задача
+	EventTaskCreated = "task.created"
+	// EventTaskUpdated изменена задача
+	EventTaskUpdated = "task.updated"
+	// EventTaskCompleted задача отмечена выполненной
+	EventTaskCompleted = "task.completed"
+	// EventTaskDeleted задача удалена, в событии передаётся только её ID
+	EventTaskDeleted = "task.deleted"
+)
+
+// Event описывает событие, связанное с задачей
+type Event struct {
+	Type string    `json:"type"`
+	Task db.Task   `json:"task"`
+	Time time.Time `json:"time"`
+}
+
+// Notifier доставляет события пользователю, например в журнал, по почте или через webhook.
+type Notifier interface {
+	Notify(ctx context.Context, event Event) error
+}
+
+// Digest описывает сводку задач на день: задачи на сегодня и просроченные задачи
+type Digest struct {
+	Date    string    `json:"date"`
+	Today   []db.Task `json:"today"`
+	Overdue []db.Task `json:"overdue"`
+	Time    time.Time `json:"time"`
+}
+
+// DigestNotifier доставляет пользователю ежедневную сводку задач.
+type DigestNotifier interface {
+	NotifyDigest(ctx context.Context, digest Digest) error
+}
+
+// Log записывает события в журнал сервера. Используется, если другие способы доставки не настроены.
+type Log struct{}
+
+// Notify записывает событие event в журнал
+func (Log) Notify(ctx context.Context, event Event) error {
+	log.Printf("%s: задача %s %q на %s", event.Type, event.Task.ID, event.Task.Title, event.Task.Date)
+	return nil
+}
+
+// NotifyDigest записывает в журнал количество задач в сводке digest
+func (Log) NotifyDigest(ctx context.Context, digest Digest) error {
+	log.Printf("сводка на %s: задач на сегодня %d, просроченных %d", digest.Date, len(digest.Today), len(digest.Overdue))
+	return nil
+}
+
+// Multi доставляет события через все свои Notifier по очереди.
+type Multi []Notifier
+
+// Notify передаёт событие каждому Notifier. Ошибка одного из них не останавливает доставку остальным,
+// возвращаются все ошибки вместе.
+func (m Multi) Notify(ctx context.Context, event Event) error {
+	var errs []error
+	for _, notifier := range m {
+		if err := notifier.Notify(ctx, event); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// NotifyDigest передаёт сводку каждому Notifier, который реализует DigestNotifier.
+func (m Multi) NotifyDigest(ctx context.Context, digest Digest) error {
+	var errs []error
+	for _, notifier := range m {
+		digestNotifier, ok := notifier.(DigestNotifier)
+		if !ok {
+			continue
+		}
+		if err := digestNotifier.NotifyDigest(ctx, digest); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Members доставляет события участникам общего списка задачи через notifier, который отправляет событие
+// пользователю Task.UserID, например webhook или поток api/events. Событие о задаче списка отправляется каждому
+// участнику отдельно с Task.UserID, равным участнику, а событие о личной задаче — только её владельцу.
+type Members struct {
+	storage  *db.Storage
+	notifier Notifier
+}
+
+// NewMembers возвращает Members, который получает участников списков из storage и доставляет события через notifier.
+func NewMembers(storage *db.Storage, notifier Notifier) *Members {
+	return &Members{storage: storage, notifier: notifier}
+}
+
+// Notify передаёт событие каждому получателю. Ошибка доставки одному из них не останавливает доставку остальным,
+// возвращаются все ошибки вместе.
+func (m *Members) Notify(ctx context.Context, event Event) error {
+	recipients := []int64{event.Task.UserID}
+	if len(event.Task.ListID) > 0 {
+		var err error
+		recipients, err = m.storage.GetMemberIDs(ctx, event.Task.ListID)
+		if err != nil {
+			return err
+		}
+	}
+	var errs []error
+	for _, userID := range recipients {
+		event.Task.UserID = userID
+		if err := m.notifier.Notify(ctx, event); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
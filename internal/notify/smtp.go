@@ -0,0 +1,247 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"embed"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/AsyaBiryukova/go_final_project/internal/db"
+)
+
+// smtp.go содержит отправку напоминаний и ежедневной сводки задач по почте
+
+// sendTimeout ограничивает время отправки одного письма, если в контексте не задан срок
+const sendTimeout = time.Second * 30
+
+//go:embed templates
+var templatesFS embed.FS
+
+// Шаблоны писем. Для каждого письма есть текстовый шаблон *.txt и HTML шаблон *.html.
+var (
+	templateFuncs = map[string]any{"date": formatDate}
+	textTemplates = texttemplate.Must(texttemplate.New("").Funcs(templateFuncs).ParseFS(templatesFS, "templates/*.txt"))
+	htmlTemplates = htmltemplate.Must(htmltemplate.New("").Funcs(templateFuncs).ParseFS(templatesFS, "templates/*.html"))
+)
+
+// SMTPConfig содержит настройки отправки писем
+type SMTPConfig struct {
+	// Addr адрес SMTP сервера в формате host:port
+	Addr string
+	// Username и Password используются для авторизации PLAIN, если Username не пустой
+	Username string
+	Password string
+	// From адрес отправителя
+	From string
+	// To адреса получателей
+	To []string
+}
+
+// SMTPConfigFromEnv возвращает настройки отправки писем из переменных TODO_SMTP_ADDR, TODO_SMTP_USER,
+// TODO_SMTP_PASSWORD, TODO_SMTP_FROM и TODO_SMTP_TO (адреса получателей через запятую).
+// Если TODO_SMTP_ADDR не задана, возвращает пустые настройки, и письма не отправляются.
+func SMTPConfigFromEnv() (SMTPConfig, error) {
+	cfg := SMTPConfig{
+		Addr:     os.Getenv("TODO_SMTP_ADDR"),
+		Username: os.Getenv("TODO_SMTP_USER"),
+		Password: os.Getenv("TODO_SMTP_PASSWORD"),
+		From:     os.Getenv("TODO_SMTP_FROM"),
+	}
+	if len(cfg.Addr) == 0 {
+		return SMTPConfig{}, nil
+	}
+	if _, _, err := net.SplitHostPort(cfg.Addr); err != nil {
+		return SMTPConfig{}, fmt.Errorf("некорректное значение TODO_SMTP_ADDR: %q", cfg.Addr)
+	}
+	for _, to := range strings.Split(os.Getenv("TODO_SMTP_TO"), ",") {
+		to = strings.TrimSpace(to)
+		if len(to) > 0 {
+			cfg.To = append(cfg.To, to)
+		}
+	}
+	if len(cfg.From) == 0 {
+		return SMTPConfig{}, errors.New("не указана переменная TODO_SMTP_FROM")
+	}
+	if len(cfg.To) == 0 {
+		return SMTPConfig{}, errors.New("не указана переменная TODO_SMTP_TO")
+	}
+	return cfg, nil
+}
+
+// SMTP отправляет напоминания о задачах и ежедневную сводку по почте. Реализует Notifier и DigestNotifier.
+// У учётных записей нет адресов почты, поэтому письма получают только адреса TODO_SMTP_TO пользователя по умолчанию.
+// Пользователи с учётной записью получают напоминания через webhook и поток api/events.
+type SMTP struct {
+	cfg SMTPConfig
+}
+
+// NewSMTP возвращает SMTP, который отправляет письма с настройками cfg.
+func NewSMTP(cfg SMTPConfig) *SMTP {
+	return &SMTP{cfg: cfg}
+}
+
+// Notify отправляет письмо с напоминанием о задаче для события EventTaskDue. Другие события не отправляются по почте.
+// Получатели TODO_SMTP_TO относятся к пользователю по умолчанию, поэтому задачи других пользователей пропускаются,
+// чтобы не отправлять их на чужие адреса.
+func (s *SMTP) Notify(ctx context.Context, event Event) error {
+	if event.Type != EventTaskDue || event.Task.UserID != db.DefaultUserID {
+		return nil
+	}
+	return s.send(ctx, "Напоминание: "+event.Task.Title, "reminder", event)
+}
+
+// NotifyDigest отправляет письмо со сводкой задач digest.
+func (s *SMTP) NotifyDigest(ctx context.Context, digest Digest) error {
+	return s.send(ctx, "Задачи на "+formatDate(digest.Date), "digest", digest)
+}
+
+// send отправляет всем получателям письмо с темой subject, текстовая и HTML части которого получены из шаблонов name
+func (s *SMTP) send(ctx context.Context, subject, name string, data any) error {
+	msg, err := s.message(subject, name, data)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, sendTimeout)
+		defer cancel()
+	}
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", s.cfg.Addr)
+	if err != nil {
+		return err
+	}
+	deadline, _ := ctx.Deadline()
+	err = conn.SetDeadline(deadline)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	host, _, _ := net.SplitHostPort(s.cfg.Addr)
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		err = client.StartTLS(&tls.Config{ServerName: host})
+		if err != nil {
+			return err
+		}
+	}
+	if len(s.cfg.Username) > 0 {
+		err = client.Auth(smtp.PlainAuth("", s.cfg.Username, s.cfg.Password, host))
+		if err != nil {
+			return err
+		}
+	}
+	err = client.Mail(s.cfg.From)
+	if err != nil {
+		return err
+	}
+	for _, to := range s.cfg.To {
+		err = client.Rcpt(to)
+		if err != nil {
+			return err
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(msg)
+	if err != nil {
+		return err
+	}
+	err = w.Close()
+	if err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// message возвращает письмо в формате multipart/alternative с текстовой и HTML частями
+func (s *SMTP) message(subject, name string, data any) ([]byte, error) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+
+	var text, html bytes.Buffer
+	err := textTemplates.ExecuteTemplate(&text, name+".txt", data)
+	if err != nil {
+		return nil, err
+	}
+	err = htmlTemplates.ExecuteTemplate(&html, name+".html", data)
+	if err != nil {
+		return nil, err
+	}
+	for _, part := range []struct {
+		contentType string
+		content     []byte
+	}{
+		{"text/plain; charset=UTF-8", text.Bytes()},
+		{"text/html; charset=UTF-8", html.Bytes()},
+	} {
+		pw, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qw := quotedprintable.NewWriter(pw)
+		_, err = qw.Write(part.content)
+		if err != nil {
+			return nil, err
+		}
+		err = qw.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = mw.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	var msg bytes.Buffer
+	headers := [][2]string{
+		{"From", s.cfg.From},
+		{"To", strings.Join(s.cfg.To, ", ")},
+		{"Subject", mime.QEncoding.Encode("UTF-8", subject)},
+		{"Date", time.Now().Format(time.RFC1123Z)},
+		{"MIME-Version", "1.0"},
+		{"Content-Type", "multipart/alternative; boundary=" + mw.Boundary()},
+	}
+	for _, h := range headers {
+		fmt.Fprintf(&msg, "%s: %s\r\n", h[0], h[1])
+	}
+	msg.WriteString("\r\n")
+	msg.Write(body.Bytes())
+	return msg.Bytes(), nil
+}
+
+// formatDate возвращает дату задачи в виде 02.01.2006
+func formatDate(date string) string {
+	t, err := time.Parse(db.DateFormat, date)
+	if err != nil {
+		return date
+	}
+	return t.Format("02.01.2006")
+}
@@ -0,0 +1,170 @@
+package ratelimit
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AsyaBiryukova/go_final_project/internal/i18n"
+)
+
+// limiter.go содержит ограничение частоты запросов с одного адреса по алгоритму token bucket
+
+// pruneSize количество адресов, после которого из Limiter и Lockout удаляются неактивные записи
+const pruneSize = 1024
+
+// Rate описывает допустимую частоту запросов: не больше Limit запросов за период Per.
+// Нулевой Rate отключает ограничение.
+type Rate struct {
+	Limit int
+	Per   time.Duration
+}
+
+// ParseRate разбирает частоту запросов в формате N/s, N/m или N/h. Значение 0 отключает ограничение.
+func ParseRate(s string) (Rate, error) {
+	if s == "0" {
+		return Rate{}, nil
+	}
+	limit, unit, ok := strings.Cut(s, "/")
+	n, err := strconv.Atoi(limit)
+	if !ok || err != nil || n <= 0 {
+		return Rate{}, fmt.Errorf("некорректная частота запросов: %q", s)
+	}
+	per := map[string]time.Duration{"s": time.Second, "m": time.Minute, "h": time.Hour}[unit]
+	if per == 0 {
+		return Rate{}, fmt.Errorf("некорректная частота запросов: %q", s)
+	}
+	return Rate{Limit: n, Per: per}, nil
+}
+
+// RateFromEnv возвращает частоту запросов из переменной name в формате ParseRate или def, если переменная не задана.
+func RateFromEnv(name string, def Rate) (Rate, error) {
+	env := os.Getenv(name)
+	if len(env) == 0 {
+		return def, nil
+	}
+	rate, err := ParseRate(env)
+	if err != nil {
+		return Rate{}, fmt.Errorf("некорректное значение %s: %q", name, env)
+	}
+	return rate, nil
+}
+
+// bucket хранит количество доступных запросов одного адреса на момент updated
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// Limiter ограничивает частоту запросов по ключу, например адресу клиента. Каждый ключ получает
+// Rate.Limit запросов, которые восстанавливаются равномерно за период Rate.Per.
+// Нулевой *Limiter пропускает все запросы.
+type Limiter struct {
+	mu      sync.Mutex
+	rate    Rate
+	buckets map[string]*bucket
+}
+
+// NewLimiter создаёт Limiter с частотой rate. Для нулевого rate возвращает nil, который не ограничивает запросы.
+func NewLimiter(rate Rate) *Limiter {
+	if rate.Limit == 0 {
+		return nil
+	}
+	return &Limiter{rate: rate, buckets: make(map[string]*bucket)}
+}
+
+// Allow расходует один запрос ключа key. Если запросов не осталось, возвращает false и время,
+// через которое запрос станет доступен.
+func (l *Limiter) Allow(key string, now time.Time) (bool, time.Duration) {
+	if l == nil {
+		return true, 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(l.buckets) >= pruneSize {
+		l.prune(now)
+	}
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(l.rate.Limit), updated: now}
+		l.buckets[key] = b
+	}
+	b.tokens = l.refill(b, now)
+	b.updated = now
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / float64(l.rate.Limit) * float64(l.rate.Per))
+	}
+	b.tokens--
+	return true, 0
+}
+
+// refill возвращает количество запросов, доступных в bucket к моменту now
+func (l *Limiter) refill(b *bucket, now time.Time) float64 {
+	elapsed := now.Sub(b.updated)
+	if elapsed <= 0 {
+		return b.tokens
+	}
+	return math.Min(float64(l.rate.Limit), b.tokens+elapsed.Seconds()*float64(l.rate.Limit)/l.rate.Per.Seconds())
+}
+
+// prune удаляет ключи, у которых восстановились все запросы, их состояние не отличается от нового ключа
+func (l *Limiter) prune(now time.Time) {
+	for key, b := range l.buckets {
+		if l.refill(b, now) >= float64(l.rate.Limit) {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// Middleware ограничивает частоту запросов с одного адреса клиента. При превышении отвечает статусом
+// Too Many Requests с заголовком Retry-After.
+func (l *Limiter) Middleware(next http.Handler) http.Handler {
+	if l == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ok, retryAfter := l.Allow(ClientIP(r), time.Now())
+		if !ok {
+			WriteTooManyRequests(w, retryAfter)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ClientIP возвращает адрес клиента, выполнившего запрос r, без порта.
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// WriteTooManyRequests пишет в response ошибку в формате JSON со статусом Too Many Requests
+// и заголовком Retry-After, содержащим retryAfter в целых секундах.
+func WriteTooManyRequests(w http.ResponseWriter, retryAfter time.Duration) {
+	resp, err := json.Marshal(map[string]string{
+		"error": i18n.T(i18n.FromResponse(w), "слишком много запросов, повторите позже"),
+		"code":  "too_many_requests",
+	})
+	if err != nil {
+		log.Println(err)
+	}
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	w.WriteHeader(http.StatusTooManyRequests)
+	_, err = w.Write(resp)
+	if err != nil {
+		log.Println(err)
+	}
+}
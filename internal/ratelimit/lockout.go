@@ -0,0 +1,123 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// lockout.go содержит блокировку после серии неудачных попыток с экспоненциально растущим сроком
+
+// lockEntry хранит неудачные попытки одного ключа
+type lockEntry struct {
+	failures    int
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+// Lockout блокирует ключ, например адрес клиента, после threshold неудачных попыток подряд.
+// Первая блокировка длится base, каждая следующая неудачная попытка удваивает срок, но не больше max.
+// Если попыток не было дольше max, счётчик сбрасывается. Нулевой *Lockout ничего не блокирует.
+type Lockout struct {
+	mu        sync.Mutex
+	threshold int
+	base, max time.Duration
+	entries   map[string]*lockEntry
+}
+
+// NewLockout создаёт Lockout. Для threshold 0 возвращает nil, который не блокирует попытки.
+func NewLockout(threshold int, base, max time.Duration) *Lockout {
+	if threshold == 0 {
+		return nil
+	}
+	return &Lockout{threshold: threshold, base: base, max: max, entries: make(map[string]*lockEntry)}
+}
+
+// Attempt учитывает попытку ключа key как неудачную до её проверки, если ключ не заблокирован. Проверка блокировки
+// и учёт попытки выполняются атомарно, поэтому параллельные попытки не проходят проверку блокировки одновременно:
+// после threshold учтённых попыток следующие блокируются, даже если первые ещё проверяются.
+// Возвращает оставшийся срок блокировки, если ключ заблокирован, тогда попытка не учитывается и её нельзя проверять,
+// или 0. Учёт удачной попытки отменяют Reset или Release.
+func (l *Lockout) Attempt(key string, now time.Time) time.Duration {
+	if l == nil {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if lock := l.locked(key, now); lock > 0 {
+		return lock
+	}
+	l.fail(key, now)
+	return 0
+}
+
+// Release отменяет учёт попытки ключа key, которую Attempt учёл как неудачную, а она оказалась удачной или не была
+// проверена. Блокировка снимается, если без этой попытки неудачных попыток меньше threshold.
+func (l *Lockout) Release(key string) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entry, ok := l.entries[key]
+	if !ok {
+		return
+	}
+	entry.failures = max(entry.failures-1, 0)
+	if entry.failures < l.threshold {
+		entry.lockedUntil = time.Time{}
+	}
+}
+
+// locked возвращает оставшийся к now срок блокировки ключа key. Вызывается под l.mu.
+func (l *Lockout) locked(key string, now time.Time) time.Duration {
+	entry, ok := l.entries[key]
+	if !ok || !now.Before(entry.lockedUntil) {
+		return 0
+	}
+	return entry.lockedUntil.Sub(now)
+}
+
+// fail учитывает неудачную попытку ключа key и блокирует ключ, если неудачных попыток не меньше threshold.
+// Вызывается под l.mu.
+func (l *Lockout) fail(key string, now time.Time) {
+	if len(l.entries) >= pruneSize {
+		l.prune(now)
+	}
+	entry, ok := l.entries[key]
+	if !ok || now.Sub(entry.lastFailure) > l.max {
+		entry = &lockEntry{}
+		l.entries[key] = entry
+	}
+	entry.failures++
+	entry.lastFailure = now
+	if entry.failures < l.threshold {
+		return
+	}
+
+	lock := l.base
+	for i := l.threshold; i < entry.failures && lock < l.max; i++ {
+		lock *= 2
+	}
+	entry.lockedUntil = now.Add(min(lock, l.max))
+}
+
+// Reset сбрасывает неудачные попытки ключа key после успешной попытки.
+func (l *Lockout) Reset(key string) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.entries, key)
+}
+
+// prune удаляет ключи, счётчик которых был бы сброшен при следующей попытке
+func (l *Lockout) prune(now time.Time) {
+	for key, entry := range l.entries {
+		if now.Sub(entry.lastFailure) > l.max {
+			delete(l.entries, key)
+		}
+	}
+}
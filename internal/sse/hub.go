@@ -0,0 +1,152 @@
+package sse
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"sync"
+
+	"github.com/AsyaBiryukova/go_final_project/internal/notify"
+)
+
+// hub.go содержит рассылку событий задач подписчикам потока Server-Sent Events
+
+const (
+	// DefaultHistory количество последних событий, которые хранятся для продолжения потока по Last-Event-ID
+	DefaultHistory = 256
+	// subscriberBuffer количество событий, которые ждут отправки подписчику. Если подписчик не успевает
+	// их читать, подписка закрывается, и клиент переподключается с Last-Event-ID.
+	subscriberBuffer = 64
+)
+
+// Message описывает одно событие потока. UserID — пользователь, которому отправляется событие.
+type Message struct {
+	ID     uint64
+	UserID int64
+	Event  string
+	Data   []byte
+}
+
+// Subscription получает события Hub, пока не закрыта через Unsubscribe.
+// Канал C закрывается при отписке, при закрытии Hub и если подписчик не успевает читать события.
+type Subscription struct {
+	C      <-chan Message
+	ch     chan Message
+	userID int64
+}
+
+// Hub рассылает события подписчикам пользователя, к задаче которого относится событие, и хранит последние события, чтобы переподключившийся клиент
+// получил пропущенные. Реализует notify.Notifier.
+type Hub struct {
+	mu      sync.Mutex
+	lastID  uint64
+	history []Message
+	size    int
+	subs    map[*Subscription]struct{}
+	closed  bool
+}
+
+// NewHub возвращает Hub, который хранит history последних событий.
+func NewHub(history int) *Hub {
+	return &Hub{
+		size: history,
+		subs: make(map[*Subscription]struct{}),
+	}
+}
+
+// Notify присваивает событию следующий ID, сохраняет его в истории и отправляет всем подписчикам.
+func (h *Hub) Notify(ctx context.Context, event notify.Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	h.Publish(event.Task.UserID, event.Type, data)
+	return nil
+}
+
+// Publish отправляет подписчикам пользователя userID событие event с данными data.
+func (h *Hub) Publish(userID int64, event string, data []byte) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return
+	}
+
+	h.lastID++
+	msg := Message{ID: h.lastID, UserID: userID, Event: event, Data: data}
+	h.history = append(h.history, msg)
+	if len(h.history) > h.size {
+		h.history = h.history[len(h.history)-h.size:]
+	}
+
+	for sub := range h.subs {
+		if sub.userID != userID {
+			continue
+		}
+		select {
+		case sub.ch <- msg:
+		default:
+			h.remove(sub)
+		}
+	}
+}
+
+// Subscribe подписывает на события пользователя userID после события с ID lastEventID из заголовка Last-Event-ID.
+// Возвращает пропущенные события из истории. complete равен false, если часть пропущенных событий уже удалена
+// из истории или lastEventID некорректен, тогда клиенту нужно заново загрузить задачи.
+// Пустой lastEventID означает новое подключение без пропущенных событий.
+func (h *Hub) Subscribe(userID int64, lastEventID string) (sub *Subscription, missed []Message, complete bool) {
+	ch := make(chan Message, subscriberBuffer)
+	sub = &Subscription{C: ch, ch: ch, userID: userID}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		close(ch)
+		return sub, nil, true
+	}
+	h.subs[sub] = struct{}{}
+
+	if len(lastEventID) == 0 {
+		return sub, nil, true
+	}
+	lastID, err := strconv.ParseUint(lastEventID, 10, 64)
+	// ID больше последнего бывает после перезапуска сервера
+	if err != nil || lastID > h.lastID {
+		return sub, nil, false
+	}
+	complete = len(h.history) == 0 || h.history[0].ID <= lastID+1
+	for _, msg := range h.history {
+		if msg.ID > lastID && msg.UserID == userID {
+			missed = append(missed, msg)
+		}
+	}
+	return sub, missed, complete
+}
+
+// Unsubscribe отменяет подписку sub и закрывает её канал.
+func (h *Hub) Unsubscribe(sub *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.remove(sub)
+}
+
+// Close закрывает все подписки. После закрытия события не рассылаются, а новые подписки сразу закрыты.
+// Используется при остановке сервера, чтобы завершить открытые потоки.
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	for sub := range h.subs {
+		h.remove(sub)
+	}
+}
+
+// remove удаляет подписку и закрывает её канал. Вызывается с захваченным mu.
+func (h *Hub) remove(sub *Subscription) {
+	if _, ok := h.subs[sub]; !ok {
+		return
+	}
+	delete(h.subs, sub)
+	close(sub.ch)
+}
@@ -0,0 +1,222 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/AsyaBiryukova/go_final_project/internal/db"
+	"github.com/AsyaBiryukova/go_final_project/internal/notify"
+)
+
+// webhook.go содержит отправку событий задач на адреса webhook через очередь outbox
+
+// Заголовки запроса с событием
+const (
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderDelivery  = "X-Webhook-Delivery"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+const (
+	// defaultInterval период проверки очереди, если не задана переменная TODO_WEBHOOK_INTERVAL
+	defaultInterval = time.Second * 5
+	// batchSize количество событий, отправляемых за одну проверку очереди
+	batchSize = 50
+	// MaxAttempts количество попыток доставки, после которого событие считается недоставленным
+	MaxAttempts = 8
+	// BaseDelay задержка перед второй попыткой доставки, каждая следующая задержка в два раза больше
+	BaseDelay = time.Second * 30
+	// maxDelay ограничивает задержку между попытками
+	maxDelay = time.Hour * 6
+	// requestTimeout ограничивает время одной попытки доставки
+	requestTimeout = time.Second * 10
+)
+
+// Events перечисляет события, на которые можно подписать webhook
+var Events = []string{
+	notify.EventTaskCreated,
+	notify.EventTaskUpdated,
+	notify.EventTaskCompleted,
+	notify.EventTaskDeleted,
+	notify.EventTaskDue,
+}
+
+// Outbox добавляет события в очередь доставки на webhook. Реализует notify.Notifier.
+type Outbox struct {
+	storage *db.Storage
+}
+
+// NewOutbox возвращает Outbox, который сохраняет события в storage.
+func NewOutbox(storage *db.Storage) *Outbox {
+	return &Outbox{storage: storage}
+}
+
+// Notify сохраняет событие в очередь доставки каждого webhook владельца задачи, подписанного на тип события.
+func (o *Outbox) Notify(ctx context.Context, event notify.Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = o.storage.ForUser(event.Task.UserID).EnqueueEvent(ctx, event.Type, payload, event.Time)
+	return err
+}
+
+// Sign возвращает подпись тела запроса body: HMAC-SHA256 с ключом secret от строки "timestamp.body" в шестнадцатеричном виде
+// с префиксом "sha256=". Получатель проверяет подпись из заголовка X-Webhook-Signature тем же способом.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// NewSecret возвращает случайный ключ для подписи событий
+func NewSecret() (string, error) {
+	buf := make([]byte, 32)
+	_, err := rand.Read(buf)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// Interval возвращает период проверки очереди из переменной TODO_WEBHOOK_INTERVAL в формате time.ParseDuration.
+// Значение 0 отключает отправку событий.
+func Interval() (time.Duration, error) {
+	env := os.Getenv("TODO_WEBHOOK_INTERVAL")
+	if len(env) == 0 {
+		return defaultInterval, nil
+	}
+	interval, err := time.ParseDuration(env)
+	if err != nil || interval < 0 {
+		return 0, fmt.Errorf("некорректное значение TODO_WEBHOOK_INTERVAL: %q", env)
+	}
+	return interval, nil
+}
+
+// Dispatcher отправляет события из очереди outbox на адреса webhook с повторами при ошибках
+type Dispatcher struct {
+	storage  *db.Storage
+	client   *http.Client
+	interval time.Duration
+	done     chan struct{}
+}
+
+// NewDispatcher возвращает Dispatcher, который проверяет очередь в storage каждые interval и отправляет события через client.
+func NewDispatcher(storage *db.Storage, client *http.Client, interval time.Duration) *Dispatcher {
+	return &Dispatcher{
+		storage:  storage,
+		client:   client,
+		interval: interval,
+		done:     make(chan struct{}),
+	}
+}
+
+// Start запускает отправку событий в отдельной горутине, пока не отменён ctx. Дождаться остановки можно через Wait.
+func (d *Dispatcher) Start(ctx context.Context) {
+	go func() {
+		defer close(d.done)
+
+		ticker := time.NewTicker(d.interval)
+		defer ticker.Stop()
+		for {
+			d.Deliver(ctx, time.Now())
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Wait ждёт завершения горутины, запущенной Start.
+func (d *Dispatcher) Wait() {
+	<-d.done
+}
+
+// Deliver отправляет события, время доставки которых наступило к now, и записывает результат каждой попытки.
+// При ошибке следующая попытка откладывается с экспоненциально растущей задержкой, после MaxAttempts попыток
+// событие отмечается недоставленным.
+func (d *Dispatcher) Deliver(ctx context.Context, now time.Time) {
+	items, err := d.storage.DueOutbox(ctx, now, batchSize)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	for _, item := range items {
+		if ctx.Err() != nil {
+			return
+		}
+		statusCode, err := d.send(ctx, item, now)
+
+		status := db.DeliveryDelivered
+		var errMsg string
+		nextAttempt := now
+		if err != nil {
+			errMsg = err.Error()
+			status = db.DeliveryPending
+			nextAttempt = now.Add(Backoff(item.Attempts + 1))
+			if item.Attempts+1 >= MaxAttempts {
+				status = db.DeliveryFailed
+			}
+		}
+		err = d.storage.RecordDelivery(context.WithoutCancel(ctx), item, statusCode, errMsg, status, now, nextAttempt)
+		if err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+// Backoff возвращает задержку перед следующей попыткой после attempts неудачных попыток
+func Backoff(attempts int) time.Duration {
+	delay := BaseDelay
+	for i := 1; i < attempts && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, maxDelay)
+}
+
+// send отправляет одно событие и возвращает HTTP статус ответа. Ответ со статусом не 2xx считается ошибкой.
+func (d *Dispatcher) send(ctx context.Context, item db.OutboxItem, now time.Time) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, item.URL, bytes.NewReader(item.Payload))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, item.Event)
+	req.Header.Set(HeaderDelivery, item.ID)
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderSignature, Sign(item.Secret, timestamp, item.Payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	// Дочитываем ответ, чтобы соединение могло быть использовано повторно
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("получатель вернул статус %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,268 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/AsyaBiryukova/go_final_project/internal/db"
+	"github.com/AsyaBiryukova/go_final_project/internal/notify"
+)
+
+// worker.go содержит фоновую обработку задач: перенос просроченных задач, напоминания о задачах на сегодня
+// и ежедневную сводку задач
+
+// defaultInterval период проверки задач, если не задана переменная TODO_WORKER_INTERVAL
+const defaultInterval = time.Minute
+
+// Worker периодически проверяет задачи в фоне
+type Worker struct {
+	storage  *db.Storage
+	notifier notify.Notifier
+	interval time.Duration
+	done     chan struct{}
+	// digestAt время отправки сводки от начала суток, если digest равен true
+	digestAt time.Duration
+	digest   bool
+
+	mu sync.Mutex
+	// pending доставки, которые не удались части получателей и повторяются только для них
+	pending []pendingDelivery
+}
+
+// pendingDelivery описывает напоминание или сводку на дату date, которую не удалось доставить получателям sinks
+type pendingDelivery struct {
+	date  string
+	sinks []notify.Notifier
+	send  func(ctx context.Context, sink notify.Notifier) error
+}
+
+// New возвращает Worker, который проверяет задачи в storage каждые interval и отправляет напоминания через notifier.
+func New(storage *db.Storage, notifier notify.Notifier, interval time.Duration) *Worker {
+	return &Worker{
+		storage:  storage,
+		notifier: notifier,
+		interval: interval,
+		done:     make(chan struct{}),
+	}
+}
+
+// Interval возвращает период проверки задач из переменной TODO_WORKER_INTERVAL в формате time.ParseDuration.
+// Значение 0 отключает фоновую обработку.
+func Interval() (time.Duration, error) {
+	env := os.Getenv("TODO_WORKER_INTERVAL")
+	if len(env) == 0 {
+		return defaultInterval, nil
+	}
+	interval, err := time.ParseDuration(env)
+	if err != nil || interval < 0 {
+		return 0, fmt.Errorf("некорректное значение TODO_WORKER_INTERVAL: %q", env)
+	}
+	return interval, nil
+}
+
+// DigestTime возвращает время отправки ежедневной сводки задач из переменной TODO_DIGEST_TIME в формате 15:04
+// как промежуток от начала суток. Если переменная не задана, возвращает false, и сводка не отправляется.
+func DigestTime() (time.Duration, bool, error) {
+	env := os.Getenv("TODO_DIGEST_TIME")
+	if len(env) == 0 {
+		return 0, false, nil
+	}
+	t, err := time.Parse("15:04", env)
+	if err != nil {
+		return 0, false, fmt.Errorf("некорректное значение TODO_DIGEST_TIME: %q", env)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, true, nil
+}
+
+// SendDigestAt включает отправку ежедневной сводки задач через notifier, если он реализует notify.DigestNotifier.
+// Сводка отправляется при первой проверке после времени at от начала суток, один раз в день.
+func (w *Worker) SendDigestAt(at time.Duration) {
+	w.digestAt = at
+	w.digest = true
+}
+
+// Start запускает проверку задач в отдельной горутине: сразу и затем каждые interval, пока не отменён ctx.
+// Дождаться остановки можно через Wait.
+func (w *Worker) Start(ctx context.Context) {
+	go func() {
+		defer close(w.done)
+
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+		for {
+			w.Tick(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Wait ждёт завершения горутины, запущенной Start.
+func (w *Worker) Wait() {
+	<-w.done
+}
+
+// Tick выполняет одну проверку задач: переносит просроченные задачи согласно TODO_OVERDUE_POLICY,
+// отправляет напоминания о задачах на сегодня, о которых ещё не напоминал, и ежедневную сводку, если наступило её время.
+func (w *Worker) Tick(ctx context.Context) {
+	w.TickAt(ctx, time.Now())
+}
+
+// TickAt выполняет проверку задач так же, как Tick, считая текущим временем now.
+// Напоминания отправляются о задачах всех пользователей, webhook и поток api/events доставляют их владельцу задачи,
+// а напоминания о задачах общего списка — всем участникам списка.
+// Сводка собирается только для пользователя по умолчанию: её получают журнал и почта, а адреса почты
+// TODO_SMTP_TO настроены для сервера, а не для учётных записей.
+func (w *Worker) TickAt(ctx context.Context, now time.Time) {
+	rolled, err := w.storage.RollOverdueTasks(ctx, now)
+	if err != nil {
+		log.Println(err)
+	} else if rolled > 0 {
+		log.Printf("перенесено просроченных задач: %d", rolled)
+	}
+
+	today := now.Format(db.DateFormat)
+	w.retryPending(ctx, today)
+
+	tasks, err := w.storage.ClaimDueTasks(ctx, today)
+	if err != nil {
+		log.Println(err)
+	}
+	for _, task := range tasks {
+		event := notify.Event{Type: notify.EventTaskDue, Task: task, Time: now}
+		sinks := w.sinks()
+		delivered := w.deliver(ctx, today, sinks, func(ctx context.Context, sink notify.Notifier) error {
+			return sink.Notify(ctx, event)
+		})
+		if delivered || len(sinks) == 0 {
+			continue
+		}
+		// Никому не доставлено: снимаем отметку, чтобы повторить напоминание при следующей проверке
+		err = w.storage.ReleaseReminder(context.WithoutCancel(ctx), task.ID, today)
+		if err != nil {
+			log.Println(err)
+		}
+	}
+	w.sendDigest(ctx, now)
+}
+
+// sinks возвращает получателей событий: каждый Notifier из notify.Multi отдельно, чтобы доставку можно было
+// повторить только для тех, кому она не удалась
+func (w *Worker) sinks() []notify.Notifier {
+	if multi, ok := w.notifier.(notify.Multi); ok {
+		return multi
+	}
+	return []notify.Notifier{w.notifier}
+}
+
+// deliver вызывает send для каждого получателя из sinks. Получатели, которым доставить не удалось, запоминаются
+// и получат доставку повторно при следующих проверках на ту же дату date, если хотя бы одному получателю
+// доставка удалась. Возвращает true, если доставка удалась хотя бы одному получателю.
+func (w *Worker) deliver(ctx context.Context, date string, sinks []notify.Notifier, send func(ctx context.Context, sink notify.Notifier) error) bool {
+	failed := sendTo(ctx, sinks, send)
+	if len(failed) == len(sinks) {
+		return false
+	}
+	if len(failed) > 0 {
+		w.mu.Lock()
+		w.pending = append(w.pending, pendingDelivery{date: date, sinks: failed, send: send})
+		w.mu.Unlock()
+	}
+	return true
+}
+
+// retryPending повторяет доставки, которые не удались части получателей. Доставки за прошедшие даты отбрасываются.
+func (w *Worker) retryPending(ctx context.Context, today string) {
+	w.mu.Lock()
+	pending := w.pending
+	w.pending = nil
+	w.mu.Unlock()
+
+	var retry []pendingDelivery
+	for _, p := range pending {
+		if p.date != today {
+			log.Printf("доставка на %s не удалась получателям: %d", p.date, len(p.sinks))
+			continue
+		}
+		p.sinks = sendTo(ctx, p.sinks, p.send)
+		if len(p.sinks) > 0 {
+			retry = append(retry, p)
+		}
+	}
+
+	w.mu.Lock()
+	w.pending = append(retry, w.pending...)
+	w.mu.Unlock()
+}
+
+// sendTo вызывает send для каждого получателя из sinks и возвращает получателей, которым доставить не удалось
+func sendTo(ctx context.Context, sinks []notify.Notifier, send func(ctx context.Context, sink notify.Notifier) error) []notify.Notifier {
+	var failed []notify.Notifier
+	for _, sink := range sinks {
+		err := send(ctx, sink)
+		if err != nil {
+			log.Println(err)
+			failed = append(failed, sink)
+		}
+	}
+	return failed
+}
+
+// sendDigest отправляет сводку задач на сегодня и просроченных задач, если наступило время сводки
+// и сводка за сегодня ещё не отправлялась
+func (w *Worker) sendDigest(ctx context.Context, now time.Time) {
+	var sinks []notify.Notifier
+	for _, sink := range w.sinks() {
+		if _, ok := sink.(notify.DigestNotifier); ok {
+			sinks = append(sinks, sink)
+		}
+	}
+	if !w.digest || len(sinks) == 0 {
+		return
+	}
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	if now.Before(midnight.Add(w.digestAt)) {
+		return
+	}
+
+	today := now.Format(db.DateFormat)
+	claimed, err := w.storage.ClaimDigest(ctx, today)
+	if err != nil || !claimed {
+		if err != nil {
+			log.Println(err)
+		}
+		return
+	}
+
+	// Сводка содержит задачи пользователя по умолчанию: получателям сводки некуда доставить задачи других пользователей
+	storage := w.storage.ForUser(db.DefaultUserID)
+	digest := notify.Digest{Date: today, Time: now}
+	digest.Today, err = storage.GetTasksList(ctx, db.TaskFilter{Date: today})
+	if err == nil {
+		digest.Overdue, err = storage.GetTasksList(ctx, db.TaskFilter{Status: db.StatusOverdue})
+	}
+	if err != nil {
+		log.Println(err)
+	}
+	// Пустая сводка не отправляется
+	if err == nil && len(digest.Today)+len(digest.Overdue) == 0 {
+		return
+	}
+	if err == nil && w.deliver(ctx, today, sinks, func(ctx context.Context, sink notify.Notifier) error {
+		return sink.(notify.DigestNotifier).NotifyDigest(ctx, digest)
+	}) {
+		return
+	}
+	// Сводка никому не доставлена: снимаем отметку, чтобы повторить её при следующей проверке
+	err = w.storage.ReleaseDigest(context.WithoutCancel(ctx), today)
+	if err != nil {
+		log.Println(err)
+	}
+}
@@ -6,15 +6,16 @@ import (
 	"fmt"
 	"io"
 	"net/http"
-	"net/http/cookiejar"
 	"strconv"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
-func requestJSON(apipath string, values map[string]any, method string) ([]byte, error) {
+// requestJSON отправляет запрос method к apipath с телом values и заголовками headers, заданными парами имя, значение
+func requestJSON(apipath string, values map[string]any, method string, headers ...string) ([]byte, error) {
 	var (
 		data []byte
 		err  error
@@ -33,22 +34,19 @@ func requestJSON(apipath string, values map[string]any, method string) ([]byte,
 		return nil, err
 	}
 	req.Header.Set("Content-Type", "application/json")
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
 
-	client := &http.Client{}
-	if len(Token) > 0 {
-		jar, err := cookiejar.New(nil)
-		if err != nil {
-			return nil, err
-		}
-		jar.SetCookies(req.URL, []*http.Cookie{
-			{
-				Name:  "token",
-				Value: Token,
-			},
-		})
-		client.Jar = jar
+	token, err := authToken()
+	if err != nil {
+		return nil, err
+	}
+	if len(token) > 0 {
+		req.Header.Set("Authorization", "Bearer "+token)
 	}
 
+	client := &http.Client{}
 	resp, err = client.Do(req)
 	if err != nil {
 		return nil, err
@@ -60,13 +58,13 @@ func requestJSON(apipath string, values map[string]any, method string) ([]byte,
 	return io.ReadAll(resp.Body)
 }
 
-func postJSON(apipath string, values map[string]any, method string) (map[string]any, error) {
+func postJSON(apipath string, values map[string]any, method string, headers ...string) (map[string]any, error) {
 	var (
 		m   map[string]any
 		err error
 	)
 
-	body, err := requestJSON(apipath, values, method)
+	body, err := requestJSON(apipath, values, method, headers...)
 	if err != nil {
 		return nil, err
 	}
@@ -74,6 +72,24 @@ func postJSON(apipath string, values map[string]any, method string) (map[string]
 	return m, err
 }
 
+// taskETag читает задачу с указанным id и возвращает её ETag для заголовка If-Match
+func taskETag(t *testing.T, id string) string {
+	req, err := http.NewRequest(http.MethodGet, getURL("api/task?id="+id), nil)
+	require.NoError(t, err)
+	token, err := authToken()
+	require.NoError(t, err)
+	if len(token) > 0 {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	etag := resp.Header.Get("ETag")
+	require.NotEmpty(t, etag)
+	return etag
+}
+
 type task struct {
 	date    string
 	title   string
@@ -1,6 +1,8 @@
 package tests
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
@@ -8,8 +10,12 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/AsyaBiryukova/go_final_project/internal/auth"
+	"github.com/jmoiron/sqlx"
 	"github.com/joho/godotenv"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -27,6 +33,87 @@ func getURL(path string) string {
 	return fmt.Sprintf("http://localhost:%d/%s", port, path)
 }
 
+// signinToken входит через api/signin с паролем Password один раз за запуск тестов и возвращает токен доступа.
+// Токен действует TODO_ACCESS_TTL, чего хватает на все тесты.
+var signinToken = sync.OnceValues(func() (string, error) {
+	return signin(map[string]string{"password": Password})
+})
+
+// registrarToken возвращает токен доступа, с которым тесты регистрируют пользователей, пока регистрация закрыта.
+// Если указан Password, это токен пользователя по умолчанию. Без пароля войти пользователем по умолчанию нельзя,
+// поэтому один раз за запуск тестов пользователь добавляется прямо в базу данных и входит по логину.
+var registrarToken = sync.OnceValues(func() (string, error) {
+	if len(Password) > 0 {
+		return signinToken()
+	}
+	err := godotenv.Load("../.env")
+	if err != nil {
+		return "", err
+	}
+	dbfile := DBFile
+	if env := os.Getenv("TODO_DBFILE"); len(env) > 0 {
+		dbfile = "../" + env
+	}
+	conn, err := sqlx.Connect("sqlite3", dbfile)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	login := fmt.Sprintf("reg_%d", time.Now().UnixNano())
+	hash, err := auth.HashPassword("пароль для тестов")
+	if err != nil {
+		return "", err
+	}
+	_, err = conn.Exec(`INSERT INTO users (login, password_hash, created_at) VALUES (?, ?, ?)`,
+		login, hash, time.Now().UTC().Format(time.RFC3339))
+	if err != nil {
+		return "", err
+	}
+	return signin(map[string]string{"login": login, "password": "пароль для тестов"})
+})
+
+// signin входит через api/signin с логином и паролем из values и возвращает токен доступа
+func signin(values map[string]string) (string, error) {
+	data, err := json.Marshal(values)
+	if err != nil {
+		return "", err
+	}
+	resp, err := http.Post(getURL("api/signin"), "application/json", bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	var tokens struct {
+		auth.TokenPair
+		Error string `json:"error"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&tokens)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK || len(tokens.AccessToken) == 0 {
+		return "", fmt.Errorf("вход через api/signin: %d %s", resp.StatusCode, tokens.Error)
+	}
+	return tokens.AccessToken, nil
+}
+
+// register отправляет запрос к api/register от имени вошедшего пользователя, потому что регистрация закрыта
+func register(t *testing.T, values map[string]any) (*http.Response, []byte) {
+	token, err := registrarToken()
+	require.NoError(t, err)
+	return requestV2(t, http.MethodPost, "api/register", values, "Authorization", "Bearer "+token)
+}
+
+// authToken возвращает токен доступа для запросов к api: полученный через api/signin, если указан Password, иначе Token.
+// Токен передаётся в заголовке Authorization, чтобы изменяющие запросы не требовали CSRF токен.
+func authToken() (string, error) {
+	if len(Password) == 0 {
+		return Token, nil
+	}
+	return signinToken()
+}
+
 func getBody(path string) ([]byte, error) {
 	resp, err := http.Get(getURL(path))
 	if err != nil {
@@ -0,0 +1,180 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/AsyaBiryukova/go_final_project/internal/auth"
+	"github.com/AsyaBiryukova/go_final_project/internal/db"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuditStorage(t *testing.T) {
+	storage := startTestDB(t)
+	ctx := db.WithAuditSource(context.Background(), &db.AuditSource{IP: "192.0.2.1", Method: http.MethodPost, Route: "/api/task"})
+	now := time.Now()
+
+	owner, err := storage.AddUser(ctx, "audit_owner", "hash", now)
+	require.NoError(t, err)
+	other, err := storage.AddUser(ctx, "audit_other", "hash", now)
+	require.NoError(t, err)
+	user := storage.ForUser(owner)
+
+	id, err := user.AddTask(ctx, db.Task{Date: now.Format("20060102"), Title: "Проверить журнал"})
+	require.NoError(t, err)
+	taskID := strconv.FormatInt(id, 10)
+	_, err = user.PutTask(ctx, db.Task{ID: taskID, Date: now.Format("20060102"), Title: "Проверить журнал аудита", Comment: "новый"})
+	require.NoError(t, err)
+	_, err = user.SnoozeTask(ctx, taskID, 0, now.AddDate(0, 0, 3).Format("20060102"))
+	require.NoError(t, err)
+	require.NoError(t, user.DeleteTask(ctx, taskID, 0))
+
+	entries, err := user.GetAuditLog(ctx, db.AuditFilter{TaskID: taskID, Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, entries, 4)
+	for i, action := range []string{db.AuditDelete, db.AuditSnooze, db.AuditUpdate, db.AuditCreate} {
+		assert.Equal(t, action, entries[i].Action)
+		assert.Equal(t, "192.0.2.1", entries[i].IP)
+		assert.Equal(t, "/api/task", entries[i].Route)
+		require.NotNil(t, entries[i].UserID)
+		assert.Equal(t, owner, *entries[i].UserID)
+	}
+	assert.Equal(t, db.AuditChange{Old: "", New: "новый"}, entries[2].Changes["comment"])
+	assert.Equal(t, db.AuditChange{Old: "Проверить журнал", New: "Проверить журнал аудита"}, entries[2].Changes["title"])
+	assert.NotContains(t, entries[2].Changes, "date")
+	assert.Equal(t, now.AddDate(0, 0, 3).Format("20060102"), entries[1].Changes["date"].New)
+	assert.Equal(t, "Проверить журнал аудита", entries[0].Changes["title"].Old)
+	assert.Empty(t, entries[0].Changes["title"].New)
+
+	// Неудачное изменение не записывается
+	_, err = user.PutTask(ctx, db.Task{ID: taskID, Date: now.Format("20060102"), Title: "Удалённая"})
+	assert.ErrorIs(t, err, db.ErrNotFound)
+	entries, err = user.GetAuditLog(ctx, db.AuditFilter{TaskID: taskID, Action: db.AuditUpdate, Limit: 10})
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+
+	// Другой пользователь не видит чужой журнал
+	entries, err = storage.ForUser(other).GetAuditLog(ctx, db.AuditFilter{TaskID: taskID, Limit: 10})
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+
+	// Запрос без пользователя виден учётной записи, к которой обращался, а если она неизвестна — пользователю по умолчанию
+	failed := db.AuditEntry{IP: "192.0.2.2", Method: http.MethodPost, Route: "/api/signin", Action: db.AuditRequest, Status: http.StatusUnauthorized}
+	require.NoError(t, storage.AddAuditEntry(ctx, failed, &other, now))
+	failed.Route = "/api/register"
+	require.NoError(t, storage.AddAuditEntry(ctx, failed, nil, now))
+	entries, err = storage.ForUser(other).GetAuditLog(ctx, db.AuditFilter{Action: db.AuditRequest, Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "/api/signin", entries[0].Route)
+	assert.Nil(t, entries[0].UserID)
+	// Копия базы данных может содержать записи пользователя по умолчанию, оставленные другими тестами
+	entries, err = storage.ForUser(db.DefaultUserID).GetAuditLog(ctx, db.AuditFilter{Action: db.AuditRequest, Limit: 1})
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "/api/register", entries[0].Route)
+	assert.Equal(t, "192.0.2.2", entries[0].IP)
+	entries, err = user.GetAuditLog(ctx, db.AuditFilter{Action: db.AuditRequest, Limit: 10})
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+
+	// Журнал только дополняется
+	conn, err := sqlx.Connect("sqlite3", os.Getenv("TODO_DBFILE"))
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Exec("UPDATE audit_log SET action = 'update' WHERE task_id = ?", id)
+	assert.Error(t, err)
+	_, err = conn.Exec("DELETE FROM audit_log WHERE task_id = ?", id)
+	assert.Error(t, err)
+}
+
+func TestAuditAPI(t *testing.T) {
+	since := time.Now().Add(-time.Second).UTC().Format(time.RFC3339)
+	bearer := registerUser(t, "audit")
+
+	resp, body := requestV2(t, http.MethodPost, "api/task", map[string]any{"date": time.Now().Format("20060102"), "title": "Задача для журнала"}, "Authorization", bearer)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	var created map[string]any
+	require.NoError(t, json.Unmarshal(body, &created))
+	id := created["id"].(string)
+	resp, _ = requestV2(t, http.MethodDelete, "api/task?id="+id, nil, "Authorization", bearer, "If-Match", "*")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	audit := func(query string) (int, []db.AuditEntry) {
+		resp, body := requestV2(t, http.MethodGet, "api/audit?"+query, nil, "Authorization", bearer)
+		var result struct {
+			Entries []db.AuditEntry `json:"entries"`
+		}
+		if resp.StatusCode == http.StatusOK {
+			require.NoError(t, json.Unmarshal(body, &result))
+		}
+		return resp.StatusCode, result.Entries
+	}
+
+	status, entries := audit("task_id=" + id)
+	require.Equal(t, http.StatusOK, status)
+	require.Len(t, entries, 2)
+	assert.Equal(t, db.AuditDelete, entries[0].Action)
+	assert.Equal(t, db.AuditCreate, entries[1].Action)
+	assert.Equal(t, "Задача для журнала", entries[1].Changes["title"].New)
+	assert.Equal(t, "/api/task", entries[1].Route)
+	assert.NotEmpty(t, entries[1].IP)
+
+	// Запросы записываются вместе со статусом ответа и пользователем
+	status, entries = audit("action=request&from=" + since)
+	require.Equal(t, http.StatusOK, status)
+	require.GreaterOrEqual(t, len(entries), 3)
+	assert.Equal(t, http.MethodDelete, entries[0].Method)
+	assert.Equal(t, http.StatusOK, entries[0].Status)
+	assert.Equal(t, http.StatusCreated, entries[1].Status)
+	require.NotNil(t, entries[0].UserID)
+	assert.Equal(t, "/api/register", entries[len(entries)-1].Route)
+
+	status, entries = audit("task_id=" + id + "&limit=1")
+	require.Equal(t, http.StatusOK, status)
+	assert.Len(t, entries, 1)
+	status, entries = audit("task_id=" + id + "&from=" + time.Now().Add(time.Hour).UTC().Format(time.RFC3339))
+	require.Equal(t, http.StatusOK, status)
+	assert.Empty(t, entries)
+
+	for _, query := range []string{"action=unknown", "limit=0", "from=вчера", "task_id=abc"} {
+		status, _ = audit(query)
+		assert.Equal(t, http.StatusUnprocessableEntity, status, query)
+	}
+}
+
+func TestAuditFailedSignin(t *testing.T) {
+	since := time.Now().Add(-time.Second).UTC().Format(time.RFC3339)
+	login := fmt.Sprintf("afs_%d", time.Now().UnixNano())
+	resp, _ := register(t, map[string]any{"login": login, "password": "пароль для тестов"})
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	resp, _ = requestV2(t, http.MethodPost, "api/signin", map[string]any{"login": login, "password": "неправильный пароль"})
+	require.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	resp, body := requestV2(t, http.MethodPost, "api/signin", map[string]any{"login": login, "password": "пароль для тестов"})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var tokens auth.TokenPair
+	require.NoError(t, json.Unmarshal(body, &tokens))
+
+	// Неудачная попытка входа видна владельцу учётной записи, хотя пользователь при ней неизвестен
+	resp, body = requestV2(t, http.MethodGet, "api/audit?action=request&from="+since, nil, "Authorization", "Bearer "+tokens.AccessToken)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var result struct {
+		Entries []db.AuditEntry `json:"entries"`
+	}
+	require.NoError(t, json.Unmarshal(body, &result))
+	require.Len(t, result.Entries, 3)
+	assert.Equal(t, "/api/signin", result.Entries[1].Route)
+	assert.Equal(t, http.StatusUnauthorized, result.Entries[1].Status)
+	assert.Nil(t, result.Entries[1].UserID)
+	assert.Equal(t, http.StatusOK, result.Entries[0].Status)
+	require.NotNil(t, result.Entries[0].UserID)
+}
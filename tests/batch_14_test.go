@@ -0,0 +1,126 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type batchResult struct {
+	Index  int    `json:"index"`
+	Op     string `json:"op"`
+	Status int    `json:"status"`
+	ID     string `json:"id"`
+	Error  *struct {
+		Code  string `json:"code"`
+		Field string `json:"field"`
+	} `json:"error"`
+}
+
+type batchResponse struct {
+	Committed bool          `json:"committed"`
+	Results   []batchResult `json:"results"`
+}
+
+func postBatch(t *testing.T, atomic bool, ops ...map[string]any) (int, batchResponse) {
+	resp, body := requestV2(t, http.MethodPost, "api/tasks/batch", map[string]any{
+		"atomic":     atomic,
+		"operations": ops,
+	})
+	var ret batchResponse
+	assert.NoError(t, json.Unmarshal(body, &ret))
+	return resp.StatusCode, ret
+}
+
+func TestBatch(t *testing.T) {
+	db := openDB(t)
+	defer db.Close()
+
+	now := time.Now().Format(`20060102`)
+	doneID := addTask(t, task{date: now, title: "Выполнить в пакете", repeat: "d 3"})
+	delID := addTask(t, task{date: now, title: "Удалить в пакете"})
+
+	// Без atomic ошибка одной операции не отменяет остальные
+	status, ret := postBatch(t, false,
+		map[string]any{"op": "create", "task": map[string]any{"date": now, "title": "Создана в пакете"}},
+		map[string]any{"op": "create", "task": map[string]any{"date": now}},
+		map[string]any{"op": "done", "id": doneID, "version": 1},
+		map[string]any{"op": "delete", "id": delID, "version": 1},
+	)
+	assert.Equal(t, http.StatusOK, status)
+	assert.True(t, ret.Committed)
+	if assert.Len(t, ret.Results, 4) {
+		assert.Equal(t, http.StatusCreated, ret.Results[0].Status)
+		assert.NotEmpty(t, ret.Results[0].ID)
+		assert.Equal(t, http.StatusUnprocessableEntity, ret.Results[1].Status)
+		if assert.NotNil(t, ret.Results[1].Error) {
+			assert.Equal(t, "title", ret.Results[1].Error.Field)
+		}
+		assert.Equal(t, http.StatusOK, ret.Results[2].Status)
+		assert.Equal(t, http.StatusNoContent, ret.Results[3].Status)
+
+		var task Task
+		err := db.Get(&task, `SELECT * FROM scheduler WHERE id=?`, ret.Results[0].ID)
+		assert.NoError(t, err)
+		assert.Equal(t, "Создана в пакете", task.Title)
+	}
+	notFoundTask(t, delID)
+
+	var task Task
+	err := db.Get(&task, `SELECT * FROM scheduler WHERE id=?`, doneID)
+	assert.NoError(t, err)
+	assert.NotEqual(t, now, task.Date)
+
+	// С atomic ошибка откатывает все операции пакета
+	before, err := count(db)
+	assert.NoError(t, err)
+	status, ret = postBatch(t, true,
+		map[string]any{"op": "create", "task": map[string]any{"date": now, "title": "Не должна сохраниться"}},
+		map[string]any{"op": "update", "id": doneID, "version": task.Version, "task": map[string]any{"date": now, "title": "Не должна измениться"}},
+		map[string]any{"op": "delete", "id": "999999999", "version": 1},
+		map[string]any{"op": "done", "id": doneID, "version": task.Version},
+	)
+	assert.Equal(t, http.StatusNotFound, status)
+	assert.False(t, ret.Committed)
+	if assert.Len(t, ret.Results, 3) {
+		assert.Equal(t, http.StatusNotFound, ret.Results[2].Status)
+	}
+	after, err := count(db)
+	assert.NoError(t, err)
+	assert.Equal(t, before, after)
+
+	var unchanged Task
+	err = db.Get(&unchanged, `SELECT * FROM scheduler WHERE id=?`, doneID)
+	assert.NoError(t, err)
+	assert.Equal(t, task, unchanged)
+
+	// Некорректные запросы отклоняются целиком
+	status, _ = postBatch(t, false)
+	assert.Equal(t, http.StatusUnprocessableEntity, status)
+	status, _ = postBatch(t, false, map[string]any{"op": "archive", "id": doneID})
+	assert.Equal(t, http.StatusUnprocessableEntity, status)
+
+	// Изменяющие операции без версии или с устаревшей версией не выполняются
+	status, ret = postBatch(t, false,
+		map[string]any{"op": "delete", "id": doneID},
+		map[string]any{"op": "done", "id": doneID, "version": task.Version - 1},
+	)
+	assert.Equal(t, http.StatusOK, status)
+	if assert.Len(t, ret.Results, 2) {
+		assert.Equal(t, http.StatusUnprocessableEntity, ret.Results[0].Status)
+		if assert.NotNil(t, ret.Results[0].Error) {
+			assert.Equal(t, "version", ret.Results[0].Error.Field)
+		}
+		assert.Equal(t, http.StatusPreconditionFailed, ret.Results[1].Status)
+	}
+	err = db.Get(&unchanged, `SELECT * FROM scheduler WHERE id=?`, doneID)
+	assert.NoError(t, err)
+	assert.Equal(t, task, unchanged)
+
+	status, _ = postBatch(t, false, map[string]any{"op": "delete", "id": doneID, "version": task.Version})
+	assert.Equal(t, http.StatusOK, status)
+	notFoundTask(t, doneID)
+}
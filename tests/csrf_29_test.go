@@ -0,0 +1,96 @@
+package tests
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessionCookies(t *testing.T) {
+	login := fmt.Sprintf("csrf_%d", time.Now().UnixNano())
+	resp, _ := register(t, map[string]any{"login": login, "password": "пароль для тестов"})
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	resp, _ = requestV2(t, http.MethodPost, "api/signin", map[string]any{"login": login, "password": "пароль для тестов"})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	cookies := map[string]*http.Cookie{}
+	for _, cookie := range resp.Cookies() {
+		cookies[cookie.Name] = cookie
+	}
+	token, csrf := cookies["token"], cookies["XSRF-TOKEN"]
+	require.NotNil(t, token)
+	require.NotNil(t, csrf)
+	assert.True(t, token.HttpOnly)
+	assert.True(t, token.Secure)
+	assert.Equal(t, http.SameSiteStrictMode, token.SameSite)
+	assert.Positive(t, token.MaxAge)
+	assert.True(t, token.Expires.After(time.Now()))
+	// CSRF токен читает JavaScript веб-клиента
+	assert.False(t, csrf.HttpOnly)
+	assert.True(t, csrf.Secure)
+	assert.Equal(t, http.SameSiteStrictMode, csrf.SameSite)
+	assert.NotEmpty(t, csrf.Value)
+
+	task := map[string]any{"date": time.Now().Format("20060102"), "title": "Проверить CSRF"}
+	cookie := "token=" + token.Value
+	withCSRF := cookie + "; XSRF-TOKEN=" + csrf.Value
+
+	// Изменяющий запрос с cookie требует CSRF токен в заголовке
+	resp, _ = requestV2(t, http.MethodPost, "api/task", task, "Cookie", cookie)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	resp, _ = requestV2(t, http.MethodPost, "api/task", task, "Cookie", withCSRF, "X-XSRF-TOKEN", "неверный")
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	resp, _ = requestV2(t, http.MethodPost, "api/task", task, "Cookie", cookie, "X-XSRF-TOKEN", csrf.Value)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	resp, _ = requestV2(t, http.MethodPost, "api/task", task, "Cookie", withCSRF, "X-XSRF-TOKEN", csrf.Value)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	// Чтение и запросы с заголовком Authorization CSRF токен не требуют
+	resp, _ = requestV2(t, http.MethodGet, "api/tasks", nil, "Cookie", cookie)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp, _ = requestV2(t, http.MethodPost, "api/task", task, "Authorization", "Bearer "+token.Value)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	// Токен обновления хранится в cookie, которую браузер передаёт только в api
+	refresh := cookies["refresh_token"]
+	require.NotNil(t, refresh)
+	assert.True(t, refresh.HttpOnly)
+	assert.Equal(t, "/api/", refresh.Path)
+	assert.True(t, refresh.Expires.After(token.Expires))
+
+	refreshCookie := "refresh_token=" + refresh.Value + "; XSRF-TOKEN=" + csrf.Value
+	resp, _ = requestV2(t, http.MethodPost, "api/signin/refresh", nil, "Cookie", "refresh_token="+refresh.Value)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	resp, _ = requestV2(t, http.MethodPost, "api/signin/refresh", nil, "Cookie", refreshCookie, "X-XSRF-TOKEN", csrf.Value)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	cookies = map[string]*http.Cookie{}
+	for _, cookie := range resp.Cookies() {
+		cookies[cookie.Name] = cookie
+	}
+	require.NotNil(t, cookies["token"])
+	require.NotNil(t, cookies["refresh_token"])
+	assert.NotEqual(t, refresh.Value, cookies["refresh_token"].Value)
+	// Использованный токен обновления отозван
+	resp, _ = requestV2(t, http.MethodPost, "api/signin/refresh", nil, "Cookie", refreshCookie, "X-XSRF-TOKEN", csrf.Value)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	token = cookies["token"]
+	resp, _ = requestV2(t, http.MethodPost, "api/logout", nil, "Authorization", "Bearer "+token.Value,
+		"Cookie", "refresh_token="+cookies["refresh_token"].Value)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	cleared := 0
+	for _, cookie := range resp.Cookies() {
+		if cookie.Name == "token" || cookie.Name == "XSRF-TOKEN" || cookie.Name == "refresh_token" {
+			assert.Negative(t, cookie.MaxAge, cookie.Name)
+			cleared++
+		}
+	}
+	assert.Equal(t, 3, cleared)
+	// Выход отзывает токен обновления из cookie
+	resp, _ = requestV2(t, http.MethodPost, "api/signin/refresh", map[string]any{"refresh_token": cookies["refresh_token"].Value})
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
@@ -1,6 +1,7 @@
 package tests
 
 import (
+	"database/sql"
 	"os"
 	"testing"
 	"time"
@@ -18,6 +19,13 @@ type Task struct {
 	Title   string `db:"title"`
 	Comment string `db:"comment"`
 	Repeat  string `db:"repeat"`
+	Version int64  `db:"version"`
+	// Дата, с которой задача была отложена
+	SnoozedFrom string `db:"snoozed_from"`
+	// Владелец задачи
+	UserID int64 `db:"user_id"`
+	// Общий список задачи
+	ListID sql.NullInt64 `db:"list_id"`
 }
 
 func count(db *sqlx.DB) (int, error) {
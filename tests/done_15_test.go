@@ -0,0 +1,57 @@
+package tests
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConcurrentDone(t *testing.T) {
+	db := openDB(t)
+	defer db.Close()
+
+	now := time.Now()
+	id := addTask(t, task{
+		date:   now.Format(`20060102`),
+		title:  "Одновременное выполнение",
+		repeat: "d 2",
+	})
+	resp, _ := requestV2(t, http.MethodGet, "api/task?id="+id, nil)
+	etag := resp.Header.Get("ETag")
+
+	// Задача с одной версией может быть выполнена только одним из одновременных запросов
+	const requests = 8
+	statuses := make(chan int, requests)
+	var wg sync.WaitGroup
+	for range requests {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, _ := requestV2(t, http.MethodPost, "api/task/done?id="+id, nil, "If-Match", etag)
+			statuses <- resp.StatusCode
+		}()
+	}
+	wg.Wait()
+	close(statuses)
+
+	var ok int
+	for status := range statuses {
+		if status == http.StatusOK {
+			ok++
+			continue
+		}
+		assert.Equal(t, http.StatusPreconditionFailed, status)
+	}
+	assert.Equal(t, 1, ok)
+
+	var task Task
+	err := db.Get(&task, `SELECT * FROM scheduler WHERE id=?`, id)
+	assert.NoError(t, err)
+	assert.Equal(t, now.AddDate(0, 0, 2).Format(`20060102`), task.Date)
+
+	_, err = db.Exec(`DELETE FROM scheduler WHERE id=?`, id)
+	assert.NoError(t, err)
+}
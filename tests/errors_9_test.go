@@ -0,0 +1,85 @@
+package tests
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type errCase struct {
+	method string
+	path   string
+	body   string
+	status int
+	code   string
+	field  string
+}
+
+func TestErrors(t *testing.T) {
+	tbl := []errCase{
+		{http.MethodGet, "api/task?id=7645346343", "", http.StatusNotFound, "not_found", ""},
+		{http.MethodGet, "api/task?id=abc", "", http.StatusUnprocessableEntity, "validation_error", "id"},
+		{http.MethodPost, "api/task", `{"date":"20240192","title":"Qwerty"}`, http.StatusUnprocessableEntity, "validation_error", "date"},
+		{http.MethodPost, "api/task", `{"title":""}`, http.StatusUnprocessableEntity, "validation_error", "title"},
+		{http.MethodPost, "api/task", `{"title":"Тест","repeat":"ooops"}`, http.StatusUnprocessableEntity, "validation_error", "repeat"},
+		{http.MethodPost, "api/task", `{"title":`, http.StatusBadRequest, "bad_request", ""},
+		{http.MethodPut, "api/task", `{"id":"7645346343","title":"Тест"}`, http.StatusPreconditionRequired, "precondition_required", ""},
+		{http.MethodDelete, "api/task?id=7645346343", "", http.StatusPreconditionRequired, "precondition_required", ""},
+		{http.MethodPost, "api/task/done?id=7645346343", "", http.StatusPreconditionRequired, "precondition_required", ""},
+		{http.MethodGet, "api/nextdate?now=ooops&date=20240126&repeat=y", "", http.StatusUnprocessableEntity, "validation_error", "now"},
+		{http.MethodGet, "api/nextdate?now=20240126&date=20240126&repeat=k", "", http.StatusUnprocessableEntity, "validation_error", "repeat"},
+		{http.MethodGet, "api/nextdate?now=20240126&repeat=y", "", http.StatusUnprocessableEntity, "validation_error", "date"},
+		{http.MethodGet, "api/task", "", http.StatusUnprocessableEntity, "validation_error", "id"},
+		{http.MethodPost, "api/task", `{"title":"Тест","repeat":5}`, http.StatusUnprocessableEntity, "validation_error", "repeat"},
+		{http.MethodPut, "api/task", `{"title":"Тест"}`, http.StatusUnprocessableEntity, "validation_error", "id"},
+		{http.MethodPost, "api/signin", `{}`, http.StatusUnprocessableEntity, "validation_error", "password"},
+		{http.MethodPost, "api/task", `{"title":"Тест","comment":"` + strings.Repeat("a", 1<<20) + `"}`, http.StatusRequestEntityTooLarge, "request_entity_too_large", ""},
+	}
+	for _, v := range tbl {
+		req, err := http.NewRequest(v.method, getURL(v.path), strings.NewReader(v.body))
+		assert.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		token, err := authToken()
+		require.NoError(t, err)
+		if len(token) > 0 {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if !assert.NoError(t, err) {
+			continue
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		assert.NoError(t, err)
+
+		assert.Equal(t, v.status, resp.StatusCode, "%s %s", v.method, v.path)
+		assert.True(t, strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json"))
+
+		var m map[string]string
+		err = json.Unmarshal(body, &m)
+		assert.NoError(t, err)
+		assert.NotEmpty(t, m["error"])
+		assert.Equal(t, v.code, m["code"], "%s %s", v.method, v.path)
+		assert.Equal(t, v.field, m["field"], "%s %s", v.method, v.path)
+	}
+}
+
+func TestOpenAPI(t *testing.T) {
+	body, err := getBody("api/openapi.json")
+	assert.NoError(t, err)
+	var spec map[string]any
+	err = json.Unmarshal(body, &spec)
+	assert.NoError(t, err)
+	assert.Equal(t, "3.0.3", spec["openapi"])
+
+	paths, ok := spec["paths"].(map[string]any)
+	assert.True(t, ok)
+	for _, path := range []string{"/api/nextdate", "/api/tasks", "/api/task", "/api/task/done", "/api/signin"} {
+		assert.Contains(t, paths, path)
+	}
+}
@@ -0,0 +1,96 @@
+package tests
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestETag(t *testing.T) {
+	id := addTask(t, task{
+		date:  time.Now().Format(`20060102`),
+		title: "Задача в двух вкладках",
+	})
+
+	resp, _ := requestV2(t, http.MethodGet, "api/task?id="+id, nil)
+	etag := resp.Header.Get("ETag")
+	assert.NotEmpty(t, etag)
+
+	// Первая вкладка сохраняет изменения
+	resp, _ = requestV2(t, http.MethodPut, "api/task", map[string]any{
+		"id":    id,
+		"title": "Изменено в первой вкладке",
+	}, "If-Match", etag)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	newETag := resp.Header.Get("ETag")
+	assert.NotEqual(t, etag, newETag)
+
+	// Вторая вкладка прочитала задачу раньше и не должна перезаписать изменения
+	resp, _ = requestV2(t, http.MethodPut, "api/task", map[string]any{
+		"id":    id,
+		"title": "Изменено во второй вкладке",
+	}, "If-Match", etag)
+	assert.Equal(t, http.StatusPreconditionFailed, resp.StatusCode)
+
+	resp, _ = requestV2(t, http.MethodPost, "api/task/done?id="+id, nil, "If-Match", etag)
+	assert.Equal(t, http.StatusPreconditionFailed, resp.StatusCode)
+
+	resp, _ = requestV2(t, http.MethodDelete, "api/task?id="+id, nil, "If-Match", etag)
+	assert.Equal(t, http.StatusPreconditionFailed, resp.StatusCode)
+
+	resp, _ = requestV2(t, http.MethodDelete, "api/task?id="+id, nil, "If-Match", newETag)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestIfMatchRequired(t *testing.T) {
+	db := openDB(t)
+	defer db.Close()
+
+	now := time.Now().Format(`20060102`)
+	id := addTask(t, task{date: now, title: "Задача без If-Match", repeat: "d 2"})
+
+	var before Task
+	err := db.Get(&before, `SELECT * FROM scheduler WHERE id=?`, id)
+	assert.NoError(t, err)
+
+	// Изменяющие запросы без If-Match отклоняются и не меняют задачу
+	resp, _ := requestV2(t, http.MethodPut, "api/task", map[string]any{
+		"id":    id,
+		"date":  now,
+		"title": "Изменено без If-Match",
+	})
+	assert.Equal(t, http.StatusPreconditionRequired, resp.StatusCode)
+	resp, _ = requestV2(t, http.MethodPost, "api/task/done?id="+id, nil)
+	assert.Equal(t, http.StatusPreconditionRequired, resp.StatusCode)
+	resp, _ = requestV2(t, http.MethodDelete, "api/task?id="+id, nil)
+	assert.Equal(t, http.StatusPreconditionRequired, resp.StatusCode)
+
+	var after Task
+	err = db.Get(&after, `SELECT * FROM scheduler WHERE id=?`, id)
+	assert.NoError(t, err)
+	assert.Equal(t, before, after)
+
+	// С актуальным ETag запросы выполняются
+	resp, _ = requestV2(t, http.MethodPut, "api/task", map[string]any{
+		"id":     id,
+		"date":   now,
+		"title":  "Изменено с If-Match",
+		"repeat": "d 2",
+	}, "If-Match", taskETag(t, id))
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	err = db.Get(&after, `SELECT * FROM scheduler WHERE id=?`, id)
+	assert.NoError(t, err)
+	assert.Equal(t, "Изменено с If-Match", after.Title)
+
+	resp, _ = requestV2(t, http.MethodPost, "api/task/done?id="+id, nil, "If-Match", taskETag(t, id))
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	err = db.Get(&after, `SELECT * FROM scheduler WHERE id=?`, id)
+	assert.NoError(t, err)
+	assert.NotEqual(t, now, after.Date)
+
+	resp, _ = requestV2(t, http.MethodDelete, "api/task?id="+id, nil, "If-Match", taskETag(t, id))
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	notFoundTask(t, id)
+}
@@ -0,0 +1,215 @@
+package tests
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AsyaBiryukova/go_final_project/internal/db"
+	"github.com/AsyaBiryukova/go_final_project/internal/notify"
+	"github.com/AsyaBiryukova/go_final_project/internal/sse"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sseEvent описывает событие, прочитанное из потока api/events
+type sseEvent struct {
+	id    string
+	event string
+	data  string
+}
+
+// openEvents подключается к потоку api/events. Поток закрывается при завершении теста.
+func openEvents(t *testing.T, lastEventID string) *bufio.Reader {
+	token, err := authToken()
+	require.NoError(t, err)
+	authorization := ""
+	if len(token) > 0 {
+		authorization = "Bearer " + token
+	}
+	return openEventsAs(t, authorization, lastEventID)
+}
+
+// openEventsAs подключается к потоку api/events с заголовком Authorization authorization
+func openEventsAs(t *testing.T, authorization, lastEventID string) *bufio.Reader {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	t.Cleanup(cancel)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, getURL("api/events"), nil)
+	require.NoError(t, err)
+	if len(lastEventID) > 0 {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	if len(authorization) > 0 {
+		req.Header.Set("Authorization", authorization)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	t.Cleanup(func() { resp.Body.Close() })
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.True(t, strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream"))
+	return bufio.NewReader(resp.Body)
+}
+
+// nextEvent читает из потока следующее событие, пропуская комментарии и поле retry
+func nextEvent(t *testing.T, r *bufio.Reader) sseEvent {
+	var ev sseEvent
+	for {
+		line, err := r.ReadString('\n')
+		require.NoError(t, err)
+		line = strings.TrimSuffix(line, "\n")
+		if len(line) == 0 {
+			if len(ev.event) > 0 {
+				return ev
+			}
+			continue
+		}
+		name, value, _ := strings.Cut(line, ": ")
+		switch name {
+		case "id":
+			ev.id = value
+		case "event":
+			ev.event = value
+		case "data":
+			ev.data = value
+		}
+	}
+}
+
+// waitEvent читает события из потока до события eventType о задаче с указанным id
+func waitEvent(t *testing.T, r *bufio.Reader, eventType, id string) sseEvent {
+	for {
+		ev := nextEvent(t, r)
+		if ev.event != eventType {
+			continue
+		}
+		var event notify.Event
+		require.NoError(t, json.Unmarshal([]byte(ev.data), &event))
+		if event.Task.ID == id {
+			return ev
+		}
+	}
+}
+
+func TestEvents(t *testing.T) {
+	stream := openEvents(t, "")
+
+	now := time.Now()
+	id := addTask(t, task{
+		date:  now.Format(`20060102`),
+		title: "Задача в потоке событий",
+	})
+	created := waitEvent(t, stream, notify.EventTaskCreated, id)
+	assert.NotEmpty(t, created.id)
+
+	_, err := postJSON("api/task/done?id="+id, nil, http.MethodPost, "If-Match", taskETag(t, id))
+	assert.NoError(t, err)
+	waitEvent(t, stream, notify.EventTaskCompleted, id)
+
+	// После переподключения приходят пропущенные события
+	id2 := addTask(t, task{
+		date:  now.Format(`20060102`),
+		title: "Пропущенная задача",
+	})
+	resumed := openEvents(t, created.id)
+	waitEvent(t, resumed, notify.EventTaskCompleted, id)
+	waitEvent(t, resumed, notify.EventTaskCreated, id2)
+
+	resp, _ := requestV2(t, http.MethodDelete, "api/v2/tasks/"+id2, nil, "If-Match", "*")
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	waitEvent(t, resumed, notify.EventTaskDeleted, id2)
+
+	// Неизвестный ID, например после перезапуска сервера, требует заново загрузить задачи
+	reset := openEvents(t, "999999999")
+	assert.Equal(t, "reset", nextEvent(t, reset).event)
+}
+
+func TestEventsListMembers(t *testing.T) {
+	owner := registerUser(t, "evowner")
+	member := registerUser(t, "evmember")
+
+	resp, body := requestV2(t, http.MethodPost, "api/lists", map[string]any{"name": "События"}, "Authorization", owner)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	var list db.List
+	require.NoError(t, json.Unmarshal(body, &list))
+	resp, body = requestV2(t, http.MethodPost, "api/lists/invites?id="+list.ID, map[string]any{"role": db.RoleEditor}, "Authorization", owner)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	var invite map[string]string
+	require.NoError(t, json.Unmarshal(body, &invite))
+	resp, _ = requestV2(t, http.MethodPost, "api/lists/join", map[string]any{"token": invite["token"]}, "Authorization", member)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	ownerStream := openEventsAs(t, owner, "")
+	memberStream := openEventsAs(t, member, "")
+
+	// События о задаче списка получают все участники, а не только тот, кто её изменил
+	resp, body = requestV2(t, http.MethodPost, "api/v2/tasks", map[string]any{
+		"date":    time.Now().Format(`20060102`),
+		"title":   "Задача списка в потоке событий",
+		"list_id": list.ID,
+	}, "Authorization", owner)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	var created db.Task
+	require.NoError(t, json.Unmarshal(body, &created))
+	waitEvent(t, ownerStream, notify.EventTaskCreated, created.ID)
+	waitEvent(t, memberStream, notify.EventTaskCreated, created.ID)
+
+	resp, _ = requestV2(t, http.MethodDelete, "api/v2/tasks/"+created.ID, nil, "Authorization", member, "If-Match", "*")
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+	waitEvent(t, memberStream, notify.EventTaskDeleted, created.ID)
+	waitEvent(t, ownerStream, notify.EventTaskDeleted, created.ID)
+}
+
+func TestEventsHub(t *testing.T) {
+	hub := sse.NewHub(2)
+	for _, event := range []string{"a", "b", "c"} {
+		hub.Publish(0, event, []byte("{}"))
+	}
+
+	// Из истории удалено событие 1
+	sub, missed, complete := hub.Subscribe(0, "0")
+	assert.False(t, complete)
+	assert.Len(t, missed, 2)
+	hub.Unsubscribe(sub)
+
+	sub, missed, complete = hub.Subscribe(0, "1")
+	assert.True(t, complete)
+	require.Len(t, missed, 2)
+	assert.Equal(t, uint64(2), missed[0].ID)
+	assert.Equal(t, "c", missed[1].Event)
+
+	hub.Publish(0, "d", []byte("{}"))
+	msg := <-sub.C
+	assert.Equal(t, uint64(4), msg.ID)
+
+	// Подписчик, который не читает события, отключается
+	for range 100 {
+		hub.Publish(0, "e", []byte("{}"))
+	}
+	count := 0
+	for range sub.C {
+		count++
+	}
+	assert.Less(t, count, 100)
+
+	// Подписчик получает только события своего пользователя
+	other, _, _ := hub.Subscribe(1, "")
+	hub.Publish(0, "f", []byte("{}"))
+	hub.Publish(1, "g", []byte("{}"))
+	msg = <-other.C
+	assert.Equal(t, "g", msg.Event)
+	_, missed, complete = hub.Subscribe(1, "104")
+	assert.True(t, complete)
+	require.Len(t, missed, 1)
+	assert.Equal(t, "g", missed[0].Event)
+
+	// Закрытие завершает все подписки
+	sub, _, _ = hub.Subscribe(0, "")
+	hub.Close()
+	_, ok := <-sub.C
+	assert.False(t, ok)
+}
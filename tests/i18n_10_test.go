@@ -0,0 +1,65 @@
+package tests
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/AsyaBiryukova/go_final_project/internal/db"
+	"github.com/AsyaBiryukova/go_final_project/internal/i18n"
+	nd "github.com/AsyaBiryukova/go_final_project/internal/nextdate"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func getWithLang(t *testing.T, path, lang string) (*http.Response, []byte) {
+	req, err := http.NewRequest(http.MethodGet, getURL(path), nil)
+	require.NoError(t, err)
+	req.Header.Set("Accept-Language", lang)
+	token, err := authToken()
+	require.NoError(t, err)
+	if len(token) > 0 {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	return resp, body
+}
+
+func TestI18n(t *testing.T) {
+	var m map[string]string
+
+	resp, body := getWithLang(t, "api/task?id=7645346343", "en-US,en;q=0.9,ru;q=0.8")
+	assert.Equal(t, "en", resp.Header.Get("Content-Language"))
+	assert.NoError(t, json.Unmarshal(body, &m))
+	assert.Equal(t, "task not found", m["error"])
+
+	resp, body = getWithLang(t, "api/task?id=7645346343", "ru")
+	assert.Equal(t, "ru", resp.Header.Get("Content-Language"))
+	assert.NoError(t, json.Unmarshal(body, &m))
+	assert.Equal(t, "задача не найдена", m["error"])
+
+	_, body = getWithLang(t, "", "en")
+	assert.True(t, strings.Contains(string(body), `<html lang="en"`))
+	assert.False(t, strings.Contains(string(body), "Планировщик задач"))
+}
+
+func TestI18nWrappedErrors(t *testing.T) {
+	wrapped := fmt.Errorf("задача 42: %w", db.ErrNotFound)
+	assert.Equal(t, "task not found", i18n.Err(i18n.EN, wrapped))
+	assert.Equal(t, wrapped.Error(), i18n.Err(i18n.RU, wrapped))
+
+	valErr := nd.NewValidationError("id", fmt.Errorf("id 42: %w", errors.New("некорректный формат id")))
+	assert.Equal(t, "invalid id format", i18n.Err(i18n.EN, valErr))
+	assert.Equal(t, "task not found", i18n.Err(i18n.EN, errors.Join(errors.New("неизвестно"), db.ErrNotFound)))
+
+	unknown := errors.New("сообщение без перевода")
+	assert.Equal(t, unknown.Error(), i18n.Err(i18n.EN, unknown))
+}
@@ -0,0 +1,115 @@
+package tests
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/AsyaBiryukova/go_final_project/internal/auth"
+	"github.com/AsyaBiryukova/go_final_project/internal/db"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJWT(t *testing.T) {
+	storage := startTestDB(t)
+	ctx := context.Background()
+	t.Setenv("TODO_JWT_SECRET", "секрет для тестов")
+	t.Setenv("TODO_ACCESS_TTL", "15m")
+	t.Setenv("TODO_REFRESH_TTL", "24h")
+	require.NoError(t, auth.Init(&storage))
+
+	now := time.Now()
+	tokens, err := auth.IssueTokens(db.DefaultUserID, now)
+	require.NoError(t, err)
+	assert.Equal(t, int64(15*60), tokens.ExpiresIn)
+
+	claims, err := auth.ParseToken(ctx, tokens.AccessToken, auth.TokenAccess)
+	require.NoError(t, err)
+	assert.NotEmpty(t, claims.ID)
+	assert.Equal(t, now.Add(15*time.Minute).Unix(), claims.ExpiresAt.Unix())
+
+	// Токен обновления нельзя использовать для доступа и наоборот
+	_, err = auth.ParseToken(ctx, tokens.RefreshToken, auth.TokenAccess)
+	assert.ErrorIs(t, err, auth.ErrInvalidToken)
+	_, err = auth.ParseToken(ctx, tokens.AccessToken, auth.TokenRefresh)
+	assert.ErrorIs(t, err, auth.ErrInvalidToken)
+
+	sign := func(claims jwt.Claims, key string) string {
+		signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(key))
+		require.NoError(t, err)
+		return signed
+	}
+	valid := auth.Claims{Type: auth.TokenAccess, RegisteredClaims: jwt.RegisteredClaims{
+		ID:        "jti",
+		Subject:   "0",
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute)),
+	}}
+	_, err = auth.ParseToken(ctx, sign(valid, "секрет для тестов"), auth.TokenAccess)
+	assert.NoError(t, err)
+
+	expired := valid
+	expired.ExpiresAt = jwt.NewNumericDate(now.Add(-time.Minute))
+	withoutExp := valid
+	withoutExp.ExpiresAt = nil
+	withoutJTI := valid
+	withoutJTI.ID = ""
+	withoutSub := valid
+	withoutSub.Subject = ""
+	fromFuture := valid
+	fromFuture.IssuedAt = jwt.NewNumericDate(now.Add(time.Hour))
+	unsigned, err := jwt.NewWithClaims(jwt.SigningMethodNone, valid).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	require.NoError(t, err)
+
+	for name, token := range map[string]string{
+		"просроченный":      sign(expired, "секрет для тестов"),
+		"без exp":           sign(withoutExp, "секрет для тестов"),
+		"без jti":           sign(withoutJTI, "секрет для тестов"),
+		"без sub":           sign(withoutSub, "секрет для тестов"),
+		"выпущен в будущем": sign(fromFuture, "секрет для тестов"),
+		"другой ключ":       sign(valid, "duck"),
+		"без подписи":       unsigned,
+		"старый формат":     Token,
+		"пустой":            "",
+	} {
+		_, err = auth.ParseToken(ctx, token, auth.TokenAccess)
+		assert.ErrorIs(t, err, auth.ErrInvalidToken, name)
+	}
+
+	// Токен обновления используется один раз
+	refreshed, err := auth.Refresh(ctx, tokens.RefreshToken, now)
+	require.NoError(t, err)
+	assert.NotEqual(t, tokens.AccessToken, refreshed.AccessToken)
+	_, err = auth.Refresh(ctx, tokens.RefreshToken, now)
+	assert.ErrorIs(t, err, auth.ErrInvalidToken)
+
+	// Отозванный токен не проходит проверку
+	claims, err = auth.ParseToken(ctx, refreshed.AccessToken, auth.TokenAccess)
+	require.NoError(t, err)
+	require.NoError(t, auth.Revoke(ctx, claims, now))
+	_, err = auth.ParseToken(ctx, refreshed.AccessToken, auth.TokenAccess)
+	assert.ErrorIs(t, err, auth.ErrInvalidToken)
+}
+
+func TestRefreshAPI(t *testing.T) {
+	resp, _ := requestV2(t, http.MethodPost, "api/signin/refresh", map[string]any{"refresh_token": "не токен"})
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	resp, _ = requestV2(t, http.MethodPost, "api/signin/refresh", map[string]any{})
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+
+	// Выход удаляет cookie и не требует действующего токена. Токен тестов не передаётся, чтобы выход его не отозвал
+	resp, _ = requestV2(t, http.MethodPost, "api/logout", map[string]any{"refresh_token": "не токен"}, "Authorization", "Bearer не токен")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	var cleared bool
+	for _, cookie := range resp.Cookies() {
+		if cookie.Name == "token" && cookie.MaxAge < 0 {
+			cleared = true
+		}
+	}
+	assert.True(t, cleared)
+	resp, _ = requestV2(t, http.MethodPost, "api/logout", nil, "Authorization", "Bearer не токен")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
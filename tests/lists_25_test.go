@@ -0,0 +1,183 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/AsyaBiryukova/go_final_project/internal/auth"
+	"github.com/AsyaBiryukova/go_final_project/internal/db"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// registerUser регистрирует пользователя с уникальным логином и возвращает заголовок Authorization с его токеном
+func registerUser(t *testing.T, prefix string) string {
+	login := fmt.Sprintf("%s_%d", prefix, time.Now().UnixNano())
+	resp, body := register(t, map[string]any{"login": login, "password": "пароль для тестов"})
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	var tokens auth.TokenPair
+	require.NoError(t, json.Unmarshal(body, &tokens))
+	return "Bearer " + tokens.AccessToken
+}
+
+func TestListsStorage(t *testing.T) {
+	storage := startTestDB(t)
+	ctx := context.Background()
+	now := time.Now()
+
+	var users []int64
+	for _, login := range []string{"owner", "editor", "viewer"} {
+		id, err := storage.AddUser(ctx, login, "hash", now)
+		require.NoError(t, err)
+		users = append(users, id)
+	}
+	owner, editor, viewer := storage.ForUser(users[0]), storage.ForUser(users[1]), storage.ForUser(users[2])
+
+	listID, err := owner.AddList(ctx, "Покупки", now)
+	require.NoError(t, err)
+	for user, role := range map[*db.Storage]string{editor: db.RoleEditor, viewer: db.RoleViewer} {
+		require.NoError(t, owner.AddInvite(ctx, listID, role, "код "+role, now.Add(time.Hour)))
+		list, err := user.AcceptInvite(ctx, "код "+role, now)
+		require.NoError(t, err)
+		assert.Equal(t, role, list.Role)
+	}
+	// Приглашение используется один раз и только до истечения срока
+	_, err = viewer.AcceptInvite(ctx, "код "+db.RoleViewer, now)
+	assert.ErrorIs(t, err, db.ErrInviteNotFound)
+	require.NoError(t, owner.AddInvite(ctx, listID, db.RoleEditor, "истёкший код", now.Add(time.Hour)))
+	_, err = viewer.AcceptInvite(ctx, "истёкший код", now.Add(2*time.Hour))
+	assert.ErrorIs(t, err, db.ErrInviteNotFound)
+	// Приглашать может только владелец
+	assert.ErrorIs(t, editor.AddInvite(ctx, listID, db.RoleOwner, "код редактора", now.Add(time.Hour)), db.ErrForbidden)
+
+	members, err := viewer.GetMembers(ctx, listID)
+	require.NoError(t, err)
+	assert.Len(t, members, 3)
+	_, err = storage.GetMembers(ctx, listID)
+	assert.ErrorIs(t, err, db.ErrListNotFound)
+
+	// Читатель не может добавлять и изменять задачи списка
+	_, err = viewer.AddTask(ctx, db.Task{Date: now.Format(`20060102`), Title: "Молоко", ListID: listID})
+	assert.ErrorIs(t, err, db.ErrForbidden)
+	rowID, err := editor.AddTask(ctx, db.Task{Date: now.Format(`20060102`), Title: "Молоко", Repeat: "d 7", ListID: listID})
+	require.NoError(t, err)
+	id := strconv.FormatInt(rowID, 10)
+
+	task, err := viewer.GetTaskByID(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, listID, task.ListID)
+	tasks, err := viewer.GetTasksList(ctx, db.TaskFilter{ListID: listID})
+	require.NoError(t, err)
+	assert.Len(t, tasks, 1)
+	_, err = storage.GetTaskByID(ctx, id)
+	assert.ErrorIs(t, err, db.ErrNotFound)
+
+	_, err = viewer.PutTask(ctx, task)
+	assert.ErrorIs(t, err, db.ErrForbidden)
+	_, _, err = viewer.CompleteTask(ctx, id, 0, now)
+	assert.ErrorIs(t, err, db.ErrForbidden)
+	_, err = viewer.SkipTask(ctx, id, 0, now.AddDate(0, 0, 14).Format(`20060102`), now)
+	assert.ErrorIs(t, err, db.ErrForbidden)
+	assert.ErrorIs(t, viewer.DeleteTask(ctx, id, 0), db.ErrForbidden)
+	_, _, err = owner.CompleteTask(ctx, id, 0, now)
+	assert.NoError(t, err)
+
+	// В списке всегда остаётся владелец
+	assert.ErrorIs(t, owner.DeleteMember(ctx, listID, users[0]), db.ErrLastOwner)
+	assert.ErrorIs(t, owner.SetMemberRole(ctx, listID, users[0], db.RoleEditor), db.ErrLastOwner)
+	assert.ErrorIs(t, editor.SetMemberRole(ctx, listID, users[2], db.RoleEditor), db.ErrForbidden)
+	require.NoError(t, owner.SetMemberRole(ctx, listID, users[1], db.RoleOwner))
+	require.NoError(t, owner.DeleteMember(ctx, listID, users[0]))
+	// Выйти из списка может любой участник
+	require.NoError(t, viewer.DeleteMember(ctx, listID, users[2]))
+	_, err = viewer.GetTaskByID(ctx, id)
+	assert.ErrorIs(t, err, db.ErrNotFound)
+
+	// Задачи удаляются вместе со списком
+	assert.ErrorIs(t, owner.DeleteList(ctx, listID), db.ErrListNotFound)
+	require.NoError(t, editor.DeleteList(ctx, listID))
+	_, err = editor.GetTaskByID(ctx, id)
+	assert.ErrorIs(t, err, db.ErrNotFound)
+}
+
+func TestListsAPI(t *testing.T) {
+	owner := registerUser(t, "owner")
+	viewer := registerUser(t, "viewer")
+
+	resp, body := requestV2(t, http.MethodPost, "api/lists", map[string]any{"name": "Дом"}, "Authorization", owner)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	var list db.List
+	require.NoError(t, json.Unmarshal(body, &list))
+	assert.Equal(t, db.RoleOwner, list.Role)
+
+	resp, _ = requestV2(t, http.MethodPost, "api/lists/invites?id="+list.ID, map[string]any{"role": "admin"}, "Authorization", owner)
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+	resp, body = requestV2(t, http.MethodPost, "api/lists/invites?id="+list.ID, map[string]any{"role": db.RoleViewer}, "Authorization", owner)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	var invite map[string]string
+	require.NoError(t, json.Unmarshal(body, &invite))
+	resp, body = requestV2(t, http.MethodPost, "api/lists/join", map[string]any{"token": invite["token"]}, "Authorization", viewer)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.NoError(t, json.Unmarshal(body, &list))
+	assert.Equal(t, db.RoleViewer, list.Role)
+
+	resp, body = requestV2(t, http.MethodPost, "api/task", map[string]any{
+		"date":    time.Now().Format(`20060102`),
+		"title":   "Вынести мусор",
+		"list_id": list.ID,
+	}, "Authorization", owner)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	var created map[string]string
+	require.NoError(t, json.Unmarshal(body, &created))
+	id := created["id"]
+
+	// Читатель видит задачу, но не может её изменить, выполнить или удалить
+	resp, body = requestV2(t, http.MethodGet, "api/tasks?list="+list.ID, nil, "Authorization", viewer)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, string(body), "Вынести мусор")
+	for _, req := range []struct {
+		method, path string
+		values       map[string]any
+	}{
+		{http.MethodPut, "api/task", map[string]any{"id": id, "date": time.Now().Format(`20060102`), "title": "Изменено"}},
+		{http.MethodDelete, "api/task?id=" + id, nil},
+		{http.MethodPost, "api/task/done?id=" + id, nil},
+		{http.MethodPost, "api/task", map[string]any{"title": "Новая задача", "list_id": list.ID}},
+	} {
+		resp, body = requestV2(t, req.method, req.path, req.values, "Authorization", viewer, "If-Match", "*")
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode, req.path)
+		assert.Contains(t, string(body), `"code":"forbidden"`)
+	}
+	resp, _ = requestV2(t, http.MethodPut, "api/lists/members?id="+list.ID+"&user_id=0", map[string]any{"role": db.RoleEditor}, "Authorization", viewer)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	resp, body = requestV2(t, http.MethodGet, "api/lists/members?id="+list.ID, nil, "Authorization", viewer)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var members struct {
+		Members []db.Member `json:"members"`
+	}
+	require.NoError(t, json.Unmarshal(body, &members))
+	require.Len(t, members.Members, 2)
+	ownerID := strconv.FormatInt(members.Members[0].UserID, 10)
+	viewerID := strconv.FormatInt(members.Members[1].UserID, 10)
+
+	// Владелец не может покинуть список, в котором больше нет владельцев
+	resp, _ = requestV2(t, http.MethodDelete, "api/lists/members?id="+list.ID+"&user_id="+ownerID, nil, "Authorization", owner)
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+
+	// После повышения до редактора задача выполняется
+	resp, _ = requestV2(t, http.MethodPut, "api/lists/members?id="+list.ID+"&user_id="+viewerID, map[string]any{"role": db.RoleEditor}, "Authorization", owner)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	resp, _ = requestV2(t, http.MethodPost, "api/task/done?id="+id, nil, "Authorization", viewer, "If-Match", "*")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp, _ = requestV2(t, http.MethodDelete, "api/lists?id="+list.ID, nil, "Authorization", viewer)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	resp, _ = requestV2(t, http.MethodDelete, "api/lists?id="+list.ID, nil, "Authorization", owner)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
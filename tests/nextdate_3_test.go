@@ -4,9 +4,11 @@ import (
 	"fmt"
 	"net/url"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	nd "github.com/AsyaBiryukova/go_final_project/internal/nextdate"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -77,3 +79,24 @@ func TestNextDate(t *testing.T) {
 	}
 	check()
 }
+
+// NextDate одновременно вызывают обработчики запросов и фоновая обработка задач
+func TestNextDateConcurrent(t *testing.T) {
+	t.Setenv("TODO_DATEFORMAT", "20060102")
+	now := time.Date(2024, 1, 26, 0, 0, 0, 0, time.UTC)
+	rules := map[string]string{"d 5": "20240131", "y": "20250126", "w 1": "20240129", "m 1": "20240201"}
+
+	var wg sync.WaitGroup
+	for range 20 {
+		for repeat, want := range rules {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				got, err := nd.NextDate(now, "20240126", repeat)
+				assert.NoError(t, err)
+				assert.Equal(t, want, got, repeat)
+			}()
+		}
+	}
+	wg.Wait()
+}
@@ -0,0 +1,105 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/AsyaBiryukova/go_final_project/internal/db"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOverdue(t *testing.T) {
+	db := openDB(t)
+	defer db.Close()
+
+	now := time.Now()
+	for _, days := range []int{-3, 0, 2} {
+		_, err := db.Exec(`INSERT INTO scheduler (date, title, comment, repeat) VALUES (?, 'Проверка срока', '', '')`,
+			now.AddDate(0, 0, days).Format(`20060102`))
+		assert.NoError(t, err)
+	}
+	defer func() {
+		_, err := db.Exec(`DELETE FROM scheduler WHERE title = 'Проверка срока'`)
+		assert.NoError(t, err)
+	}()
+
+	list := func(status string) []map[string]any {
+		path := "api/tasks?search=" + url.QueryEscape("срока")
+		if len(status) > 0 {
+			path += "&status=" + status
+		}
+		resp, body := requestV2(t, http.MethodGet, path, nil)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		var ret map[string][]map[string]any
+		assert.NoError(t, json.Unmarshal(body, &ret))
+		return ret["tasks"]
+	}
+
+	tasks := list("")
+	assert.Len(t, tasks, 3)
+
+	tasks = list("overdue")
+	if assert.Len(t, tasks, 1) {
+		assert.Equal(t, now.AddDate(0, 0, -3).Format(`20060102`), tasks[0]["date"])
+		assert.Equal(t, true, tasks[0]["overdue"])
+	}
+
+	tasks = list("today")
+	if assert.Len(t, tasks, 1) {
+		assert.Equal(t, now.Format(`20060102`), tasks[0]["date"])
+		assert.Nil(t, tasks[0]["overdue"])
+	}
+
+	tasks = list("upcoming")
+	if assert.Len(t, tasks, 1) {
+		assert.Equal(t, now.AddDate(0, 0, 2).Format(`20060102`), tasks[0]["date"])
+	}
+
+	resp, _ := requestV2(t, http.MethodGet, "api/tasks?status=later", nil)
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+}
+
+func TestOverdueDateFormat(t *testing.T) {
+	storage := startTestDB(t)
+	// В формате ДД.ММ.ГГГГ порядок строк не совпадает с порядком дат
+	const layout = "02.01.2006"
+	db.DateFormat = layout
+	t.Cleanup(func() { db.DateFormat = "20060102" })
+
+	now := time.Now()
+	past := time.Date(now.Year()-1, time.December, 31, 0, 0, 0, 0, time.Local)
+	future := time.Date(now.Year()+1, time.January, 1, 0, 0, 0, 0, time.Local)
+	ctx := context.Background()
+	for _, date := range []time.Time{future, now, past} {
+		_, err := storage.AddTask(ctx, db.Task{Date: date.Format(layout), Title: "Формат даты"})
+		require.NoError(t, err)
+	}
+
+	for status, want := range map[string][]string{
+		"":                {future.Format(layout), now.Format(layout), past.Format(layout)},
+		db.StatusOverdue:  {past.Format(layout)},
+		db.StatusToday:    {now.Format(layout)},
+		db.StatusUpcoming: {future.Format(layout)},
+	} {
+		tasks, err := storage.GetTasksList(ctx, db.TaskFilter{Status: status})
+		require.NoError(t, err)
+		dates := []string{}
+		for _, task := range tasks {
+			dates = append(dates, task.Date)
+			assert.Equal(t, task.Date == past.Format(layout), task.Overdue, task.Date)
+		}
+		assert.Equal(t, want, dates, status)
+	}
+
+	// Поиск сортирует задачи по дате
+	tasks, err := storage.GetTasksList(ctx, db.TaskFilter{Search: "%Формат%"})
+	require.NoError(t, err)
+	require.Len(t, tasks, 3)
+	assert.Equal(t, []string{past.Format(layout), now.Format(layout), future.Format(layout)},
+		[]string{tasks[0].Date, tasks[1].Date, tasks[2].Date})
+}
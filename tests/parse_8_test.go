@@ -0,0 +1,57 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type parsed struct {
+	text   string
+	date   string
+	repeat string
+}
+
+func TestParse(t *testing.T) {
+	now := time.Now()
+	today := now.Format(`20060102`)
+
+	tbl := []parsed{
+		{"tomorrow", now.AddDate(0, 0, 1).Format(`20060102`), ""},
+		{"послезавтра", now.AddDate(0, 0, 2).Format(`20060102`), ""},
+		{"через 3 дня", now.AddDate(0, 0, 3).Format(`20060102`), ""},
+		{"every day", today, "d 1"},
+		{"каждые 5 дней", today, "d 5"},
+		{"every year", today, "y"},
+		{"every monday and thursday", "", "w 1,4"},
+		{"каждый последний день месяца", "", "m -1"},
+		{"every 15th of month", "", "m 15"},
+	}
+	for _, v := range tbl {
+		body, err := getBody("api/parse?text=" + url.QueryEscape(v.text))
+		assert.NoError(t, err)
+		var m map[string]string
+		err = json.Unmarshal(body, &m)
+		assert.NoError(t, err)
+
+		assert.Equal(t, v.repeat, m["repeat"], v.text)
+		if len(v.date) > 0 {
+			assert.Equal(t, v.date, m["date"], v.text)
+		} else {
+			assert.GreaterOrEqual(t, m["date"], today, v.text)
+		}
+	}
+
+	// "115th" не должно распознаваться как 15 число
+	for _, text := range []string{"ooops", "every 115th of month"} {
+		body, err := getBody("api/parse?text=" + url.QueryEscape(text))
+		assert.NoError(t, err)
+		var m map[string]string
+		err = json.Unmarshal(body, &m)
+		assert.NoError(t, err)
+		assert.NotEmpty(t, m["error"], text)
+	}
+}
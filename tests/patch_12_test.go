@@ -0,0 +1,58 @@
+package tests
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPatchTask(t *testing.T) {
+	db := openDB(t)
+	defer db.Close()
+
+	// Задача с прошедшей датой, которую не должен переносить PATCH заголовка
+	res, err := db.Exec(`INSERT INTO scheduler (date, title, comment, repeat) VALUES ('20240101', 'Старая задача', 'Комментарий', 'd 5')`)
+	assert.NoError(t, err)
+	rowID, err := res.LastInsertId()
+	assert.NoError(t, err)
+
+	var task Task
+	get := func() {
+		err := db.Get(&task, `SELECT * FROM scheduler WHERE id=?`, rowID)
+		assert.NoError(t, err)
+	}
+	id := strconv.FormatInt(rowID, 10)
+
+	ret, err := postJSON("api/task?id="+id, map[string]any{"title": "Новый заголовок"}, http.MethodPatch, "If-Match", taskETag(t, id))
+	assert.NoError(t, err)
+	assert.Empty(t, ret)
+	get()
+	assert.Equal(t, "Новый заголовок", task.Title)
+	assert.Equal(t, "Комментарий", task.Comment)
+	assert.Equal(t, "20240101", task.Date)
+	assert.Equal(t, "d 5", task.Repeat)
+
+	ret, err = postJSON("api/task?id="+id, map[string]any{"comment": nil, "repeat": nil}, http.MethodPatch, "If-Match", taskETag(t, id))
+	assert.NoError(t, err)
+	assert.Empty(t, ret)
+	get()
+	assert.Equal(t, "", task.Comment)
+	assert.Equal(t, "", task.Repeat)
+	// Изменение repeat запускает корректировку прошедшей даты
+	assert.NotEqual(t, "20240101", task.Date)
+
+	for _, patch := range []map[string]any{
+		{"title": ""},
+		{"repeat": "ooops"},
+		{"unknown": "field"},
+	} {
+		ret, err = postJSON("api/task?id="+id, patch, http.MethodPatch, "If-Match", taskETag(t, id))
+		assert.NoError(t, err)
+		assert.NotEmpty(t, ret["error"], "%v", patch)
+	}
+
+	_, err = db.Exec(`DELETE FROM scheduler WHERE id = ?`, rowID)
+	assert.NoError(t, err)
+}
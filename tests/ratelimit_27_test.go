@@ -0,0 +1,163 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/AsyaBiryukova/go_final_project/internal/auth"
+	"github.com/AsyaBiryukova/go_final_project/internal/ratelimit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRate(t *testing.T) {
+	for s, want := range map[string]ratelimit.Rate{
+		"10/s":  {Limit: 10, Per: time.Second},
+		"600/m": {Limit: 600, Per: time.Minute},
+		"5/h":   {Limit: 5, Per: time.Hour},
+		"0":     {},
+	} {
+		rate, err := ratelimit.ParseRate(s)
+		require.NoError(t, err, s)
+		assert.Equal(t, want, rate, s)
+	}
+	for _, s := range []string{"", "10", "10/d", "-1/s", "0/m", "много/s"} {
+		_, err := ratelimit.ParseRate(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	now := time.Now()
+	limiter := ratelimit.NewLimiter(ratelimit.Rate{Limit: 3, Per: time.Minute})
+
+	for i := 0; i < 3; i++ {
+		ok, _ := limiter.Allow("10.0.0.1", now)
+		assert.True(t, ok)
+	}
+	ok, retryAfter := limiter.Allow("10.0.0.1", now)
+	assert.False(t, ok)
+	assert.Equal(t, 20*time.Second, retryAfter)
+	// У каждого адреса свой лимит
+	ok, _ = limiter.Allow("10.0.0.2", now)
+	assert.True(t, ok)
+	// Запросы восстанавливаются равномерно
+	ok, _ = limiter.Allow("10.0.0.1", now.Add(20*time.Second))
+	assert.True(t, ok)
+	ok, _ = limiter.Allow("10.0.0.1", now.Add(20*time.Second))
+	assert.False(t, ok)
+
+	// Нулевая частота отключает ограничение
+	disabled := ratelimit.NewLimiter(ratelimit.Rate{})
+	for i := 0; i < 100; i++ {
+		ok, _ = disabled.Allow("10.0.0.1", now)
+		require.True(t, ok)
+	}
+}
+
+func TestLimiterMiddleware(t *testing.T) {
+	handler := ratelimit.NewLimiter(ratelimit.Rate{Limit: 1, Per: time.Hour}).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/tasks", nil)
+	req.RemoteAddr = "10.0.0.1:5000"
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	// Порт клиента не влияет на лимит
+	req.RemoteAddr = "10.0.0.1:5001"
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "3600", rec.Header().Get("Retry-After"))
+	assert.Contains(t, rec.Body.String(), `"code":"too_many_requests"`)
+}
+
+func TestLockout(t *testing.T) {
+	now := time.Now()
+	lockout := ratelimit.NewLockout(3, time.Second, 10*time.Second)
+
+	assert.Zero(t, lockout.Attempt("10.0.0.1", now))
+	assert.Zero(t, lockout.Attempt("10.0.0.1", now))
+	// Срок блокировки удваивается с каждой неудачной попыткой, но не больше максимального.
+	// Попытка заблокированного ключа не учитывается
+	at := now
+	for _, want := range []time.Duration{1, 2, 4, 8, 10, 10} {
+		assert.Zero(t, lockout.Attempt("10.0.0.1", at))
+		assert.Equal(t, want*time.Second, lockout.Attempt("10.0.0.1", at))
+		at = at.Add(want * time.Second)
+	}
+	assert.Equal(t, 4*time.Second, lockout.Attempt("10.0.0.1", at.Add(-4*time.Second)))
+	assert.Zero(t, lockout.Attempt("10.0.0.2", now))
+
+	// Успешная попытка сбрасывает счётчик
+	lockout.Reset("10.0.0.1")
+	assert.Zero(t, lockout.Attempt("10.0.0.1", at.Add(-4*time.Second)))
+	assert.Zero(t, lockout.Attempt("10.0.0.1", at.Add(-4*time.Second)))
+
+	// Счётчик сбрасывается, если попыток не было дольше максимального срока
+	lockout.Attempt("10.0.0.3", now)
+	lockout.Attempt("10.0.0.3", now)
+	assert.Zero(t, lockout.Attempt("10.0.0.3", now.Add(11*time.Second)))
+	assert.Zero(t, lockout.Attempt("10.0.0.3", now.Add(11*time.Second)))
+
+	// Нулевой Lockout ничего не блокирует
+	var disabled *ratelimit.Lockout
+	for range 10 {
+		require.Zero(t, disabled.Attempt("10.0.0.1", now))
+	}
+}
+
+func TestLockoutAttempt(t *testing.T) {
+	now := time.Now()
+	lockout := ratelimit.NewLockout(3, time.Second, 10*time.Second)
+
+	// Параллельные попытки проверяются не больше порога раз, даже пока ни одна не завершилась
+	var admitted atomic.Int32
+	var wg sync.WaitGroup
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if lockout.Attempt("10.0.0.1", now) == 0 {
+				admitted.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(3), admitted.Load())
+	assert.Equal(t, time.Second, lockout.Attempt("10.0.0.1", now))
+
+	// Параллельные удачные попытки не оставляют блокировку
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if lockout.Attempt("10.0.0.2", now) == 0 {
+				lockout.Release("10.0.0.2")
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Zero(t, lockout.Attempt("10.0.0.2", now))
+
+	// Удачная попытка отменяет свой учёт и снимает блокировку, которую установила
+	assert.Zero(t, lockout.Attempt("10.0.0.3", now))
+	assert.Zero(t, lockout.Attempt("10.0.0.3", now))
+	assert.Zero(t, lockout.Attempt("10.0.0.3", now))
+	assert.Positive(t, lockout.Attempt("10.0.0.3", now))
+	lockout.Release("10.0.0.3")
+	assert.Zero(t, lockout.Attempt("10.0.0.3", now))
+}
+
+func TestEqualPasswords(t *testing.T) {
+	assert.True(t, auth.EqualPasswords("duck", "duck"))
+	assert.False(t, auth.EqualPasswords("duck", "duc"))
+	assert.False(t, auth.EqualPasswords("", "duck"))
+}
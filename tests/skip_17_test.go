@@ -0,0 +1,90 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSkip(t *testing.T) {
+	db := openDB(t)
+	defer db.Close()
+
+	now := time.Now()
+	day := func(days int) string {
+		return now.AddDate(0, 0, days).Format(`20060102`)
+	}
+	id := addTask(t, task{
+		date:   day(0),
+		title:  "Задача через день",
+		repeat: "d 2",
+	})
+
+	var row Task
+	get := func() {
+		err := db.Get(&row, `SELECT * FROM scheduler WHERE id=?`, id)
+		assert.NoError(t, err)
+	}
+	completions := func() int {
+		var count int
+		err := db.Get(&count, `SELECT count(*) FROM completions WHERE task_id=?`, id)
+		assert.NoError(t, err)
+		return count
+	}
+
+	// Пропуск будущей даты заранее
+	resp, _ := requestV2(t, http.MethodPost, "api/task/skip?id="+id+"&date="+day(4), nil, "If-Match", "*")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	get()
+	assert.Equal(t, day(0), row.Date)
+
+	resp, body := requestV2(t, http.MethodGet, "api/task/skip?id="+id, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	var ret map[string][]string
+	assert.NoError(t, json.Unmarshal(body, &ret))
+	assert.Equal(t, []string{day(4)}, ret["dates"])
+
+	// Пропуск текущего повторения не записывает выполнение
+	resp, _ = requestV2(t, http.MethodPost, "api/task/skip?id="+id, nil, "If-Match", "*")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	get()
+	assert.Equal(t, day(2), row.Date)
+	assert.Equal(t, 0, completions())
+
+	// Выполнение записывается и пропускает заранее отмеченную дату
+	_, err := postJSON("api/task/done?id="+id, nil, http.MethodPost, "If-Match", taskETag(t, id))
+	assert.NoError(t, err)
+	get()
+	assert.Equal(t, day(6), row.Date)
+	assert.Equal(t, 1, completions())
+
+	resp, body = requestV2(t, http.MethodGet, "api/task/skip?id="+id, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.NoError(t, json.Unmarshal(body, &ret))
+	assert.Empty(t, ret["dates"])
+
+	// Удаление пропускаемой даты
+	resp, _ = requestV2(t, http.MethodPost, "api/task/skip?id="+id+"&date="+day(8), nil, "If-Match", "*")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp, _ = requestV2(t, http.MethodDelete, "api/task/skip?id="+id+"&date="+day(8), nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp, _ = requestV2(t, http.MethodDelete, "api/task/skip?id="+id+"&date="+day(8), nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp, _ = requestV2(t, http.MethodPost, "api/task/skip?id="+id+"&date="+day(0), nil, "If-Match", "*")
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+	resp, _ = requestV2(t, http.MethodPost, "api/task/skip?id="+id+"&date=soon", nil, "If-Match", "*")
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+
+	once := addTask(t, task{date: day(0), title: "Разовая задача"})
+	resp, _ = requestV2(t, http.MethodPost, "api/task/skip?id="+once, nil, "If-Match", "*")
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+	resp, _ = requestV2(t, http.MethodPost, "api/task/skip?id=999999999", nil, "If-Match", "*")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	_, err = db.Exec(`DELETE FROM scheduler WHERE id IN (?, ?)`, id, once)
+	assert.NoError(t, err)
+}
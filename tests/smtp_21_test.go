@@ -0,0 +1,224 @@
+package tests
+
+import (
+	"context"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/AsyaBiryukova/go_final_project/internal/db"
+	"github.com/AsyaBiryukova/go_final_project/internal/notify"
+	"github.com/AsyaBiryukova/go_final_project/internal/worker"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// smtpMessage описывает письмо, принятое тестовым SMTP сервером
+type smtpMessage struct {
+	from string
+	to   []string
+	data string
+}
+
+// smtpServer принимает письма по протоколу SMTP без расширений и запоминает их
+type smtpServer struct {
+	ln       net.Listener
+	mu       sync.Mutex
+	messages []smtpMessage
+}
+
+func startSMTPServer(t *testing.T) *smtpServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	s := &smtpServer{ln: ln}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *smtpServer) serve(conn net.Conn) {
+	c := textproto.NewConn(conn)
+	defer c.Close()
+
+	var msg smtpMessage
+	_ = c.PrintfLine("220 localhost")
+	for {
+		line, err := c.ReadLine()
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		switch cmd {
+		case "EHLO", "HELO":
+			_ = c.PrintfLine("250 localhost")
+		case "MAIL":
+			msg = smtpMessage{from: strings.Trim(strings.TrimPrefix(line, "MAIL FROM:"), "<>")}
+			_ = c.PrintfLine("250 OK")
+		case "RCPT":
+			msg.to = append(msg.to, strings.Trim(strings.TrimPrefix(line, "RCPT TO:"), "<>"))
+			_ = c.PrintfLine("250 OK")
+		case "DATA":
+			_ = c.PrintfLine("354 OK")
+			data, err := io.ReadAll(c.DotReader())
+			if err != nil {
+				return
+			}
+			msg.data = string(data)
+			s.mu.Lock()
+			s.messages = append(s.messages, msg)
+			s.mu.Unlock()
+			_ = c.PrintfLine("250 OK")
+		case "QUIT":
+			_ = c.PrintfLine("221 OK")
+			return
+		default:
+			_ = c.PrintfLine("502 not implemented")
+		}
+	}
+}
+
+// received возвращает принятые письма
+func (s *smtpServer) received() []smtpMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]smtpMessage(nil), s.messages...)
+}
+
+// parseMail возвращает тему, текстовую и HTML части письма
+func parseMail(t *testing.T, data string) (subject, text, html string) {
+	msg, err := mail.ReadMessage(strings.NewReader(data))
+	require.NoError(t, err)
+	subject, err = new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	require.NoError(t, err)
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	require.NoError(t, err)
+	require.Equal(t, "multipart/alternative", mediaType)
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		body, err := io.ReadAll(part)
+		require.NoError(t, err)
+		switch {
+		case strings.HasPrefix(part.Header.Get("Content-Type"), "text/plain"):
+			text = string(body)
+		case strings.HasPrefix(part.Header.Get("Content-Type"), "text/html"):
+			html = string(body)
+		}
+	}
+	return subject, text, html
+}
+
+func TestSMTPConfig(t *testing.T) {
+	t.Setenv("TODO_SMTP_ADDR", "")
+	cfg, err := notify.SMTPConfigFromEnv()
+	assert.NoError(t, err)
+	assert.Empty(t, cfg.Addr)
+
+	t.Setenv("TODO_SMTP_ADDR", "smtp.example.com:587")
+	t.Setenv("TODO_SMTP_FROM", "todo@example.com")
+	t.Setenv("TODO_SMTP_TO", "a@example.com, b@example.com")
+	cfg, err = notify.SMTPConfigFromEnv()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a@example.com", "b@example.com"}, cfg.To)
+
+	t.Setenv("TODO_SMTP_TO", "")
+	_, err = notify.SMTPConfigFromEnv()
+	assert.Error(t, err)
+	t.Setenv("TODO_SMTP_ADDR", "smtp.example.com")
+	_, err = notify.SMTPConfigFromEnv()
+	assert.Error(t, err)
+
+	t.Setenv("TODO_DIGEST_TIME", "07:30")
+	at, ok, err := worker.DigestTime()
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, 7*time.Hour+30*time.Minute, at)
+	t.Setenv("TODO_DIGEST_TIME", "25:00")
+	_, _, err = worker.DigestTime()
+	assert.Error(t, err)
+}
+
+func TestSMTPNotifier(t *testing.T) {
+	storage := startTestDB(t)
+	ctx := context.Background()
+	server := startSMTPServer(t)
+	cfg := notify.SMTPConfig{
+		Addr: server.ln.Addr().String(),
+		From: "todo@example.com",
+		To:   []string{"user@example.com", "team@example.com"},
+	}
+
+	now := time.Now()
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	for _, task := range []db.Task{
+		{Date: now.Format(`20060102`), Title: "Купить <молоко>", Comment: "2 литра"},
+		{Date: now.AddDate(0, 0, -3).Format(`20060102`), Title: "Сдать отчёт"},
+		{Date: now.AddDate(0, 0, 2).Format(`20060102`), Title: "Позвонить"},
+	} {
+		_, err := storage.AddTask(ctx, task)
+		require.NoError(t, err)
+	}
+
+	// Недоставленные письма отправляются при следующей проверке
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	unavailable := cfg
+	unavailable.Addr = closed.Addr().String()
+	require.NoError(t, closed.Close())
+	w := worker.New(&storage, notify.NewSMTP(unavailable), time.Hour)
+	w.SendDigestAt(9 * time.Hour)
+	w.TickAt(ctx, midnight.Add(10*time.Hour))
+
+	// До времени сводки отправляются только напоминания
+	w = worker.New(&storage, notify.NewSMTP(cfg), time.Hour)
+	w.SendDigestAt(9 * time.Hour)
+	w.TickAt(ctx, midnight.Add(8*time.Hour))
+	messages := server.received()
+	require.Len(t, messages, 1)
+	assert.Equal(t, "todo@example.com", messages[0].from)
+	assert.Equal(t, cfg.To, messages[0].to)
+
+	subject, text, html := parseMail(t, messages[0].data)
+	assert.Equal(t, "Напоминание: Купить <молоко>", subject)
+	assert.Contains(t, text, "Купить <молоко>")
+	assert.Contains(t, text, "2 литра")
+	assert.Contains(t, text, now.Format("02.01.2006"))
+	assert.Contains(t, html, "Купить &lt;молоко&gt;")
+
+	// Сводка отправляется один раз в день после указанного времени
+	w.TickAt(ctx, midnight.Add(10*time.Hour))
+	w.TickAt(ctx, midnight.Add(11*time.Hour))
+	messages = server.received()
+	require.Len(t, messages, 2)
+
+	subject, text, html = parseMail(t, messages[1].data)
+	assert.Equal(t, "Задачи на "+now.Format("02.01.2006"), subject)
+	today, overdue, found := strings.Cut(text, "Просрочено:")
+	require.True(t, found)
+	assert.Contains(t, today, "Купить <молоко>")
+	assert.Contains(t, overdue, "Сдать отчёт")
+	assert.Contains(t, overdue, now.AddDate(0, 0, -3).Format("02.01.2006"))
+	assert.NotContains(t, text, "Позвонить")
+	assert.Contains(t, html, "Сдать отчёт")
+}
@@ -0,0 +1,79 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSnooze(t *testing.T) {
+	db := openDB(t)
+	defer db.Close()
+
+	now := time.Now()
+	today := now.Format(`20060102`)
+	id := addTask(t, task{
+		date:   today,
+		title:  "Еженедельная задача",
+		repeat: "d 7",
+	})
+
+	var task Task
+	get := func() {
+		err := db.Get(&task, `SELECT * FROM scheduler WHERE id=?`, id)
+		assert.NoError(t, err)
+	}
+
+	resp, body := requestV2(t, http.MethodPost, "api/task/snooze?id="+id+"&until=2d", nil, "If-Match", "*")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.NotEmpty(t, resp.Header.Get("ETag"))
+	var ret map[string]string
+	assert.NoError(t, json.Unmarshal(body, &ret))
+	assert.Equal(t, now.AddDate(0, 0, 2).Format(`20060102`), ret["date"])
+	assert.Equal(t, today, ret["snoozed_from"])
+
+	get()
+	assert.Equal(t, now.AddDate(0, 0, 2).Format(`20060102`), task.Date)
+	assert.Equal(t, "d 7", task.Repeat)
+	assert.Equal(t, today, task.SnoozedFrom)
+
+	// Повторное откладывание сохраняет исходную дату
+	resp, _ = requestV2(t, http.MethodPost, "api/task/snooze?id="+id+"&until=next-week", nil, "If-Match", "*")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	get()
+	date, err := time.Parse(`20060102`, task.Date)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Monday, date.Weekday())
+	assert.True(t, date.After(now))
+	assert.Equal(t, today, task.SnoozedFrom)
+
+	// Выполнение возвращает задачу к исходному расписанию
+	ret2, err := postJSON("api/task/done?id="+id, nil, http.MethodPost, "If-Match", taskETag(t, id))
+	assert.NoError(t, err)
+	assert.Empty(t, ret2)
+	get()
+	assert.Equal(t, now.AddDate(0, 0, 7).Format(`20060102`), task.Date)
+	assert.Empty(t, task.SnoozedFrom)
+
+	for _, until := range []string{"", "soon", "20000101", now.AddDate(0, 0, -1).Format(`20060102`)} {
+		resp, _ = requestV2(t, http.MethodPost, "api/task/snooze?id="+id+"&until="+until, nil, "If-Match", "*")
+		assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode, until)
+	}
+	resp, _ = requestV2(t, http.MethodPost, "api/task/snooze?id=999999999&until=1d", nil, "If-Match", "*")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp, _ = requestV2(t, http.MethodPost, "api/task/snooze?id="+id+"&until=tomorrow", nil)
+	assert.Equal(t, http.StatusPreconditionRequired, resp.StatusCode)
+	resp, _ = requestV2(t, http.MethodPost, "api/v2/tasks/"+id+"/snooze?until=tomorrow", nil)
+	assert.Equal(t, http.StatusPreconditionRequired, resp.StatusCode)
+	resp, _ = requestV2(t, http.MethodPost, "api/v2/tasks/"+id+"/snooze?until=tomorrow", nil, "If-Match", "*")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	get()
+	assert.Equal(t, now.AddDate(0, 0, 1).Format(`20060102`), task.Date)
+
+	_, err = db.Exec(`DELETE FROM scheduler WHERE id=?`, id)
+	assert.NoError(t, err)
+}
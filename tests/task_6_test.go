@@ -96,7 +96,7 @@ func TestEditTask(t *testing.T) {
 	}
 
 	updateTask := func(newVals map[string]any) {
-		mupd, err := postJSON("api/task", newVals, http.MethodPut)
+		mupd, err := postJSON("api/task", newVals, http.MethodPut, "If-Match", taskETag(t, id))
 		assert.NoError(t, err)
 
 		e, ok := mupd["error"]
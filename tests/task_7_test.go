@@ -29,7 +29,7 @@ func TestDone(t *testing.T) {
 		title: "Свести баланс",
 	})
 
-	ret, err := postJSON("api/task/done?id="+id, nil, http.MethodPost)
+	ret, err := postJSON("api/task/done?id="+id, nil, http.MethodPost, "If-Match", taskETag(t, id))
 	assert.NoError(t, err)
 	assert.Empty(t, ret)
 	notFoundTask(t, id)
@@ -40,7 +40,7 @@ func TestDone(t *testing.T) {
 	})
 
 	for i := 0; i < 3; i++ {
-		ret, err := postJSON("api/task/done?id="+id, nil, http.MethodPost)
+		ret, err := postJSON("api/task/done?id="+id, nil, http.MethodPost, "If-Match", taskETag(t, id))
 		assert.NoError(t, err)
 		assert.Empty(t, ret)
 
@@ -60,7 +60,7 @@ func TestDelTask(t *testing.T) {
 		title:  "Временная задача",
 		repeat: "d 3",
 	})
-	ret, err := postJSON("api/task?id="+id, nil, http.MethodDelete)
+	ret, err := postJSON("api/task?id="+id, nil, http.MethodDelete, "If-Match", taskETag(t, id))
 	assert.NoError(t, err)
 	assert.Empty(t, ret)
 
@@ -0,0 +1,141 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/AsyaBiryukova/go_final_project/internal/auth"
+	"github.com/AsyaBiryukova/go_final_project/internal/db"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPITokensStorage(t *testing.T) {
+	storage := startTestDB(t)
+	ctx := context.Background()
+	now := time.Now()
+
+	userID, err := storage.AddUser(ctx, "cron", "hash", now)
+	require.NoError(t, err)
+	user := storage.ForUser(userID)
+
+	secret, err := auth.NewAPIToken()
+	require.NoError(t, err)
+	assert.Regexp(t, "^todo_[0-9a-f]{64}$", secret)
+	id, err := user.AddAPIToken(ctx, db.APIToken{Name: "cron", Scopes: []string{auth.ScopeTasksRead}, Token: secret}, now)
+	require.NoError(t, err)
+
+	// Токены видны только владельцу, сам токен не возвращается
+	tokens, err := storage.GetAPITokens(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, tokens)
+	tokens, err = user.GetAPITokens(ctx)
+	require.NoError(t, err)
+	require.Len(t, tokens, 1)
+	assert.Empty(t, tokens[0].Token)
+	assert.Empty(t, tokens[0].LastUsedAt)
+	assert.Equal(t, []string{auth.ScopeTasksRead}, tokens[0].Scopes)
+
+	usedID, usedBy, scopes, err := storage.UseAPIToken(ctx, secret, now)
+	require.NoError(t, err)
+	assert.Equal(t, id, usedID)
+	assert.Equal(t, userID, usedBy)
+	assert.Equal(t, []string{auth.ScopeTasksRead}, scopes)
+	tokens, err = user.GetAPITokens(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, now.UTC().Format(time.RFC3339), tokens[0].LastUsedAt)
+
+	// Отозвать токен может только его владелец
+	assert.ErrorIs(t, storage.DeleteAPIToken(ctx, id), db.ErrAPITokenNotFound)
+	require.NoError(t, user.DeleteAPIToken(ctx, id))
+	_, _, _, err = storage.UseAPIToken(ctx, secret, now)
+	assert.ErrorIs(t, err, db.ErrAPITokenNotFound)
+}
+
+func TestAPITokensAPI(t *testing.T) {
+	user := registerUser(t, "cron")
+
+	for _, values := range []map[string]any{
+		{"name": "", "scopes": []string{auth.ScopeTasksRead}},
+		{"name": "cron", "scopes": []string{}},
+		{"name": "cron", "scopes": []string{"tasks:admin"}},
+	} {
+		resp, _ := requestV2(t, http.MethodPost, "api/tokens", values, "Authorization", user)
+		assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+	}
+
+	newToken := func(scopes ...string) db.APIToken {
+		resp, body := requestV2(t, http.MethodPost, "api/tokens", map[string]any{"name": "cron", "scopes": scopes}, "Authorization", user)
+		require.Equal(t, http.StatusCreated, resp.StatusCode)
+		var token db.APIToken
+		require.NoError(t, json.Unmarshal(body, &token))
+		require.NotEmpty(t, token.Token)
+		return token
+	}
+	reader := newToken(auth.ScopeTasksRead)
+	writer := newToken(auth.ScopeTasksRead, auth.ScopeTasksWrite)
+
+	resp, body := requestV2(t, http.MethodGet, "api/tokens", nil, "Authorization", user)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.NotContains(t, string(body), reader.Token)
+	assert.NotContains(t, string(body), `"token"`)
+
+	// Токен с правом tasks:write создаёт задачу от имени пользователя
+	resp, body = requestV2(t, http.MethodPost, "api/v2/tasks", map[string]any{
+		"date":  time.Now().Format(`20060102`),
+		"title": "Задача из скрипта",
+	}, "Authorization", "Bearer "+writer.Token)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	var created map[string]any
+	require.NoError(t, json.Unmarshal(body, &created))
+	id := created["id"].(string)
+	resp, _ = requestV2(t, http.MethodGet, "api/v2/tasks/"+id, nil, "Authorization", user)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// Токен с правом tasks:read только читает
+	resp, _ = requestV2(t, http.MethodGet, "api/v2/tasks/"+id, nil, "Authorization", "Bearer "+reader.Token)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp, body = requestV2(t, http.MethodPost, "api/task/done?id="+id, nil, "Authorization", "Bearer "+reader.Token)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	assert.Contains(t, string(body), `"code":"forbidden"`)
+
+	// API токеном нельзя управлять токенами
+	resp, _ = requestV2(t, http.MethodGet, "api/tokens", nil, "Authorization", "Bearer "+writer.Token)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	resp, _ = requestV2(t, http.MethodPost, "api/tokens", map[string]any{"name": "cron", "scopes": []string{auth.ScopeTasksWrite}}, "Authorization", "Bearer "+writer.Token)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	// и регистрировать пользователей
+	resp, _ = requestV2(t, http.MethodPost, "api/register", map[string]any{"login": "cron_" + reader.ID, "password": "пароль для тестов"}, "Authorization", "Bearer "+writer.Token)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	// и управлять webhook и списками задач
+	for _, req := range []struct {
+		method, path string
+		values       map[string]any
+	}{
+		{http.MethodGet, "api/webhooks", nil},
+		{http.MethodPost, "api/webhooks", map[string]any{"url": "http://127.0.0.1:1/hook", "events": []string{"task.created"}}},
+		{http.MethodGet, "api/webhooks/deliveries?id=1", nil},
+		{http.MethodGet, "api/lists", nil},
+		{http.MethodPost, "api/lists", map[string]any{"name": "Список токена"}},
+		{http.MethodGet, "api/lists/members?id=1", nil},
+		{http.MethodPost, "api/lists/invites?id=1", map[string]any{"role": "editor"}},
+		{http.MethodPost, "api/lists/join", map[string]any{"token": "приглашение"}},
+	} {
+		resp, _ = requestV2(t, req.method, req.path, req.values, "Authorization", "Bearer "+writer.Token)
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode, "%s %s", req.method, req.path)
+	}
+
+	// Отозванный токен больше не даёт доступ к задачам пользователя
+	resp, _ = requestV2(t, http.MethodDelete, "api/tokens?id="+reader.ID, nil, "Authorization", user)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	resp, _ = requestV2(t, http.MethodDelete, "api/tokens?id="+reader.ID, nil, "Authorization", user)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	resp, _ = requestV2(t, http.MethodGet, "api/v2/tasks/"+id, nil, "Authorization", "Bearer "+reader.Token)
+	assert.NotEqual(t, http.StatusOK, resp.StatusCode)
+
+	resp, _ = requestV2(t, http.MethodDelete, "api/v2/tasks/"+id, nil, "Authorization", "Bearer "+writer.Token, "If-Match", "*")
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+}
@@ -0,0 +1,143 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/AsyaBiryukova/go_final_project/internal/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTOTPCode(t *testing.T) {
+	// Тестовые значения из RFC 6238 для SHA1, последние 6 цифр восьмизначного кода
+	secret := "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+	for unix, want := range map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1111111111: "050471",
+		1234567890: "005924",
+		2000000000: "279037",
+	} {
+		code, err := auth.TOTPCode(secret, auth.TOTPStep(time.Unix(unix, 0)))
+		require.NoError(t, err)
+		assert.Equal(t, want, code, unix)
+	}
+
+	now := time.Unix(1111111111, 0)
+	step := auth.TOTPStep(now)
+	// Принимаются коды соседних периодов, но не использованные ранее
+	for _, s := range []int64{step - 1, step, step + 1} {
+		code, _ := auth.TOTPCode(secret, s)
+		got, ok := auth.CheckTOTP(secret, code, now, 0)
+		assert.True(t, ok)
+		assert.Equal(t, s, got)
+	}
+	code, _ := auth.TOTPCode(secret, step)
+	_, ok := auth.CheckTOTP(secret, code, now, step)
+	assert.False(t, ok)
+	code, _ = auth.TOTPCode(secret, step+2)
+	_, ok = auth.CheckTOTP(secret, code, now, 0)
+	assert.False(t, ok)
+	_, ok = auth.CheckTOTP(secret, "12345", now, 0)
+	assert.False(t, ok)
+
+	uri, err := url.Parse(auth.TOTPURI(secret, "alice"))
+	require.NoError(t, err)
+	assert.Equal(t, "otpauth", uri.Scheme)
+	assert.Equal(t, "totp", uri.Host)
+	assert.Equal(t, "/Планировщик задач:alice", uri.Path)
+	assert.Equal(t, secret, uri.Query().Get("secret"))
+	assert.Equal(t, "6", uri.Query().Get("digits"))
+
+	codes, err := auth.NewRecoveryCodes()
+	require.NoError(t, err)
+	assert.Len(t, codes, 10)
+	assert.Regexp(t, "^[a-z2-7]{4}-[a-z2-7]{4}-[a-z2-7]{4}-[a-z2-7]{4}$", codes[0])
+	assert.False(t, auth.IsTOTPCode(codes[0]))
+	assert.True(t, auth.IsTOTPCode("012345"))
+}
+
+func TestTOTPSignin(t *testing.T) {
+	login := fmt.Sprintf("totp_%d", time.Now().UnixNano())
+	resp, body := register(t, map[string]any{"login": login, "password": "пароль для тестов"})
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	var registered auth.TokenPair
+	require.NoError(t, json.Unmarshal(body, &registered))
+	bearer := "Bearer " + registered.AccessToken
+
+	signin := func() map[string]any {
+		resp, body := requestV2(t, http.MethodPost, "api/signin", map[string]any{"login": login, "password": "пароль для тестов"})
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		var result map[string]any
+		require.NoError(t, json.Unmarshal(body, &result))
+		return result
+	}
+	signinTOTP := func(mfaToken, code string) (int, map[string]any) {
+		resp, body := requestV2(t, http.MethodPost, "api/signin/totp", map[string]any{"mfa_token": mfaToken, "code": code})
+		var result map[string]any
+		require.NoError(t, json.Unmarshal(body, &result))
+		return resp.StatusCode, result
+	}
+
+	// До подтверждения секрета вход не требует кода
+	resp, _ = requestV2(t, http.MethodPost, "api/totp/confirm", map[string]any{"code": "000000"}, "Authorization", bearer)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	resp, body = requestV2(t, http.MethodPost, "api/totp", nil, "Authorization", bearer)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	var enrollment map[string]string
+	require.NoError(t, json.Unmarshal(body, &enrollment))
+	secret := enrollment["secret"]
+	assert.Contains(t, enrollment["uri"], "otpauth://totp/")
+	assert.Contains(t, enrollment["uri"], "secret="+secret)
+	assert.Contains(t, signin(), "token")
+
+	resp, _ = requestV2(t, http.MethodPost, "api/totp/confirm", map[string]any{"code": "000000"}, "Authorization", bearer)
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+	// Код предыдущего периода ещё принимается, а следующий вход использует код текущего периода
+	code, err := auth.TOTPCode(secret, auth.TOTPStep(time.Now())-1)
+	require.NoError(t, err)
+	resp, body = requestV2(t, http.MethodPost, "api/totp/confirm", map[string]any{"code": code}, "Authorization", bearer)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var recovery map[string][]string
+	require.NoError(t, json.Unmarshal(body, &recovery))
+	require.Len(t, recovery["recovery_codes"], 10)
+	resp, _ = requestV2(t, http.MethodPost, "api/totp", nil, "Authorization", bearer)
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+
+	// После проверки пароля выдаётся только mfa_token
+	challenge := signin()
+	assert.NotContains(t, challenge, "token")
+	mfaToken := challenge["mfa_token"].(string)
+	status, _ := signinTOTP(mfaToken, "000000")
+	assert.Equal(t, http.StatusUnauthorized, status)
+	// Использованный код не принимается повторно
+	status, _ = signinTOTP(mfaToken, code)
+	assert.Equal(t, http.StatusUnauthorized, status)
+	code, err = auth.TOTPCode(secret, auth.TOTPStep(time.Now()))
+	require.NoError(t, err)
+	status, tokens := signinTOTP(mfaToken, code)
+	require.Equal(t, http.StatusOK, status)
+	assert.NotEmpty(t, tokens["token"])
+	// mfa_token обменивается на токены один раз
+	status, _ = signinTOTP(mfaToken, recovery["recovery_codes"][0])
+	assert.Equal(t, http.StatusUnauthorized, status)
+
+	// Код восстановления заменяет код TOTP один раз
+	mfaToken = signin()["mfa_token"].(string)
+	status, _ = signinTOTP(mfaToken, recovery["recovery_codes"][0])
+	require.Equal(t, http.StatusOK, status)
+	mfaToken = signin()["mfa_token"].(string)
+	status, _ = signinTOTP(mfaToken, recovery["recovery_codes"][0])
+	assert.Equal(t, http.StatusUnauthorized, status)
+
+	resp, _ = requestV2(t, http.MethodDelete, "api/totp", map[string]any{"code": "000000"}, "Authorization", bearer)
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+	resp, _ = requestV2(t, http.MethodDelete, "api/totp", map[string]any{"code": recovery["recovery_codes"][1]}, "Authorization", bearer)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, signin(), "token")
+}
@@ -0,0 +1,105 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func requestV2(t *testing.T, method, path string, values map[string]any, headers ...string) (*http.Response, []byte) {
+	var data []byte
+	if values != nil {
+		var err error
+		data, err = json.Marshal(values)
+		assert.NoError(t, err)
+	}
+	req, err := http.NewRequest(method, getURL(path), bytes.NewReader(data))
+	assert.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	// Запросы от имени другого пользователя или с cookie передают свои заголовки
+	if len(req.Header.Get("Authorization")) == 0 && len(req.Header.Get("Cookie")) == 0 {
+		token, err := authToken()
+		require.NoError(t, err)
+		if len(token) > 0 {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	return resp, body
+}
+
+func TestV2(t *testing.T) {
+	now := time.Now()
+
+	resp, body := requestV2(t, http.MethodPost, "api/v2/tasks", map[string]any{
+		"date":   now.Format(`20060102`),
+		"title":  "Полить цветы",
+		"repeat": "d 2",
+	})
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	var created map[string]string
+	assert.NoError(t, json.Unmarshal(body, &created))
+	id := created["id"]
+	assert.NotEmpty(t, id)
+	location := resp.Header.Get("Location")
+	assert.Equal(t, "/api/v2/tasks/"+id, location)
+
+	resp, body = requestV2(t, http.MethodGet, location[1:], nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	var task map[string]string
+	assert.NoError(t, json.Unmarshal(body, &task))
+	assert.Equal(t, "Полить цветы", task["title"])
+
+	etag := resp.Header.Get("ETag")
+	assert.NotEmpty(t, etag)
+
+	resp, _ = requestV2(t, http.MethodPatch, location[1:], map[string]any{"comment": "кактус не трогать"})
+	assert.Equal(t, http.StatusPreconditionRequired, resp.StatusCode)
+
+	resp, body = requestV2(t, http.MethodPatch, location[1:], map[string]any{"comment": "кактус не трогать"}, "If-Match", etag)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.NoError(t, json.Unmarshal(body, &task))
+	assert.Equal(t, "Полить цветы", task["title"])
+	assert.Equal(t, "кактус не трогать", task["comment"])
+
+	resp, _ = requestV2(t, http.MethodPost, location[1:]+"/complete", nil, "If-Match", etag)
+	assert.Equal(t, http.StatusPreconditionFailed, resp.StatusCode)
+
+	resp, body = requestV2(t, http.MethodPost, location[1:]+"/complete", nil, "If-Match", "*")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	etag = resp.Header.Get("ETag")
+	assert.NoError(t, json.Unmarshal(body, &task))
+	assert.Equal(t, now.AddDate(0, 0, 2).Format(`20060102`), task["date"])
+
+	resp, _ = requestV2(t, http.MethodGet, location[1:]+"/complete", nil)
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+	assert.Equal(t, "POST", resp.Header.Get("Allow"))
+
+	resp, _ = requestV2(t, http.MethodOptions, "api/task", nil)
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+	assert.NotEmpty(t, resp.Header.Get("Allow"))
+
+	resp, _ = requestV2(t, http.MethodDelete, location[1:], nil, "If-Match", etag)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	resp, _ = requestV2(t, http.MethodGet, location[1:], nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp, _ = requestV2(t, http.MethodGet, "api/v2/tasks/abc", nil)
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+}
@@ -0,0 +1,151 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/AsyaBiryukova/go_final_project/internal/db"
+	"github.com/AsyaBiryukova/go_final_project/internal/notify"
+	"github.com/AsyaBiryukova/go_final_project/internal/webhook"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhookDispatcher(t *testing.T) {
+	storage := startTestDB(t)
+	ctx := context.Background()
+
+	var mu sync.Mutex
+	var received []string
+	status := http.StatusInternalServerError
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+		// Подпись проверяется так же, как это делает получатель
+		signature := webhook.Sign("секрет", r.Header.Get(webhook.HeaderTimestamp), body)
+		assert.Equal(t, signature, r.Header.Get(webhook.HeaderSignature))
+
+		mu.Lock()
+		defer mu.Unlock()
+		received = append(received, r.Header.Get(webhook.HeaderEvent))
+		w.WriteHeader(status)
+	}))
+	defer receiver.Close()
+
+	hookID, err := storage.AddWebhook(ctx, db.Webhook{
+		URL:    receiver.URL,
+		Events: []string{notify.EventTaskCreated, notify.EventTaskCompleted},
+		Secret: "секрет",
+	}, time.Now())
+	require.NoError(t, err)
+
+	// В очередь попадают только события, на которые подписан webhook
+	outbox := webhook.NewOutbox(&storage)
+	now := time.Now()
+	task := db.Task{ID: "1", Date: now.Format(`20060102`), Title: "Событие"}
+	require.NoError(t, outbox.Notify(ctx, notify.Event{Type: notify.EventTaskCreated, Task: task, Time: now}))
+	require.NoError(t, outbox.Notify(ctx, notify.Event{Type: notify.EventTaskUpdated, Task: task, Time: now}))
+
+	// Ошибка получателя откладывает повтор доставки
+	dispatcher := webhook.NewDispatcher(&storage, http.DefaultClient, time.Hour)
+	dispatcher.Deliver(ctx, now)
+	dispatcher.Deliver(ctx, now.Add(time.Second))
+	mu.Lock()
+	assert.Equal(t, []string{notify.EventTaskCreated}, received)
+	status = http.StatusNoContent
+	mu.Unlock()
+
+	dispatcher.Deliver(ctx, now.Add(webhook.BaseDelay))
+	mu.Lock()
+	assert.Equal(t, []string{notify.EventTaskCreated, notify.EventTaskCreated}, received)
+	mu.Unlock()
+
+	// Доставленное событие больше не отправляется
+	dispatcher.Deliver(ctx, now.Add(time.Hour))
+	mu.Lock()
+	assert.Len(t, received, 2)
+	mu.Unlock()
+
+	deliveries, err := storage.GetDeliveries(ctx, hookID, 10)
+	require.NoError(t, err)
+	require.Len(t, deliveries, 2)
+	assert.Equal(t, db.DeliveryDelivered, deliveries[0].Status)
+	assert.Equal(t, http.StatusNoContent, deliveries[0].StatusCode)
+	assert.Equal(t, 2, deliveries[0].Attempt)
+	assert.Equal(t, db.DeliveryPending, deliveries[1].Status)
+	assert.Equal(t, http.StatusInternalServerError, deliveries[1].StatusCode)
+
+	assert.Equal(t, webhook.BaseDelay, webhook.Backoff(1))
+	assert.Equal(t, 4*webhook.BaseDelay, webhook.Backoff(3))
+	assert.Equal(t, 6*time.Hour, webhook.Backoff(webhook.MaxAttempts*2))
+}
+
+func TestWebhooks(t *testing.T) {
+	db := openDB(t)
+	defer db.Close()
+
+	resp, _ := requestV2(t, http.MethodPost, "api/webhooks", map[string]any{
+		"url":    "ftp://example.com/hook",
+		"events": []string{notify.EventTaskCreated},
+	})
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+	resp, _ = requestV2(t, http.MethodPost, "api/webhooks", map[string]any{
+		"url":    "http://example.com/hook",
+		"events": []string{"task.unknown"},
+	})
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+
+	resp, body := requestV2(t, http.MethodPost, "api/webhooks", map[string]any{
+		"url":    "http://127.0.0.1:1/hook",
+		"events": []string{notify.EventTaskCreated},
+	})
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	var hook map[string]any
+	require.NoError(t, json.Unmarshal(body, &hook))
+	hookID, _ := hook["id"].(string)
+	assert.NotEmpty(t, hookID)
+	assert.NotEmpty(t, hook["secret"])
+
+	// Секрет не возвращается в списке подписок
+	resp, body = requestV2(t, http.MethodGet, "api/webhooks", nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	var list map[string][]map[string]any
+	require.NoError(t, json.Unmarshal(body, &list))
+	var found bool
+	for _, item := range list["webhooks"] {
+		if item["id"] == hookID {
+			found = true
+			assert.Nil(t, item["secret"])
+		}
+	}
+	assert.True(t, found)
+
+	// Создание задачи добавляет событие в очередь доставки
+	id := addTask(t, task{
+		date:  time.Now().Format(`20060102`),
+		title: "Задача с webhook",
+	})
+	var payload string
+	err := db.Get(&payload, `SELECT payload FROM webhook_outbox WHERE webhook_id=? AND event=?`, hookID, notify.EventTaskCreated)
+	require.NoError(t, err)
+	var event notify.Event
+	require.NoError(t, json.Unmarshal([]byte(payload), &event))
+	assert.Equal(t, id, event.Task.ID)
+	assert.Equal(t, "Задача с webhook", event.Task.Title)
+
+	resp, _ = requestV2(t, http.MethodGet, "api/webhooks/deliveries?id="+hookID, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp, _ = requestV2(t, http.MethodDelete, "api/webhooks?id="+hookID, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp, _ = requestV2(t, http.MethodDelete, "api/webhooks?id="+hookID, nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	resp, _ = requestV2(t, http.MethodGet, "api/webhooks/deliveries?id="+hookID, nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
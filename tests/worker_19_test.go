@@ -0,0 +1,175 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/AsyaBiryukova/go_final_project/internal/db"
+	"github.com/AsyaBiryukova/go_final_project/internal/notify"
+	"github.com/AsyaBiryukova/go_final_project/internal/worker"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordNotifier запоминает полученные события и может возвращать ошибку доставки
+type recordNotifier struct {
+	mu     sync.Mutex
+	events []notify.Event
+	fail   bool
+}
+
+func (n *recordNotifier) Notify(ctx context.Context, event notify.Event) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.fail {
+		return errors.New("доставка недоступна")
+	}
+	n.events = append(n.events, event)
+	return nil
+}
+
+func (n *recordNotifier) titles() []string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	var titles []string
+	for _, event := range n.events {
+		titles = append(titles, event.Task.Title)
+	}
+	return titles
+}
+
+// startTestDB открывает копию базы данных без задач и отметок о напоминаниях, чтобы фоновая обработка не зависела от других тестов
+func startTestDB(t *testing.T) db.Storage {
+	data, err := os.ReadFile(DBFile)
+	require.NoError(t, err)
+	dbFile := filepath.Join(t.TempDir(), "scheduler.db")
+	require.NoError(t, os.WriteFile(dbFile, data, 0o600))
+
+	conn, err := sqlx.Connect("sqlite3", dbFile)
+	require.NoError(t, err)
+	// Отметки об отправленных напоминаниях и сводках могли оставить запущенный сервер и другие тесты
+	for _, table := range []string{"scheduler", "reminders", "digests"} {
+		_, err = conn.Exec("DELETE FROM " + table)
+		require.NoError(t, err)
+	}
+	require.NoError(t, conn.Close())
+
+	t.Setenv("TODO_DBFILE", dbFile)
+	t.Setenv("TODO_DATEFORMAT", "20060102")
+	storage, err := db.StartDB()
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		assert.NoError(t, storage.CloseDB())
+	})
+	return storage
+}
+
+func TestWorker(t *testing.T) {
+	storage := startTestDB(t)
+	ctx := context.Background()
+
+	now := time.Now()
+	for _, task := range []db.Task{
+		{Date: now.Format(`20060102`), Title: "Напомнить сегодня"},
+		{Date: now.AddDate(0, 0, 1).Format(`20060102`), Title: "Напомнить завтра"},
+	} {
+		_, err := storage.AddTask(ctx, task)
+		require.NoError(t, err)
+	}
+
+	// Недоставленное напоминание повторяется при следующей проверке
+	notifier := &recordNotifier{fail: true}
+	w := worker.New(&storage, notifier, time.Hour)
+	w.Tick(ctx)
+	assert.Empty(t, notifier.titles())
+
+	notifier.fail = false
+	w.Tick(ctx)
+	assert.Equal(t, []string{"Напомнить сегодня"}, notifier.titles())
+
+	// О каждой задаче напоминание отправляется один раз
+	w.Tick(ctx)
+	assert.Equal(t, []string{"Напомнить сегодня"}, notifier.titles())
+	notifier.mu.Lock()
+	assert.Equal(t, notify.EventTaskDue, notifier.events[0].Type)
+	notifier.mu.Unlock()
+
+	// Повторная доставка отправляется только получателю, которому доставить не удалось
+	_, err := storage.AddTask(ctx, db.Task{Date: now.Format(`20060102`), Title: "Напомнить повторно"})
+	require.NoError(t, err)
+	delivered, failing := &recordNotifier{}, &recordNotifier{fail: true}
+	multi := worker.New(&storage, notify.Multi{delivered, failing}, time.Hour)
+	multi.Tick(ctx)
+	assert.Equal(t, []string{"Напомнить повторно"}, delivered.titles())
+	assert.Empty(t, failing.titles())
+	failing.fail = false
+	multi.Tick(ctx)
+	multi.Tick(ctx)
+	assert.Equal(t, []string{"Напомнить повторно"}, delivered.titles())
+	assert.Equal(t, []string{"Напомнить повторно"}, failing.titles())
+
+	// Start проверяет задачи сразу и останавливается при отмене контекста
+	_, err = storage.AddTask(ctx, db.Task{Date: now.Format(`20060102`), Title: "Напомнить при запуске"})
+	require.NoError(t, err)
+	runCtx, cancel := context.WithCancel(ctx)
+	w = worker.New(&storage, notifier, time.Hour)
+	w.Start(runCtx)
+	assert.Eventually(t, func() bool {
+		return len(notifier.titles()) == 2
+	}, time.Second, 10*time.Millisecond)
+	cancel()
+
+	stopped := make(chan struct{})
+	go func() {
+		w.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("фоновая обработка не остановилась")
+	}
+}
+
+func TestWorkerListMembers(t *testing.T) {
+	storage := startTestDB(t)
+	ctx := context.Background()
+	now := time.Now()
+
+	var users []int64
+	for _, login := range []string{"owner", "member", "stranger"} {
+		id, err := storage.AddUser(ctx, login, "hash", now)
+		require.NoError(t, err)
+		users = append(users, id)
+	}
+	owner, member := storage.ForUser(users[0]), storage.ForUser(users[1])
+	listID, err := owner.AddList(ctx, "Общий список", now)
+	require.NoError(t, err)
+	require.NoError(t, owner.AddInvite(ctx, listID, db.RoleEditor, "код участника", now.Add(time.Hour)))
+	_, err = member.AcceptInvite(ctx, "код участника", now)
+	require.NoError(t, err)
+	_, err = owner.AddTask(ctx, db.Task{Date: now.Format(`20060102`), Title: "Напомнить списку", ListID: listID})
+	require.NoError(t, err)
+	_, err = owner.AddTask(ctx, db.Task{Date: now.Format(`20060102`), Title: "Напомнить владельцу"})
+	require.NoError(t, err)
+
+	// Напоминание о задаче списка получает каждый участник, о личной задаче — только владелец
+	notifier := &recordNotifier{}
+	w := worker.New(&storage, notify.NewMembers(&storage, notifier), time.Hour)
+	w.Tick(ctx)
+
+	recipients := map[string][]int64{}
+	notifier.mu.Lock()
+	for _, event := range notifier.events {
+		recipients[event.Task.Title] = append(recipients[event.Task.Title], event.Task.UserID)
+	}
+	notifier.mu.Unlock()
+	assert.ElementsMatch(t, users[:2], recipients["Напомнить списку"])
+	assert.Equal(t, []int64{users[0]}, recipients["Напомнить владельцу"])
+}
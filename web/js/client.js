@@ -0,0 +1,98 @@
+// client.js настраивает axios для работы с api планировщика.
+//
+// Изменение задачи требует заголовок If-Match с ETag, полученным при чтении задачи.
+// ETag запоминается из ответов api/task, и изменяющие запросы отправляют его обратно.
+// Если задача ещё не читалась, например при отметке о выполнении из списка, она читается перед изменением.
+//
+// Токены сессии хранятся в cookie, недоступных из JavaScript. Когда токен доступа истекает и api отвечает 401,
+// клиент один раз обновляет токены через api/signin/refresh и повторяет запрос.
+(function () {
+    const taskPaths = ["/api/task", "/api/task/done", "/api/task/snooze", "/api/task/skip"];
+    const etags = {};
+    // refreshing общее обновление токенов для запросов, получивших 401 одновременно
+    let refreshing = null;
+
+    function refresh() {
+        if (!refreshing) {
+            refreshing = axios.post("/api/signin/refresh").finally(function () {
+                refreshing = null;
+            });
+        }
+        return refreshing;
+    }
+
+    function needsRefresh(error) {
+        if (!error.response || error.response.status !== 401 || error.config.retried) {
+            return false;
+        }
+        const path = new URL(error.config.url, window.location.href).pathname;
+        return path.startsWith("/api/") && !path.startsWith("/api/signin") && path !== "/api/logout";
+    }
+
+    function taskRequest(config) {
+        const url = new URL(config.url, window.location.href);
+        if (!taskPaths.includes(url.pathname)) {
+            return null;
+        }
+        let id = url.searchParams.get("id");
+        if (!id && config.data && typeof config.data === "object") {
+            id = config.data.id;
+        }
+        return id ? {path: url.pathname, id: String(id)} : null;
+    }
+
+    axios.interceptors.request.use(function (config) {
+        const method = (config.method || "get").toLowerCase();
+        const req = taskRequest(config);
+        if (method === "get" || !req) {
+            return config;
+        }
+        // Удаление пропускаемой даты не изменяет версию задачи
+        if (req.path === "/api/task/skip" && method === "delete") {
+            return config;
+        }
+        const withETag = function (etag) {
+            config.headers = Object.assign({}, config.headers, {"If-Match": etag});
+            return config;
+        };
+        if (etags[req.id]) {
+            return withETag(etags[req.id]);
+        }
+        return axios.get("/api/task?id=" + encodeURIComponent(req.id)).then(function () {
+            return etags[req.id] ? withETag(etags[req.id]) : config;
+        }, function () {
+            return config;
+        });
+    });
+
+    axios.interceptors.response.use(function (response) {
+        const req = taskRequest(response.config);
+        if (req) {
+            const etag = response.headers.etag;
+            if (etag) {
+                etags[req.id] = etag;
+            } else if ((response.config.method || "").toLowerCase() !== "get") {
+                // Задача удалена или выполнена без повторения
+                delete etags[req.id];
+            }
+        }
+        return response;
+    }, function (error) {
+        if (needsRefresh(error)) {
+            const config = Object.assign({}, error.config, {retried: true});
+            return refresh().then(function () {
+                return axios(config);
+            }, function () {
+                return Promise.reject(error);
+            });
+        }
+        // Задачу изменили в другом окне, следующий запрос прочитает её заново
+        if (error.response && error.response.status === 412) {
+            const req = taskRequest(error.config);
+            if (req) {
+                delete etags[req.id];
+            }
+        }
+        return Promise.reject(error);
+    });
+})();